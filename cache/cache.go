@@ -0,0 +1,345 @@
+// Package cache provides an in-memory LRU cache with per-entry TTLs.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrLoadPanicked is returned to the callers of GetOrLoad waiting for a load that panicked.
+	ErrLoadPanicked = errors.New("cache: load panicked")
+)
+
+// EvictionReason is the reason an entry left the cache.
+type EvictionReason int
+
+const (
+	// EvictionExpired is the reason of entries whose TTL passed.
+	EvictionExpired EvictionReason = iota
+	// EvictionCapacity is the reason of least recently used entries evicted to stay within
+	// Options.MaxEntries or Options.MaxBytes.
+	EvictionCapacity
+	// EvictionRemoved is the reason of entries removed with Delete or Purge, or replaced with
+	// Set.
+	EvictionRemoved
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictionExpired:
+		return "expired"
+	case EvictionCapacity:
+		return "capacity"
+	case EvictionRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+type Options[K comparable, V any] struct {
+	// MaxEntries, if set, is the maximum number of entries.
+	MaxEntries int
+	// MaxBytes, if set, is the maximum total size of the entries, as returned by Size.
+	MaxBytes int64
+	// Size returns the size of an entry in bytes. It is required with MaxBytes.
+	Size func(key K, value V) int64
+	// TTL, if set, is the TTL of entries set with Set.
+	TTL time.Duration
+	// OnEvict, if set, is called after an entry left the cache, outside of the cache's lock.
+	OnEvict func(key K, value V, reason EvictionReason)
+}
+
+// Stats are the counters of a cache.
+type Stats struct {
+	Hits       int64
+	Misses     int64
+	Loads      int64
+	LoadErrors int64
+	Evictions  int64
+	Entries    int
+	Bytes      int64
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	size      int64
+	expiresAt time.Time
+}
+
+type eviction[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictionReason
+}
+
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// Cache is an in-memory cache evicting the least recently used entries once it is full. It is
+// safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	opts Options[K, V]
+
+	mu      sync.Mutex
+	entries map[K]*list.Element
+	lru     *list.List
+	bytes   int64
+	calls   map[K]*call[V]
+
+	hits       atomic.Int64
+	misses     atomic.Int64
+	loads      atomic.Int64
+	loadErrors atomic.Int64
+	evictions  atomic.Int64
+}
+
+func New[K comparable, V any]() *Cache[K, V] {
+	return NewWithOptions(Options[K, V]{})
+}
+
+func NewWithOptions[K comparable, V any](opts Options[K, V]) *Cache[K, V] {
+	if opts.MaxBytes > 0 && opts.Size == nil {
+		panic("cache: Size is required with MaxBytes")
+	}
+	return &Cache[K, V]{
+		opts:    opts,
+		entries: make(map[K]*list.Element),
+		lru:     list.New(),
+		calls:   make(map[K]*call[V]),
+	}
+}
+
+// Get returns the value of key, if it is cached and not expired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	v, ok, evicted := c.get(key, time.Now())
+	c.mu.Unlock()
+
+	c.notify(evicted)
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return v, ok
+}
+
+// Set caches value for key with the TTL of Options.TTL.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.opts.TTL)
+}
+
+// SetWithTTL caches value for key for ttl, or without expiry if ttl is not positive.
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	evicted := c.set(key, value, ttl, time.Now())
+	c.mu.Unlock()
+	c.notify(evicted)
+}
+
+// Delete removes key from the cache.
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	var evicted []eviction[K, V]
+	if el, ok := c.entries[key]; ok {
+		evicted = append(evicted, c.remove(el, EvictionRemoved))
+	}
+	c.mu.Unlock()
+	c.notify(evicted)
+}
+
+// Purge removes all entries.
+func (c *Cache[K, V]) Purge() {
+	c.mu.Lock()
+	evicted := make([]eviction[K, V], 0, len(c.entries))
+	for c.lru.Len() > 0 {
+		evicted = append(evicted, c.remove(c.lru.Back(), EvictionRemoved))
+	}
+	c.mu.Unlock()
+	c.notify(evicted)
+}
+
+// DeleteExpired evicts all expired entries. Expired entries are otherwise only evicted once they
+// are accessed or the cache is full.
+func (c *Cache[K, V]) DeleteExpired() {
+	c.mu.Lock()
+	var evicted []eviction[K, V]
+	now := time.Now()
+	for el := c.lru.Back(); el != nil; {
+		prev := el.Prev()
+		if exp := el.Value.(*entry[K, V]).expiresAt; !exp.IsZero() && now.After(exp) {
+			evicted = append(evicted, c.remove(el, EvictionExpired))
+		}
+		el = prev
+	}
+	c.mu.Unlock()
+	c.notify(evicted)
+}
+
+// Len returns the number of entries, including expired ones that weren't evicted yet.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// GetOrLoad returns the value of key, calling load to produce and cache it on a miss.
+// Concurrent calls for the same key share a single call of load. Errors of load are returned
+// and not cached. If the shared call fails with a context error, e.g. because the context of
+// the caller that started it was canceled, the other callers load the value themselves.
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, key K, load func(ctx context.Context, key K) (V, error)) (V, error) {
+	for missed := false; ; missed = true {
+		c.mu.Lock()
+		v, ok, evicted := c.get(key, time.Now())
+		if ok {
+			c.mu.Unlock()
+			c.notify(evicted)
+			c.hits.Add(1)
+			return v, nil
+		}
+		if !missed {
+			c.misses.Add(1)
+		}
+		if cl, ok := c.calls[key]; ok {
+			c.mu.Unlock()
+			c.notify(evicted)
+			select {
+			case <-cl.done:
+				if isContextError(cl.err) && ctx.Err() == nil {
+					continue
+				}
+				return cl.value, cl.err
+			case <-ctx.Done():
+				var zero V
+				return zero, ctx.Err()
+			}
+		}
+		cl := &call[V]{done: make(chan struct{})}
+		c.calls[key] = cl
+		c.mu.Unlock()
+		c.notify(evicted)
+
+		c.loads.Add(1)
+		c.load(ctx, key, cl, load)
+		return cl.value, cl.err
+	}
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// load calls load and caches its value. Waiters of cl are released even if load panics.
+func (c *Cache[K, V]) load(ctx context.Context, key K, cl *call[V], load func(ctx context.Context, key K) (V, error)) {
+	var evicted []eviction[K, V]
+	defer func() {
+		if r := recover(); r != nil {
+			cl.err = ErrLoadPanicked
+			defer panic(r)
+		}
+		c.mu.Lock()
+		delete(c.calls, key)
+		if cl.err == nil {
+			evicted = c.set(key, cl.value, c.opts.TTL, time.Now())
+		} else {
+			c.loadErrors.Add(1)
+		}
+		c.mu.Unlock()
+		close(cl.done)
+		c.notify(evicted)
+	}()
+	cl.value, cl.err = load(ctx, key)
+}
+
+// Stats returns the counters of the cache.
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	entries, bytes := c.lru.Len(), c.bytes
+	c.mu.Unlock()
+	return Stats{
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		Loads:      c.loads.Load(),
+		LoadErrors: c.loadErrors.Load(),
+		Evictions:  c.evictions.Load(),
+		Entries:    entries,
+		Bytes:      bytes,
+	}
+}
+
+func (c *Cache[K, V]) get(key K, now time.Time) (V, bool, []eviction[K, V]) {
+	var zero V
+	el, ok := c.entries[key]
+	if !ok {
+		return zero, false, nil
+	}
+	e := el.Value.(*entry[K, V])
+	if !e.expiresAt.IsZero() && now.After(e.expiresAt) {
+		return zero, false, []eviction[K, V]{c.remove(el, EvictionExpired)}
+	}
+	c.lru.MoveToFront(el)
+	return e.value, true, nil
+}
+
+func (c *Cache[K, V]) set(key K, value V, ttl time.Duration, now time.Time) []eviction[K, V] {
+	var evicted []eviction[K, V]
+	if el, ok := c.entries[key]; ok {
+		evicted = append(evicted, c.remove(el, EvictionRemoved))
+	}
+
+	e := &entry[K, V]{key: key, value: value}
+	if ttl > 0 {
+		e.expiresAt = now.Add(ttl)
+	}
+	if c.opts.Size != nil {
+		e.size = c.opts.Size(key, value)
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	c.bytes += e.size
+
+	// Evict the least recently used entries until the cache fits. Expired entries are reported as
+	// such but aren't evicted ahead of live ones.
+	for c.full() && c.lru.Len() > 1 {
+		victim := c.lru.Back()
+		reason := EvictionCapacity
+		if exp := victim.Value.(*entry[K, V]).expiresAt; !exp.IsZero() && now.After(exp) {
+			reason = EvictionExpired
+		}
+		evicted = append(evicted, c.remove(victim, reason))
+	}
+	return evicted
+}
+
+func (c *Cache[K, V]) full() bool {
+	return (c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries) ||
+		(c.opts.MaxBytes > 0 && c.bytes > c.opts.MaxBytes)
+}
+
+func (c *Cache[K, V]) remove(el *list.Element, reason EvictionReason) eviction[K, V] {
+	e := c.lru.Remove(el).(*entry[K, V])
+	delete(c.entries, e.key)
+	c.bytes -= e.size
+	if reason != EvictionRemoved {
+		c.evictions.Add(1)
+	}
+	return eviction[K, V]{key: e.key, value: e.value, reason: reason}
+}
+
+func (c *Cache[K, V]) notify(evicted []eviction[K, V]) {
+	if c.opts.OnEvict == nil {
+		return
+	}
+	for _, ev := range evicted {
+		c.opts.OnEvict(ev.key, ev.value, ev.reason)
+	}
+}
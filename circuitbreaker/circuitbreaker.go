@@ -0,0 +1,327 @@
+// Package circuitbreaker stops calling a failing dependency for a while, so that it can recover
+// and callers fail fast instead of waiting for timeouts.
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWindow              = time.Minute
+	defaultWindowBuckets       = 10
+	defaultFailureRate         = 0.5
+	defaultMinRequests         = 20
+	defaultOpenTimeout         = 30 * time.Second
+	defaultHalfOpenMaxRequests = 1
+)
+
+var (
+	// ErrOpen is returned without calling the function while the breaker is open.
+	ErrOpen = errors.New("circuit breaker is open")
+	// ErrTooManyRequests is returned without calling the function while the breaker is half-open
+	// and the allowed trial requests are in flight.
+	ErrTooManyRequests = errors.New("circuit breaker is half-open, too many requests")
+	// ErrPanicked is the result recorded for requests that panicked.
+	ErrPanicked = errors.New("circuit breaker request panicked")
+)
+
+// State is the state of a Breaker.
+type State int
+
+const (
+	// StateClosed lets all requests through and counts their failures.
+	StateClosed State = iota
+	// StateOpen rejects all requests until Options.OpenTimeout passed.
+	StateOpen
+	// StateHalfOpen lets Options.HalfOpenMaxRequests trial requests through. The breaker closes
+	// if all of them succeed and opens again if any fails.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type Options struct {
+	// Name identifies the breaker in OnStateChange, e.g. "payments-api".
+	Name string
+	// Window is the duration of the sliding window the failure rate is computed over. Defaults
+	// to 1m.
+	Window time.Duration
+	// WindowBuckets is the number of buckets of the window. Results expire one bucket at a time.
+	// Defaults to 10.
+	WindowBuckets int
+	// FailureRate is the failure rate in the window, between 0 and 1, at which the breaker
+	// opens. Defaults to 0.5.
+	FailureRate float64
+	// MinRequests is the number of requests in the window below which the breaker doesn't
+	// open. Defaults to 20.
+	MinRequests int
+	// OpenTimeout is the time the breaker stays open before letting trial requests through.
+	// Defaults to 30s.
+	OpenTimeout time.Duration
+	// HalfOpenMaxRequests is the number of trial requests while half-open. Defaults to 1.
+	HalfOpenMaxRequests int
+	// IsFailure decides whether an error counts as a failure, e.g. to ignore validation errors
+	// of the dependency. Defaults to all errors except context.Canceled.
+	IsFailure func(err error) bool
+	// OnStateChange, if set, is called when the state changes, e.g. to log or alert. It is
+	// called with the lock of the breaker held, so it must not call the breaker.
+	OnStateChange func(name string, from, to State)
+}
+
+// Counts are the results in the window of a Breaker.
+type Counts struct {
+	Requests  int
+	Failures  int
+	Successes int
+}
+
+// FailureRate returns the failure rate, or 0 without requests.
+func (c Counts) FailureRate() float64 {
+	if c.Requests == 0 {
+		return 0
+	}
+	return float64(c.Failures) / float64(c.Requests)
+}
+
+type bucket struct {
+	epoch     int64
+	successes int
+	failures  int
+}
+
+// Breaker is a circuit breaker. It is safe for concurrent use.
+type Breaker struct {
+	opts           Options
+	bucketDuration time.Duration
+
+	mu               sync.Mutex
+	state            State
+	generation       uint64
+	openedAt         time.Time
+	buckets          []bucket
+	halfOpenRequests int
+	halfOpenSuccess  int
+}
+
+func New(name string) *Breaker {
+	return NewWithOptions(Options{Name: name})
+}
+
+func NewWithOptions(opts Options) *Breaker {
+	if opts.Window <= 0 {
+		opts.Window = defaultWindow
+	}
+	if opts.WindowBuckets <= 0 {
+		opts.WindowBuckets = defaultWindowBuckets
+	}
+	if opts.FailureRate <= 0 || opts.FailureRate > 1 {
+		opts.FailureRate = defaultFailureRate
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = defaultMinRequests
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = defaultOpenTimeout
+	}
+	if opts.HalfOpenMaxRequests <= 0 {
+		opts.HalfOpenMaxRequests = defaultHalfOpenMaxRequests
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = defaultIsFailure
+	}
+
+	bucketDuration := opts.Window / time.Duration(opts.WindowBuckets)
+	if bucketDuration <= 0 {
+		bucketDuration = 1
+	}
+	return &Breaker{opts: opts, bucketDuration: bucketDuration, buckets: make([]bucket, opts.WindowBuckets)}
+}
+
+func defaultIsFailure(err error) bool {
+	return !errors.Is(err, context.Canceled)
+}
+
+// Name returns Options.Name.
+func (b *Breaker) Name() string {
+	return b.opts.Name
+}
+
+// State returns the current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updateState(time.Now())
+	return b.state
+}
+
+// Counts returns the results in the current window.
+func (b *Breaker) Counts() Counts {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.counts(time.Now())
+}
+
+// Allow reports whether a request may be made. If so, done must be called with the result of
+// the request, even if it panics, see RecordPanic. Otherwise it returns ErrOpen or ErrTooManyRequests. Execute and Do call it for
+// the caller.
+func (b *Breaker) Allow() (done func(err error), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.updateState(now)
+	switch b.state {
+	case StateOpen:
+		return nil, ErrOpen
+	case StateHalfOpen:
+		if b.halfOpenRequests >= b.opts.HalfOpenMaxRequests {
+			return nil, ErrTooManyRequests
+		}
+		b.halfOpenRequests++
+	}
+
+	generation := b.generation
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.record(generation, err) })
+	}, nil
+}
+
+// Do calls fn unless the breaker rejects the request, and records its result. A panic of fn is
+// recorded as ErrPanicked and propagated.
+func (b *Breaker) Do(fn func() error) (err error) {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	defer RecordPanic(done, &err)
+	return fn()
+}
+
+// Execute calls fn unless b rejects the request, and records its result. A panic of fn is
+// recorded as ErrPanicked and propagated.
+func Execute[T any](b *Breaker, fn func() (T, error)) (v T, err error) {
+	done, err := b.Allow()
+	if err != nil {
+		return v, err
+	}
+	defer RecordPanic(done, &err)
+	return fn()
+}
+
+// RecordPanic calls done, as returned by Allow, with *err, or with ErrPanicked while panicking,
+// in which case the panic is propagated. It must be deferred directly:
+//
+//	done, err := b.Allow()
+//	...
+//	defer circuitbreaker.RecordPanic(done, &err)
+func RecordPanic(done func(err error), err *error) {
+	if r := recover(); r != nil {
+		done(ErrPanicked)
+		panic(r)
+	}
+	done(*err)
+}
+
+// Reset closes the breaker and clears the window.
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setState(StateClosed, time.Now())
+}
+
+func (b *Breaker) record(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.updateState(now)
+	if generation != b.generation {
+		// The state changed since the request was allowed.
+		return
+	}
+
+	failed := err != nil && b.opts.IsFailure(err)
+	switch b.state {
+	case StateClosed:
+		bk := b.bucket(now)
+		if failed {
+			bk.failures++
+		} else {
+			bk.successes++
+		}
+		c := b.counts(now)
+		if failed && c.Requests >= b.opts.MinRequests && c.FailureRate() >= b.opts.FailureRate {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if failed {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.halfOpenSuccess++
+		if b.halfOpenSuccess >= b.opts.HalfOpenMaxRequests {
+			b.setState(StateClosed, now)
+		}
+	}
+}
+
+// updateState moves an open breaker to half-open once the open timeout passed.
+func (b *Breaker) updateState(now time.Time) {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.opts.OpenTimeout {
+		b.setState(StateHalfOpen, now)
+	}
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.halfOpenRequests, b.halfOpenSuccess = 0, 0
+	switch state {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		clear(b.buckets)
+	}
+	if from != state && b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(b.opts.Name, from, state)
+	}
+}
+
+// bucket returns the bucket of now, resetting it if it expired.
+func (b *Breaker) bucket(now time.Time) *bucket {
+	epoch := now.UnixNano() / int64(b.bucketDuration)
+	bk := &b.buckets[epoch%int64(len(b.buckets))]
+	if bk.epoch != epoch {
+		*bk = bucket{epoch: epoch}
+	}
+	return bk
+}
+
+func (b *Breaker) counts(now time.Time) Counts {
+	epoch := now.UnixNano() / int64(b.bucketDuration)
+	var c Counts
+	for _, bk := range b.buckets {
+		if bk.epoch > epoch-int64(len(b.buckets)) {
+			c.Successes += bk.successes
+			c.Failures += bk.failures
+		}
+	}
+	c.Requests = c.Successes + c.Failures
+	return c
+}
@@ -68,6 +68,13 @@ func substituteEnvVars(value any) (any, error) {
 				return nil, errors.Errorf("environment variable %s not found", envVar)
 			}
 		}
+		if strings.HasPrefix(v, "FILE[") && strings.HasSuffix(v, "]") {
+			bs, err := os.ReadFile(v[5 : len(v)-1])
+			if err != nil {
+				return nil, err
+			}
+			return strings.TrimSpace(string(bs)), nil
+		}
 	case map[string]any:
 		for key, value := range v {
 			if newValue, err := substituteEnvVars(value); err != nil {
@@ -0,0 +1,345 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+	secretType          = reflect.TypeOf(Secret(""))
+)
+
+// LayeredOptions configures LoadLayered.
+type LayeredOptions struct {
+	Validator *validator.Validate
+	// Files are the YAML (.yaml and .yml) or JSON files that are loaded in order, later files
+	// overriding earlier ones. Values of the form ENV[NAME] and FILE[PATH] are replaced with the
+	// environment variable or the trimmed content of the file, e.g. a mounted secret.
+	Files []string
+	// OptionalFiles are loaded like Files, but skipped if they don't exist, e.g. local overrides.
+	OptionalFiles []string
+	// EnvPrefix is the prefix of the environment variables, e.g. "APP" for APP_SERVER_PORT.
+	EnvPrefix string
+	// DisableEnv skips loading environment variables.
+	DisableEnv bool
+	// Args, if set, are parsed as flags, e.g. os.Args[1:].
+	Args []string
+}
+
+// LoadLayered loads config, a pointer to a struct, from the following layers, each overriding
+// the previous ones:
+//
+//   - the values config already holds and the values of `default` field tags
+//   - Files and OptionalFiles, in order
+//   - environment variables named after the field path, e.g. APP_SERVER_PORT for Server.Port
+//     with the prefix "APP", or after the `env` field tag. If NAME_FILE is set instead of NAME,
+//     the trimmed content of the file it names is used, e.g. a Docker secret
+//   - flags named after the field path, e.g. --server.port, or after the `flag` field tag
+//
+// Field paths use the `mapstructure` field tags, or the lower cased field names. Duration,
+// ByteSize and Secret fields are loaded from strings. Finally config is validated if a
+// Validator is set.
+func LoadLayered(config any, opts LayeredOptions) error {
+	v := reflect.ValueOf(config)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return errors.New("config must be a pointer to a struct")
+	}
+
+	var fields []field
+	collectFields(v.Elem(), nil, &fields)
+
+	for _, f := range fields {
+		if def, ok := f.tag.Lookup("default"); ok && f.value.IsZero() {
+			if err := setFromString(f.value, def); err != nil {
+				return errors.Wrapf(err, "default of %s", f.path())
+			}
+		}
+	}
+
+	for _, path := range opts.Files {
+		if err := loadFile(path, config); err != nil {
+			return err
+		}
+	}
+	for _, path := range opts.OptionalFiles {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		if err := loadFile(path, config); err != nil {
+			return err
+		}
+	}
+
+	if !opts.DisableEnv {
+		for _, f := range fields {
+			name := f.envName(opts.EnvPrefix)
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				fileName, fileOk := os.LookupEnv(name + "_FILE")
+				if !fileOk {
+					continue
+				}
+				bs, err := os.ReadFile(fileName)
+				if err != nil {
+					return errors.Wrapf(err, "environment variable %s_FILE", name)
+				}
+				value = strings.TrimSpace(string(bs))
+			}
+			if err := setFromString(f.value, value); err != nil {
+				return errors.Wrapf(err, "environment variable %s", name)
+			}
+		}
+	}
+
+	if opts.Args != nil {
+		fs := flag.NewFlagSet("config", flag.ContinueOnError)
+		for _, f := range fields {
+			fs.Func(f.flagName(), f.tag.Get("usage"), func(s string) error {
+				return setFromString(f.value, s)
+			})
+		}
+		if err := fs.Parse(opts.Args); err != nil {
+			return err
+		}
+	}
+
+	if opts.Validator != nil {
+		if err := opts.Validator.Struct(config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadFile(path string, config any) error {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	configMap := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(bs, &configMap)
+	default:
+		err = json.Unmarshal(bs, &configMap)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "config file %s", path)
+	}
+
+	if newConfigMap, err := substituteEnvVars(configMap); err != nil {
+		return err
+	} else {
+		configMap = newConfigMap.(map[string]any)
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           config,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.TextUnmarshallerHookFunc(),
+			mapstructure.StringToTimeDurationHookFunc(),
+		),
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(decoder.Decode(configMap), "config file %s", path)
+}
+
+// field is a leaf field of a config struct.
+type field struct {
+	keys  []string
+	tag   reflect.StructTag
+	value reflect.Value
+}
+
+func (f field) path() string {
+	return strings.Join(f.keys, ".")
+}
+
+func (f field) envName(prefix string) string {
+	if name := f.tag.Get("env"); name != "" {
+		return name
+	}
+	name := strings.ToUpper(strings.Join(f.keys, "_"))
+	if prefix != "" {
+		name = strings.ToUpper(prefix) + "_" + name
+	}
+	return name
+}
+
+func (f field) flagName() string {
+	if name := f.tag.Get("flag"); name != "" {
+		return name
+	}
+	return f.path()
+}
+
+// collectFields appends the leaf fields of the struct v, recursing into nested structs.
+func collectFields(v reflect.Value, keys []string, fields *[]field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		key := fieldKey(sf)
+		if key == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		fieldKeys := append(append([]string(nil), keys...), key)
+		if fv.Kind() == reflect.Struct && !reflect.PointerTo(fv.Type()).Implements(textUnmarshalerType) {
+			collectFields(fv, fieldKeys, fields)
+			continue
+		}
+		*fields = append(*fields, field{keys: fieldKeys, tag: sf.Tag, value: fv})
+	}
+}
+
+// fieldKey returns the key of a struct field in field paths, or "-" if it is skipped.
+func fieldKey(sf reflect.StructField) string {
+	key := strings.Split(sf.Tag.Get("mapstructure"), ",")[0]
+	if key == "" {
+		key = strings.ToLower(sf.Name)
+	}
+	return key
+}
+
+// setFromString sets v from the string s, e.g. of an environment variable. Slices are comma
+// separated.
+func setFromString(v reflect.Value, s string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		if err := setFromString(elem.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Slice:
+		var parts []string
+		if s != "" {
+			parts = strings.Split(s, ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setFromString(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// String returns config as indented JSON with the values of Secret fields and fields tagged
+// `secret:"true"` redacted, e.g. to log the configuration at startup.
+func String(config any) string {
+	bs, err := json.MarshalIndent(redactValue(reflect.ValueOf(config)), "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%+v", config)
+	}
+	return string(bs)
+}
+
+func redactValue(v reflect.Value) any {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Type() {
+	case secretType:
+		return v.Interface().(Secret).String()
+	case durationType:
+		return v.Interface().(time.Duration).String()
+	}
+	if v.Kind() != reflect.Struct || reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		if v.CanInterface() {
+			return v.Interface()
+		}
+		return nil
+	}
+
+	out := make(map[string]any)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		key := fieldKey(sf)
+		if key == "-" {
+			continue
+		}
+		if sf.Tag.Get("secret") == "true" {
+			if v.Field(i).IsZero() {
+				out[key] = ""
+			} else {
+				out[key] = redacted
+			}
+			continue
+		}
+		out[key] = redactValue(v.Field(i))
+	}
+	return out
+}
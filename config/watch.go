@@ -0,0 +1,206 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultWatchPollInterval = 5 * time.Second
+)
+
+// WatchOptions configures how a Watcher detects changes.
+type WatchOptions struct {
+	// PollInterval is the interval at which the modification times of the files are checked.
+	// Defaults to 5s.
+	PollInterval time.Duration
+	// DisableSignal disables reloading on SIGHUP.
+	DisableSignal bool
+	// OnError, if set, is called with the errors of reloads. The previous configuration stays
+	// current if a reload fails, e.g. because the new one is invalid.
+	OnError func(err error)
+}
+
+// Watcher holds a configuration loaded with LoadLayered and reloads it when its files change or
+// the process receives SIGHUP, so that e.g. the log level, rate limits or feature flags can be
+// changed without a restart. It is safe for concurrent use.
+type Watcher[T any] struct {
+	opts    LayeredOptions
+	current atomic.Pointer[T]
+
+	reloadMu sync.Mutex
+	mu       sync.Mutex
+	subs     []subscription[T]
+	modTimes map[string]time.Time
+}
+
+type subscription[T any] struct {
+	keys []string
+	fn   func(old, new *T)
+}
+
+// NewWatcher loads the configuration with opts and returns a Watcher holding it. Call Watch to
+// reload it on changes.
+func NewWatcher[T any](opts LayeredOptions) (*Watcher[T], error) {
+	w := &Watcher[T]{opts: opts}
+	config, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.current.Store(config)
+	w.modTimes = w.fileModTimes()
+	return w, nil
+}
+
+// Current returns the current configuration. It must not be modified.
+func (w *Watcher[T]) Current() *T {
+	return w.current.Load()
+}
+
+// OnChange registers fn to be called after every reload that changed the value at key, a field
+// path like "server.rate_limit", or any value below it. An empty key matches all changes.
+func (w *Watcher[T]) OnChange(key string, fn func(old, new *T)) {
+	var keys []string
+	if key != "" {
+		keys = strings.Split(key, ".")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subs = append(w.subs, subscription[T]{keys: keys, fn: fn})
+}
+
+// Subscribe registers fn to be called with the new value at key, a field path like "log.level",
+// after every reload that changed it, e.g. to pass a new log level to server.SetLogLevel. It
+// panics if key doesn't name a field of type V.
+func Subscribe[T, V any](w *Watcher[T], key string, fn func(value V)) {
+	keys := strings.Split(key, ".")
+	if _, ok := fieldValue(reflect.ValueOf(w.Current()).Elem(), keys).(V); !ok {
+		panic("config: " + key + " is not a field of type " + reflect.TypeFor[V]().String())
+	}
+	w.OnChange(key, func(old, new *T) {
+		fn(fieldValue(reflect.ValueOf(new).Elem(), keys).(V))
+	})
+}
+
+// Reload loads the configuration again and, if it is valid, makes it current and calls the
+// callbacks of the changed keys.
+func (w *Watcher[T]) Reload() error {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+
+	w.mu.Lock()
+	w.modTimes = w.fileModTimes()
+	w.mu.Unlock()
+
+	config, err := w.load()
+	if err != nil {
+		return err
+	}
+	old := w.current.Swap(config)
+
+	w.mu.Lock()
+	subs := append([]subscription[T](nil), w.subs...)
+	w.mu.Unlock()
+	oldValue, newValue := reflect.ValueOf(old).Elem(), reflect.ValueOf(config).Elem()
+	for _, sub := range subs {
+		if !reflect.DeepEqual(fieldValue(oldValue, sub.keys), fieldValue(newValue, sub.keys)) {
+			sub.fn(old, config)
+		}
+	}
+	return nil
+}
+
+// Watch reloads the configuration when the modification time of one of its files changes or
+// the process receives SIGHUP, until ctx is done.
+func (w *Watcher[T]) Watch(ctx context.Context, opts WatchOptions) error {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultWatchPollInterval
+	}
+
+	var signals chan os.Signal
+	if !opts.DisableSignal {
+		signals = make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGHUP)
+		defer signal.Stop(signals)
+	}
+	ticker := time.NewTicker(opts.PollInterval)
+	defer ticker.Stop()
+
+	reload := func() {
+		if err := w.Reload(); err != nil && opts.OnError != nil {
+			opts.OnError(errors.Wrap(err, "config reload"))
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-signals:
+			reload()
+		case <-ticker.C:
+			if w.filesChanged() {
+				reload()
+			}
+		}
+	}
+}
+
+func (w *Watcher[T]) load() (*T, error) {
+	config := new(T)
+	if err := LoadLayered(config, w.opts); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (w *Watcher[T]) filesChanged() bool {
+	modTimes := w.fileModTimes()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return !reflect.DeepEqual(modTimes, w.modTimes)
+}
+
+func (w *Watcher[T]) fileModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, path := range append(append([]string(nil), w.opts.Files...), w.opts.OptionalFiles...) {
+		if fi, err := os.Stat(path); err == nil {
+			modTimes[path] = fi.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// fieldValue returns the value of the field of the struct v at the path of keys, matched like
+// the field paths of LoadLayered, or of v itself without keys. It returns nil if there is none.
+func fieldValue(v reflect.Value, keys []string) any {
+	for _, key := range keys {
+		for v.Kind() == reflect.Pointer && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return nil
+		}
+		found := false
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if sf := t.Field(i); sf.IsExported() && strings.EqualFold(fieldKey(sf), key) {
+				v, found = v.Field(i), true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return v.Interface()
+}
@@ -0,0 +1,107 @@
+package errors
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Code is a machine readable error code, e.g. "not_found". Services can define their own codes
+// and register their HTTP statuses with RegisterStatus.
+type Code string
+
+const (
+	CodeOK                 Code = "ok"
+	CodeUnknown            Code = "unknown"
+	CodeInvalidArgument    Code = "invalid_argument"
+	CodeUnauthenticated    Code = "unauthenticated"
+	CodePermissionDenied   Code = "permission_denied"
+	CodeNotFound           Code = "not_found"
+	CodeAlreadyExists      Code = "already_exists"
+	CodeConflict           Code = "conflict"
+	CodeFailedPrecondition Code = "failed_precondition"
+	CodeResourceExhausted  Code = "resource_exhausted"
+	CodeCanceled           Code = "canceled"
+	CodeDeadlineExceeded   Code = "deadline_exceeded"
+	CodeUnimplemented      Code = "unimplemented"
+	CodeUnavailable        Code = "unavailable"
+	CodeInternal           Code = "internal"
+)
+
+var (
+	statusesMu sync.RWMutex
+	statuses   = map[Code]int{
+		CodeOK:                 http.StatusOK,
+		CodeUnknown:            http.StatusInternalServerError,
+		CodeInvalidArgument:    http.StatusBadRequest,
+		CodeUnauthenticated:    http.StatusUnauthorized,
+		CodePermissionDenied:   http.StatusForbidden,
+		CodeNotFound:           http.StatusNotFound,
+		CodeAlreadyExists:      http.StatusConflict,
+		CodeConflict:           http.StatusConflict,
+		CodeFailedPrecondition: http.StatusPreconditionFailed,
+		CodeResourceExhausted:  http.StatusTooManyRequests,
+		CodeCanceled:           499,
+		CodeDeadlineExceeded:   http.StatusGatewayTimeout,
+		CodeUnimplemented:      http.StatusNotImplemented,
+		CodeUnavailable:        http.StatusServiceUnavailable,
+		CodeInternal:           http.StatusInternalServerError,
+	}
+	// statusCodes maps statuses back to the codes registered first for them.
+	statusCodes = map[int]Code{
+		http.StatusBadRequest:          CodeInvalidArgument,
+		http.StatusUnauthorized:        CodeUnauthenticated,
+		http.StatusForbidden:           CodePermissionDenied,
+		http.StatusNotFound:            CodeNotFound,
+		http.StatusConflict:            CodeConflict,
+		http.StatusPreconditionFailed:  CodeFailedPrecondition,
+		http.StatusTooManyRequests:     CodeResourceExhausted,
+		499:                            CodeCanceled,
+		http.StatusGatewayTimeout:      CodeDeadlineExceeded,
+		http.StatusNotImplemented:      CodeUnimplemented,
+		http.StatusServiceUnavailable:  CodeUnavailable,
+		http.StatusInternalServerError: CodeInternal,
+	}
+)
+
+// RegisterStatus registers the HTTP status of code, replacing the status of built-in codes.
+func RegisterStatus(code Code, status int) {
+	statusesMu.Lock()
+	defer statusesMu.Unlock()
+	statuses[code] = status
+	if _, ok := statusCodes[status]; !ok {
+		statusCodes[status] = code
+	}
+}
+
+// HTTPStatus returns the HTTP status of code, or 500 if it isn't registered.
+func (c Code) HTTPStatus() int {
+	statusesMu.RLock()
+	defer statusesMu.RUnlock()
+	if status, ok := statuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// HTTPStatusOf returns the HTTP status of the code of err.
+func HTTPStatusOf(err error) int {
+	return CodeOf(err).HTTPStatus()
+}
+
+// CodeForStatus returns the code of an HTTP status, e.g. of a response without a code, or
+// CodeUnknown if there is none.
+func CodeForStatus(status int) Code {
+	statusesMu.RLock()
+	defer statusesMu.RUnlock()
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	switch {
+	case status < http.StatusBadRequest:
+		return CodeOK
+	case status < http.StatusInternalServerError:
+		return CodeInvalidArgument
+	default:
+		return CodeUnknown
+	}
+}
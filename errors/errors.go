@@ -0,0 +1,191 @@
+// Package errors provides errors with machine readable codes, metadata and stack traces, and
+// maps the codes to HTTP statuses. The server renders these errors as problems with their code
+// and the client reports error responses with the code of the problem.
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+)
+
+const (
+	maxStackDepth = 32
+)
+
+// Error is an error with a code, metadata and the stack trace of its creation.
+type Error struct {
+	code     Code
+	msg      string
+	cause    error
+	metadata map[string]any
+	stack    []uintptr
+	// origin is the error e was copied from by With, so that copies of sentinel errors match
+	// them with Is.
+	origin *Error
+}
+
+// New returns an error with the given code and message.
+func New(code Code, msg string) *Error {
+	return newError(code, msg, nil)
+}
+
+func Newf(code Code, format string, args ...any) *Error {
+	return newError(code, fmt.Sprintf(format, args...), nil)
+}
+
+// Wrap returns an error with the given code and message caused by err. The message of err is
+// appended to msg. It returns nil if err is nil.
+func Wrap(err error, code Code, msg string) *Error {
+	if err == nil {
+		return nil
+	}
+	return newError(code, msg, err)
+}
+
+func Wrapf(err error, code Code, format string, args ...any) *Error {
+	if err == nil {
+		return nil
+	}
+	return newError(code, fmt.Sprintf(format, args...), err)
+}
+
+func newError(code Code, msg string, cause error) *Error {
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(3, pcs[:])
+	return &Error{code: code, msg: msg, cause: cause, stack: pcs[:n]}
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.cause == nil:
+		return e.msg
+	case e.msg == "":
+		return e.cause.Error()
+	default:
+		return e.msg + ": " + e.cause.Error()
+	}
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Code returns the code of the error.
+func (e *Error) Code() Code {
+	return e.code
+}
+
+// Message returns the message of the error without the message of its cause.
+func (e *Error) Message() string {
+	return e.msg
+}
+
+// With returns a copy of e with an additional metadata key/value pair, e.g. the ID of the
+// resource that wasn't found. e isn't modified, so With can be used on package level errors, and
+// the copy matches e with Is.
+func (e *Error) With(key string, value any) *Error {
+	cp := *e
+	cp.metadata = make(map[string]any, len(e.metadata)+1)
+	for k, v := range e.metadata {
+		cp.metadata[k] = v
+	}
+	cp.metadata[key] = value
+	if cp.origin == nil {
+		cp.origin = e
+	}
+	return &cp
+}
+
+// Is reports whether e was copied from target by With.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && e.origin != nil && (e.origin == t || e.origin == t.origin)
+}
+
+// Metadata returns the metadata of the error, without the metadata of its causes.
+func (e *Error) Metadata() map[string]any {
+	return e.metadata
+}
+
+// Stack returns the stack trace of the creation of the error, one "function\n\tfile:line" pair
+// per frame.
+func (e *Error) Stack() string {
+	var sb strings.Builder
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
+
+// Format prints the stack trace with the %+v verb.
+func (e *Error) Format(s fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && s.Flag('+'):
+		io.WriteString(s, e.Error())
+		io.WriteString(s, "\n")
+		io.WriteString(s, e.Stack())
+	case verb == 'q':
+		fmt.Fprintf(s, "%q", e.Error())
+	default:
+		io.WriteString(s, e.Error())
+	}
+}
+
+// CodeOf returns the code of the outermost *Error in the chain of err, CodeOK if err is nil, or
+// CodeUnknown if there is none.
+func CodeOf(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return CodeUnknown
+}
+
+// MetadataOf returns the metadata of all *Error in the chain of err. The metadata of outer
+// errors takes precedence.
+func MetadataOf(err error) map[string]any {
+	var metadata map[string]any
+	for err != nil {
+		if e, ok := err.(*Error); ok && len(e.metadata) > 0 {
+			if metadata == nil {
+				metadata = make(map[string]any)
+			}
+			for k, v := range e.metadata {
+				if _, ok := metadata[k]; !ok {
+					metadata[k] = v
+				}
+			}
+		}
+		err = errors.Unwrap(err)
+	}
+	return metadata
+}
+
+// Is, As, Unwrap and Join are the functions of the standard errors package, so that this package
+// can replace it.
+func Is(err, target error) bool {
+	return errors.Is(err, target)
+}
+
+func As(err error, target any) bool {
+	return errors.As(err, target)
+}
+
+func Unwrap(err error) error {
+	return errors.Unwrap(err)
+}
+
+func Join(errs ...error) error {
+	return errors.Join(errs...)
+}
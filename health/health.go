@@ -0,0 +1,218 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+)
+
+var (
+	// Default is the registry used by the package level functions.
+	Default = NewRegistry()
+)
+
+// Probe checks a dependency, e.g. by pinging a database pool.
+type Probe interface {
+	Check(ctx context.Context) error
+}
+
+type ProbeFunc func(ctx context.Context) error
+
+func (pf ProbeFunc) Check(ctx context.Context) error {
+	return pf(ctx)
+}
+
+type ProbeOptions struct {
+	// Timeout bounds each check. Defaults to 5s.
+	Timeout time.Duration
+	// CacheTTL, if set, reuses the last result for the given duration, which protects
+	// dependencies from frequent readiness checks.
+	CacheTTL time.Duration
+	// Optional probes are reported but don't make the registry unhealthy.
+	Optional bool
+}
+
+// Status is the status of a probe or of a whole registry.
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusFail Status = "fail"
+)
+
+// Result is the result of a single probe.
+type Result struct {
+	Status    Status        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	Optional  bool          `json:"optional,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Cached    bool          `json:"cached,omitempty"`
+}
+
+// Report is the aggregated result of all probes of a registry.
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Healthy reports whether all required probes passed.
+func (r *Report) Healthy() bool {
+	return r.Status == StatusOK
+}
+
+type probe struct {
+	probe Probe
+	opts  ProbeOptions
+
+	mu   sync.Mutex
+	last *Result
+}
+
+// Registry holds the named probes of the components of an application. Components register
+// their probes when they are created and servers aggregate them, e.g. in a readiness endpoint.
+// It is safe for concurrent use.
+type Registry struct {
+	mu     sync.RWMutex
+	probes map[string]*probe
+}
+
+func NewRegistry() *Registry {
+	return &Registry{probes: make(map[string]*probe)}
+}
+
+// Register registers a probe with the default options. A probe registered under the same name
+// is replaced.
+func (r *Registry) Register(name string, p Probe) {
+	r.RegisterWithOptions(name, p, ProbeOptions{})
+}
+
+func (r *Registry) RegisterWithOptions(name string, p Probe, opts ProbeOptions) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.probes[name] = &probe{probe: p, opts: opts}
+}
+
+// Unregister removes the probe registered under name, e.g. when a component is closed.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.probes, name)
+}
+
+// Names returns the sorted names of the registered probes.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.probes))
+	for name := range r.probes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check runs all probes concurrently and aggregates their results.
+func (r *Registry) Check(ctx context.Context) *Report {
+	r.mu.RLock()
+	probes := make(map[string]*probe, len(r.probes))
+	for name, p := range r.probes {
+		probes[name] = p
+	}
+	r.mu.RUnlock()
+
+	report := &Report{Status: StatusOK, Checks: make(map[string]Result, len(probes))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, p := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := p.check(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = res
+			if res.Status != StatusOK && !res.Optional {
+				report.Status = StatusFail
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+func (p *probe) check(ctx context.Context) Result {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last != nil && p.opts.CacheTTL > 0 && time.Since(p.last.CheckedAt) < p.opts.CacheTTL {
+		res := *p.last
+		res.Cached = true
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := runProbe(ctx, p.probe)
+	res := Result{Status: StatusOK, Optional: p.opts.Optional, Duration: time.Since(start), CheckedAt: start}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	// Results of checks cut short by the caller say nothing about the dependency.
+	if ctx.Err() == nil || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		p.last = &res
+	}
+	return res
+}
+
+// runProbe runs p and returns once it's done or ctx is done, so that probes ignoring their
+// context can't block a check.
+func runProbe(ctx context.Context, p Probe) (err error) {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("probe panicked: %v", r)
+			}
+		}()
+		done <- p.Check(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Register registers a probe with the default registry.
+func Register(name string, p Probe) {
+	Default.Register(name, p)
+}
+
+func RegisterWithOptions(name string, p Probe, opts ProbeOptions) {
+	Default.RegisterWithOptions(name, p, opts)
+}
+
+// Unregister removes a probe from the default registry.
+func Unregister(name string) {
+	Default.Unregister(name)
+}
+
+// Check runs the probes of the default registry.
+func Check(ctx context.Context) *Report {
+	return Default.Check(ctx)
+}
@@ -10,9 +10,13 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/gpahal/golib/errors"
+	web "github.com/gpahal/golib/http"
+	"github.com/gpahal/golib/log"
 	"github.com/gpahal/golib/retry"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/net/publicsuffix"
@@ -20,6 +24,8 @@ import (
 
 const (
 	defaultTimeout = 30 * time.Second
+
+	maxErrorBodySize = 4 << 10
 )
 
 type Client struct {
@@ -29,6 +35,8 @@ type Client struct {
 	retryOpts retry.Options
 }
 
+// Options configures a Client. RetryOpts retries requests that failed without a response, by
+// default only if the error is transient according to retry.IsTransient.
 type Options struct {
 	BaseUrl          *url.URL
 	BaseUrlString    string
@@ -100,7 +108,9 @@ func (c Client) NewRequestWithContext(ctx context.Context, method, urlString str
 		return nil, err
 	}
 
-	httpReq.Header = c.header
+	if c.header != nil {
+		httpReq.Header = c.header.Clone()
+	}
 	return &Request{Request: httpReq}, nil
 }
 
@@ -184,6 +194,67 @@ func (resp Response) GetHttpResponse() *http.Response {
 	return resp.Response
 }
 
+// RetryAfter returns the delay requested by the Retry-After header, given either in seconds or
+// as an HTTP date. Retried functions can pass it to retry.DelayHint for 429 and 503 responses.
+func (resp Response) RetryAfter() (time.Duration, bool) {
+	value := resp.Header.Get(web.HeaderRetryAfter)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// HTTPError is the error of a response with a 4xx or 5xx status.
+type HTTPError struct {
+	Status int
+	// Code is the code member of a problem+json body, or the code of the status.
+	Code   errors.Code
+	Title  string
+	Detail string
+	// Body is the response body, truncated to 4KB.
+	Body []byte
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("http status %d (%s)", e.Status, e.Code)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Err returns an *HTTPError if the response has a 4xx or 5xx status, consuming the body, and nil
+// otherwise.
+func (resp Response) Err() error {
+	if resp.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	e := &HTTPError{Status: resp.StatusCode, Code: errors.CodeForStatus(resp.StatusCode), Title: http.StatusText(resp.StatusCode), Body: body}
+	var problem struct {
+		Code   errors.Code `json:"code"`
+		Title  string      `json:"title"`
+		Detail string      `json:"detail"`
+	}
+	if json.Unmarshal(body, &problem) == nil {
+		if problem.Code != "" {
+			e.Code = problem.Code
+		}
+		if problem.Title != "" {
+			e.Title = problem.Title
+		}
+		e.Detail = problem.Detail
+	}
+	return e
+}
+
 func (resp Response) GetBodyString() (string, error) {
 	bs, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -207,16 +278,18 @@ func (resp Response) BindBodyJson(v any) error {
 }
 
 func (c Client) Do(req *Request) (*Response, error) {
-	var resp *Response
-	err := retry.Do(func() error {
+	if req.Header.Get(web.HeaderXRequestID) == "" {
+		if requestID := web.RequestIDFromContext(req.Context()); requestID != "" {
+			req.Header.Set(web.HeaderXRequestID, requestID)
+		}
+	}
+
+	return retry.DoWithDataWithContext(req.Context(), func(ctx context.Context) (*Response, error) {
 		httpResp, err := c.client.Do(req.Request)
 		if err != nil {
-			return err
+			log.FromContext(ctx).Debug().Err(err).Str("method", req.Method).Str("url", req.URL.Redacted()).Msg("http request failed")
+			return nil, err
 		}
-
-		resp = &Response{Response: httpResp}
-		return nil
+		return &Response{Response: httpResp}, nil
 	}, c.retryOpts)
-
-	return resp, err
 }
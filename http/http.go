@@ -1,5 +1,9 @@
 package web
 
+import (
+	"context"
+)
+
 // Headers
 const (
 	HeaderAccept              = "Accept"
@@ -29,6 +33,7 @@ const (
 	HeaderXRequestedWith      = "X-Requested-With"
 	HeaderServer              = "Server"
 	HeaderOrigin              = "Origin"
+	HeaderRetryAfter          = "Retry-After"
 
 	// Access control
 	HeaderAccessControlRequestMethod    = "Access-Control-Request-Method"
@@ -55,6 +60,7 @@ const (
 const (
 	MIMEApplicationJSON                  = "application/json"
 	MIMEApplicationJSONCharsetUTF8       = MIMEApplicationJSON + charsetUTF8WithSep
+	MIMEApplicationProblemJSON           = "application/problem+json"
 	MIMEApplicationJavaScript            = "application/javascript"
 	MIMEApplicationJavaScriptCharsetUTF8 = MIMEApplicationJavaScript + charsetUTF8WithSep
 	MIMEApplicationXML                   = "application/xml"
@@ -76,3 +82,17 @@ const (
 	charsetUTF8        = "charset=UTF-8"
 	charsetUTF8WithSep = "; " + charsetUTF8
 )
+
+type requestIDContextKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID. Outbound requests made by the
+// http client with this context propagate the ID in the X-Request-ID header.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultAdminAddr = "127.0.0.1:6060"
+)
+
+type AdminOptions struct {
+	// Addr is the TCP address of the admin listener. Defaults to 127.0.0.1:6060 unless
+	// UnixSocketPath is set.
+	Addr string
+	// UnixSocketPath, if set, serves the admin endpoints on a Unix socket instead of TCP.
+	UnixSocketPath string
+	// LogLevel exposes /debug/loglevel to read and change the log level of the server at runtime,
+	// e.g. PUT {"level":"debug","duration":"10m"}. See SetLogLevel.
+	LogLevel bool
+	// Routes exposes /debug/routes listing the routes of the server. See Routes.
+	Routes bool
+	// Setup registers additional routes on the admin server.
+	Setup func(admin *echo.Echo)
+}
+
+// NewAdmin returns a server exposing pprof, expvar, runtime stats and build info endpoints. It is
+// meant to be served on a separate, private listener. See StartOptions.Admin.
+func NewAdmin() *echo.Echo {
+	admin := echo.New()
+	admin.HideBanner = true
+	admin.HidePort = true
+
+	admin.GET("/debug/pprof/", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+	admin.GET("/debug/pprof/cmdline", echo.WrapHandler(http.HandlerFunc(pprof.Cmdline)))
+	admin.GET("/debug/pprof/profile", echo.WrapHandler(http.HandlerFunc(pprof.Profile)))
+	admin.Any("/debug/pprof/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	admin.GET("/debug/pprof/trace", echo.WrapHandler(http.HandlerFunc(pprof.Trace)))
+	admin.GET("/debug/pprof/:name", func(c echo.Context) error {
+		pprof.Handler(c.Param("name")).ServeHTTP(c.Response(), c.Request())
+		return nil
+	})
+	admin.GET("/debug/vars", echo.WrapHandler(expvar.Handler()))
+	admin.GET("/debug/runtime", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, readRuntimeStats())
+	})
+	admin.GET("/debug/buildinfo", func(c echo.Context) error {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "build info not available")
+		}
+		return c.JSON(http.StatusOK, info)
+	})
+	return admin
+}
+
+type runtimeStats struct {
+	Goroutines    int       `json:"goroutines"`
+	GOMAXPROCS    int       `json:"gomaxprocs"`
+	NumCPU        int       `json:"num_cpu"`
+	HeapAlloc     uint64    `json:"heap_alloc"`
+	HeapInuse     uint64    `json:"heap_inuse"`
+	HeapIdle      uint64    `json:"heap_idle"`
+	HeapObjects   uint64    `json:"heap_objects"`
+	Sys           uint64    `json:"sys"`
+	TotalAlloc    uint64    `json:"total_alloc"`
+	NumGC         uint32    `json:"num_gc"`
+	PauseTotalNs  uint64    `json:"pause_total_ns"`
+	LastGC        time.Time `json:"last_gc"`
+	NextGC        uint64    `json:"next_gc"`
+	GCCPUFraction float64   `json:"gc_cpu_fraction"`
+}
+
+func readRuntimeStats() runtimeStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return runtimeStats{
+		Goroutines:    runtime.NumGoroutine(),
+		GOMAXPROCS:    runtime.GOMAXPROCS(0),
+		NumCPU:        runtime.NumCPU(),
+		HeapAlloc:     ms.HeapAlloc,
+		HeapInuse:     ms.HeapInuse,
+		HeapIdle:      ms.HeapIdle,
+		HeapObjects:   ms.HeapObjects,
+		Sys:           ms.Sys,
+		TotalAlloc:    ms.TotalAlloc,
+		NumGC:         ms.NumGC,
+		PauseTotalNs:  ms.PauseTotalNs,
+		LastGC:        time.Unix(0, int64(ms.LastGC)),
+		NextGC:        ms.NextGC,
+		GCCPUFraction: ms.GCCPUFraction,
+	}
+}
+
+func listenAdmin(opts *AdminOptions) (net.Listener, error) {
+	if opts.UnixSocketPath != "" {
+		return listenUnix(opts.UnixSocketPath)
+	}
+
+	addr := opts.Addr
+	if addr == "" {
+		addr = defaultAdminAddr
+	}
+	return net.Listen("tcp", addr)
+}
+
+// startAdmin starts the admin server in the background. It is shut down when ctx is done.
+func startAdmin(ctx context.Context, e *echo.Echo, opts *AdminOptions, shutdownTimeout time.Duration) error {
+	l, err := listenAdmin(opts)
+	if err != nil {
+		return err
+	}
+
+	admin := NewAdmin()
+	admin.Logger = e.Logger
+	admin.GET("/debug/drain", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, drainStatus(e))
+	})
+	admin.POST("/debug/drain", func(c echo.Context) error {
+		go func() {
+			if err := Drain(context.Background(), e); err != nil {
+				e.Logger.Error(err)
+			}
+		}()
+		return c.JSON(http.StatusAccepted, drainStatus(e))
+	})
+	state := getServerState(e)
+	state.mu.Lock()
+	registry := state.health
+	state.mu.Unlock()
+	if registry != nil {
+		admin.GET("/debug/health", healthDetailHandler(e, registry))
+	}
+	if opts.LogLevel {
+		registerLogLevelRoutes(admin, e)
+	}
+	if opts.Routes {
+		admin.GET("/debug/routes", func(c echo.Context) error {
+			return c.JSON(http.StatusOK, Routes(e))
+		})
+	}
+	if opts.Setup != nil {
+		opts.Setup(admin)
+	}
+	admin.Listener = l
+
+	go func() {
+		if err := admin.Start(""); err != nil && err != http.ErrServerClosed {
+			e.Logger.Error(err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = admin.Shutdown(ctx)
+	}()
+	return nil
+}
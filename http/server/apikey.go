@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	defaultApiKeyHeader = "X-API-Key"
+)
+
+var (
+	// ErrApiKeyNotFound should be returned by a KeyStore when the key is unknown. It results in a 401
+	// response.
+	ErrApiKeyNotFound = errors.New("api key not found")
+	// ErrApiKeyForbidden should be returned by a KeyStore when the key is known but not allowed to
+	// access the server, e.g. because it has been revoked. It results in a 403 response.
+	ErrApiKeyForbidden = errors.New("api key forbidden")
+)
+
+// KeyStore resolves API keys to principals.
+type KeyStore interface {
+	Lookup(ctx context.Context, key string) (*Principal, error)
+}
+
+type KeyStoreFunc func(ctx context.Context, key string) (*Principal, error)
+
+func (ksf KeyStoreFunc) Lookup(ctx context.Context, key string) (*Principal, error) {
+	return ksf(ctx, key)
+}
+
+// StaticKeyStore returns a KeyStore backed by a fixed map of keys to principals. Keys are compared
+// in constant time.
+func StaticKeyStore(keys map[string]*Principal) KeyStore {
+	return KeyStoreFunc(func(ctx context.Context, key string) (*Principal, error) {
+		var found *Principal
+		for k, p := range keys {
+			if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+				found = p
+			}
+		}
+		if found == nil {
+			return nil, ErrApiKeyNotFound
+		}
+		return found, nil
+	})
+}
+
+type ApiKeyAuthOptions struct {
+	Skipper middleware.Skipper
+	Store   KeyStore
+	// Header is the request header the key is read from. Defaults to X-API-Key.
+	Header string
+	// AuthScheme, if set, also allows the key to be passed in the Authorization header with the
+	// given scheme, e.g. "Bearer".
+	AuthScheme string
+	// QueryParam, if set, allows the key to be passed as a query parameter.
+	QueryParam string
+	// Authorize is an optional check run after the key is resolved. Returning false results in a
+	// 403 response.
+	Authorize func(c echo.Context, p *Principal) bool
+}
+
+func ApiKeyAuth(store KeyStore) echo.MiddlewareFunc {
+	return ApiKeyAuthWithOptions(ApiKeyAuthOptions{Store: store})
+}
+
+func ApiKeyAuthWithOptions(opts ApiKeyAuthOptions) echo.MiddlewareFunc {
+	if opts.Store == nil {
+		panic("server: api key auth middleware requires a key store")
+	}
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.Header == "" {
+		opts.Header = defaultApiKeyHeader
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if opts.Skipper(c) {
+				return next(c)
+			}
+
+			key := extractApiKey(c, opts)
+			if key == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing api key")
+			}
+
+			p, err := opts.Store.Lookup(c.Request().Context(), key)
+			if err != nil {
+				switch {
+				case errors.Is(err, ErrApiKeyNotFound):
+					return NewHttpErrorWithInternal(http.StatusUnauthorized, "invalid api key", err)
+				case errors.Is(err, ErrApiKeyForbidden):
+					return NewHttpErrorWithInternal(http.StatusForbidden, "forbidden", err)
+				default:
+					return NewHttpErrorWithInternal(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), err)
+				}
+			}
+			if p == nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid api key")
+			}
+			if opts.Authorize != nil && !opts.Authorize(c, p) {
+				return echo.NewHTTPError(http.StatusForbidden, "forbidden")
+			}
+
+			SetPrincipal(c, p)
+			return next(c)
+		}
+	}
+}
+
+func extractApiKey(c echo.Context, opts ApiKeyAuthOptions) string {
+	req := c.Request()
+	if key := req.Header.Get(opts.Header); key != "" {
+		return key
+	}
+	if opts.AuthScheme != "" {
+		auth := req.Header.Get(echo.HeaderAuthorization)
+		prefix := opts.AuthScheme + " "
+		if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+			return auth[len(prefix):]
+		}
+	}
+	if opts.QueryParam != "" {
+		return c.QueryParam(opts.QueryParam)
+	}
+	return ""
+}
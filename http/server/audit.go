@@ -0,0 +1,257 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultAuditMaxBodySize = 64 << 10
+
+	auditRedacted = "[REDACTED]"
+)
+
+var (
+	// DefaultAuditRedactFields are the body fields whose values are redacted when
+	// AuditOptions.RedactFields is not set.
+	DefaultAuditRedactFields = []string{"password", "secret", "token", "access_token", "refresh_token", "api_key"}
+)
+
+// AuditEntry records who did what and when.
+type AuditEntry struct {
+	Time          time.Time         `json:"time"`
+	RequestID     string            `json:"request_id,omitempty"`
+	PrincipalID   string            `json:"principal_id,omitempty"`
+	PrincipalType string            `json:"principal_type,omitempty"`
+	TenantID      string            `json:"tenant_id,omitempty"`
+	RemoteIP      string            `json:"remote_ip,omitempty"`
+	Method        string            `json:"method"`
+	Route         string            `json:"route"`
+	Path          string            `json:"path"`
+	Params        map[string]string `json:"params,omitempty"`
+	Body          map[string]any    `json:"body,omitempty"`
+	Status        int               `json:"status"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// AuditSink stores audit entries, e.g. in a log, a database or a message queue.
+type AuditSink interface {
+	Record(ctx context.Context, entry *AuditEntry) error
+}
+
+type AuditSinkFunc func(ctx context.Context, entry *AuditEntry) error
+
+func (asf AuditSinkFunc) Record(ctx context.Context, entry *AuditEntry) error {
+	return asf(ctx, entry)
+}
+
+// NewLoggerAuditSink returns an AuditSink writing entries to the logger.
+func NewLoggerAuditSink(logger *zerolog.Logger) AuditSink {
+	return AuditSinkFunc(func(ctx context.Context, entry *AuditEntry) error {
+		logger.Info().
+			Time("time", entry.Time).
+			Str("request_id", entry.RequestID).
+			Str("principal_id", entry.PrincipalID).
+			Str("principal_type", entry.PrincipalType).
+			Str("tenant_id", entry.TenantID).
+			Str("remote_ip", entry.RemoteIP).
+			Str("method", entry.Method).
+			Str("route", entry.Route).
+			Str("path", entry.Path).
+			Interface("params", entry.Params).
+			Interface("body", entry.Body).
+			Int("status", entry.Status).
+			Str("error", entry.Error).
+			Msg("audit")
+		return nil
+	})
+}
+
+type AuditOptions struct {
+	Skipper middleware.Skipper
+	Sink    AuditSink
+	// Methods are the audited request methods. Defaults to POST, PUT, PATCH and DELETE.
+	Methods []string
+	// BodyFields are the top level fields of JSON request bodies included in the entry. "*"
+	// includes all fields. Defaults to none.
+	BodyFields []string
+	// RedactFields are the body fields, at any depth, whose values are replaced with
+	// "[REDACTED]". Matching is case insensitive. Defaults to DefaultAuditRedactFields.
+	RedactFields []string
+	// MaxBodySize is the largest request body parsed for BodyFields. Larger bodies are audited
+	// without body fields. Defaults to 64KB.
+	MaxBodySize int64
+	// OnError is called when the sink fails to record an entry. Defaults to logging the error.
+	OnError func(c echo.Context, err error)
+}
+
+// Audit returns a middleware recording mutating requests in the sink.
+func Audit(sink AuditSink) echo.MiddlewareFunc {
+	return AuditWithOptions(AuditOptions{Sink: sink})
+}
+
+func AuditWithOptions(opts AuditOptions) echo.MiddlewareFunc {
+	if opts.Sink == nil {
+		panic("server: audit middleware requires a sink")
+	}
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if len(opts.Methods) == 0 {
+		opts.Methods = []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	if opts.RedactFields == nil {
+		opts.RedactFields = DefaultAuditRedactFields
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultAuditMaxBodySize
+	}
+
+	methods := make(map[string]struct{}, len(opts.Methods))
+	for _, m := range opts.Methods {
+		methods[strings.ToUpper(m)] = struct{}{}
+	}
+	redact := make(map[string]struct{}, len(opts.RedactFields))
+	for _, f := range opts.RedactFields {
+		redact[strings.ToLower(f)] = struct{}{}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if _, ok := methods[req.Method]; !ok || opts.Skipper(c) {
+				return next(c)
+			}
+
+			entry := &AuditEntry{
+				Time:      time.Now(),
+				RequestID: RequestID(c),
+				RemoteIP:  c.RealIP(),
+				Method:    req.Method,
+				Route:     c.Path(),
+				Path:      req.URL.Path,
+			}
+			if names := c.ParamNames(); len(names) > 0 {
+				entry.Params = make(map[string]string, len(names))
+				for i, value := range c.ParamValues() {
+					if i < len(names) {
+						entry.Params[names[i]] = value
+					}
+				}
+			}
+			if len(opts.BodyFields) > 0 {
+				entry.Body = auditBody(req, opts.BodyFields, redact, opts.MaxBodySize)
+			}
+
+			err := next(c)
+
+			// The principal is read after the handler ran so that the middleware can be registered
+			// before the authentication middleware.
+			if p, ok := GetPrincipal(c); ok {
+				entry.PrincipalID = p.ID
+				entry.PrincipalType = p.Type
+				entry.TenantID = p.TenantID
+			}
+			entry.Status = responseStatus(c, err)
+			if err != nil {
+				entry.Error = err.Error()
+			}
+
+			if serr := opts.Sink.Record(req.Context(), entry); serr != nil {
+				if opts.OnError != nil {
+					opts.OnError(c, serr)
+				} else {
+					c.Logger().Errorf("audit: %v", serr)
+				}
+			}
+			return err
+		}
+	}
+}
+
+// auditBody reads the selected fields of a JSON request body and restores the body for the
+// handler.
+func auditBody(req *http.Request, fields []string, redact map[string]struct{}, maxSize int64) map[string]any {
+	if req.Body == nil || !strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		return nil
+	}
+
+	bs, err := io.ReadAll(io.LimitReader(req.Body, maxSize+1))
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(bs), req.Body), req.Body}
+	if err != nil || int64(len(bs)) > maxSize {
+		return nil
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(bs, &body); err != nil {
+		return nil
+	}
+
+	selected := make(map[string]any, len(fields))
+	for _, f := range fields {
+		if f == "*" {
+			selected = body
+			break
+		}
+		if v, ok := body[f]; ok {
+			selected[f] = v
+		}
+	}
+	return redactFields(selected, redact).(map[string]any)
+}
+
+func redactFields(v any, redact map[string]struct{}) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			if _, ok := redact[strings.ToLower(k)]; ok {
+				out[k] = auditRedacted
+			} else {
+				out[k] = redactFields(val, redact)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, val := range v {
+			out[i] = redactFields(val, redact)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// responseStatus returns the status the response has been or will be written with.
+func responseStatus(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+
+	var p *Problem
+	if errors.As(err, &p) {
+		return p.Status
+	}
+	if NewValidationProblem(err) != nil {
+		return http.StatusBadRequest
+	}
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return he.Code
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	principalContextKey = "golib.server.principal"
+)
+
+// Principal is the authenticated identity attached to a request by one of the authentication
+// middlewares.
+type Principal struct {
+	// ID uniquely identifies the principal, e.g. a user ID or an API key ID.
+	ID string
+	// Type describes how the principal was authenticated, e.g. "api_key".
+	Type string
+	// TenantID is the tenant the principal belongs to, if any.
+	TenantID string
+	// Roles are the roles granted to the principal.
+	Roles []string
+	// Permissions are the permissions granted to the principal.
+	Permissions []string
+	// Metadata holds arbitrary additional information about the principal.
+	Metadata map[string]any
+}
+
+// SetPrincipal attaches the principal to the request context.
+func SetPrincipal(c echo.Context, p *Principal) {
+	c.Set(principalContextKey, p)
+}
+
+// GetPrincipal returns the principal attached to the request context, if any.
+func GetPrincipal(c echo.Context) (*Principal, bool) {
+	p, ok := c.Get(principalContextKey).(*Principal)
+	return p, ok && p != nil
+}
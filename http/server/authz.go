@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PolicyResolver decides whether a principal has a role or permission, e.g. by querying a database
+// or an OPA server. See Options.PolicyResolver.
+type PolicyResolver interface {
+	HasRole(ctx context.Context, p *Principal, role string) (bool, error)
+	HasPermission(ctx context.Context, p *Principal, permission string) (bool, error)
+}
+
+// StaticPolicyResolver resolves roles and permissions from the Roles and Permissions of the
+// principal. Permissions may end in a wildcard, e.g. "orders:*" grants "orders:write", and
+// "*" grants every permission.
+type StaticPolicyResolver struct {
+	// RolePermissions grants permissions to the principals holding a role.
+	RolePermissions map[string][]string
+}
+
+func (r *StaticPolicyResolver) HasRole(_ context.Context, p *Principal, role string) (bool, error) {
+	return slices.Contains(p.Roles, role), nil
+}
+
+func (r *StaticPolicyResolver) HasPermission(_ context.Context, p *Principal, permission string) (bool, error) {
+	if permissionGranted(p.Permissions, permission) {
+		return true, nil
+	}
+	for _, role := range p.Roles {
+		if permissionGranted(r.RolePermissions[role], permission) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func permissionGranted(granted []string, permission string) bool {
+	for _, g := range granted {
+		if g == permission || g == "*" || (strings.HasSuffix(g, "*") && strings.HasPrefix(permission, g[:len(g)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRoles returns a middleware allowing only principals holding at least one of the roles.
+// Requests without a principal get a 401 error and requests of other principals a 403 error. It
+// must be registered after an authentication middleware.
+func RequireRoles(roles ...string) echo.MiddlewareFunc {
+	return requirePolicy(func(ctx context.Context, r PolicyResolver, p *Principal) (bool, error) {
+		for _, role := range roles {
+			if ok, err := r.HasRole(ctx, p, role); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	})
+}
+
+// RequirePermission returns a middleware allowing only principals holding all of the permissions.
+// See RequireRoles.
+func RequirePermission(permissions ...string) echo.MiddlewareFunc {
+	return requirePolicy(func(ctx context.Context, r PolicyResolver, p *Principal) (bool, error) {
+		for _, permission := range permissions {
+			if ok, err := r.HasPermission(ctx, p, permission); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+}
+
+func requirePolicy(allowed func(ctx context.Context, r PolicyResolver, p *Principal) (bool, error)) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := GetPrincipal(c)
+			if !ok {
+				return NewProblem(http.StatusUnauthorized, "authentication required")
+			}
+
+			ok, err := allowed(c.Request().Context(), getPolicyResolver(c), p)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return NewProblem(http.StatusForbidden, "forbidden")
+			}
+			return next(c)
+		}
+	}
+}
+
+func getPolicyResolver(c echo.Context) PolicyResolver {
+	if sctx, ok := c.(*Context); ok && sctx.policyResolver != nil {
+		return sctx.policyResolver
+	}
+	return &StaticPolicyResolver{}
+}
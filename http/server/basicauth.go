@@ -0,0 +1,92 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	defaultBasicAuthRealm = "Restricted"
+)
+
+type BasicAuthOptions struct {
+	// Skipper selects the routes that are not protected.
+	Skipper middleware.Skipper
+	// Users maps user names to passwords. Credentials are compared in constant time.
+	Users map[string]string
+	// Validator validates credentials not found in Users, e.g. against a database. It should
+	// compare secrets in constant time.
+	Validator func(c echo.Context, username, password string) (bool, error)
+	// Realm is sent in the WWW-Authenticate header. Defaults to Restricted.
+	Realm string
+}
+
+// BasicAuth returns a middleware protecting routes with HTTP basic authentication against a
+// static list of users, meant for internal tools. The user name becomes the ID of the request's
+// principal, with type "basic".
+func BasicAuth(users map[string]string) echo.MiddlewareFunc {
+	return BasicAuthWithOptions(BasicAuthOptions{Users: users})
+}
+
+func BasicAuthWithOptions(opts BasicAuthOptions) echo.MiddlewareFunc {
+	if len(opts.Users) == 0 && opts.Validator == nil {
+		panic("server: basic auth middleware requires users or a validator")
+	}
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.Realm == "" {
+		opts.Realm = defaultBasicAuthRealm
+	}
+
+	// Hashing makes the comparisons independent of the length of the credentials.
+	users := make(map[[sha256.Size]byte][sha256.Size]byte, len(opts.Users))
+	for username, password := range opts.Users {
+		users[sha256.Sum256([]byte(username))] = sha256.Sum256([]byte(password))
+	}
+	challenge := "Basic realm=" + strconv.Quote(opts.Realm)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if opts.Skipper(c) {
+				return next(c)
+			}
+
+			username, password, ok := c.Request().BasicAuth()
+			if !ok {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, challenge)
+				return NewProblem(http.StatusUnauthorized, "missing credentials")
+			}
+
+			valid := checkBasicAuthUsers(users, username, password)
+			if !valid && opts.Validator != nil {
+				var err error
+				if valid, err = opts.Validator(c, username, password); err != nil {
+					return err
+				}
+			}
+			if !valid {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, challenge)
+				return NewProblem(http.StatusUnauthorized, "invalid credentials")
+			}
+
+			SetPrincipal(c, &Principal{ID: username, Type: "basic"})
+			return next(c)
+		}
+	}
+}
+
+func checkBasicAuthUsers(users map[[sha256.Size]byte][sha256.Size]byte, username, password string) bool {
+	usernameHash := sha256.Sum256([]byte(username))
+	passwordHash := sha256.Sum256([]byte(password))
+	valid := 0
+	for u, p := range users {
+		valid |= subtle.ConstantTimeCompare(u[:], usernameHash[:]) & subtle.ConstantTimeCompare(p[:], passwordHash[:])
+	}
+	return valid == 1
+}
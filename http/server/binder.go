@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultStrictBinderMaxBodySize = 1 << 20
+)
+
+type StrictBinderOptions struct {
+	// MaxBodySize is the largest accepted JSON body. Larger bodies are rejected with a 413 error.
+	// Defaults to 1MB.
+	MaxBodySize int64
+	// AllowUnknownFields accepts JSON fields that don't exist in the target struct.
+	AllowUnknownFields bool
+	// SkipValidation doesn't validate the bound value. By default it is validated with the
+	// server's validator, which enforces required fields on every Bind.
+	SkipValidation bool
+}
+
+// StrictBinder binds requests like echo's DefaultBinder, but rejects JSON bodies with unknown
+// fields, limits their size and validates the bound value. Errors are 400 problems naming the
+// offending field. See Options.StrictBinding.
+type StrictBinder struct {
+	opts   StrictBinderOptions
+	binder echo.DefaultBinder
+}
+
+func NewStrictBinder(opts StrictBinderOptions) *StrictBinder {
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultStrictBinderMaxBodySize
+	}
+	return &StrictBinder{opts: opts}
+}
+
+func (b *StrictBinder) Bind(i any, c echo.Context) error {
+	if err := b.binder.BindPathParams(c, i); err != nil {
+		return err
+	}
+	method := c.Request().Method
+	if method == http.MethodGet || method == http.MethodDelete || method == http.MethodHead {
+		if err := b.binder.BindQueryParams(c, i); err != nil {
+			return err
+		}
+	}
+	if err := b.bindBody(c, i); err != nil {
+		return err
+	}
+	if !b.validates(c) {
+		return nil
+	}
+	return c.Validate(i)
+}
+
+// validates reports whether Bind validates the bound value, so that BindAndValidate doesn't
+// validate it again.
+func (b *StrictBinder) validates(c echo.Context) bool {
+	return !b.opts.SkipValidation && c.Echo().Validator != nil
+}
+
+func (b *StrictBinder) bindBody(c echo.Context, i any) error {
+	req := c.Request()
+	if req.ContentLength == 0 || !strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		return b.binder.BindBody(c, i)
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(c.Response(), req.Body, b.opts.MaxBodySize))
+	if !b.opts.AllowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(i)
+	if err == nil {
+		// The body must hold a single JSON value.
+		if _, err := dec.Token(); err != io.EOF {
+			p := NewProblem(http.StatusBadRequest, "request body is not valid JSON")
+			p.Internal = errors.New("unexpected data after the JSON value")
+			return p
+		}
+		return nil
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		p := NewProblem(http.StatusRequestEntityTooLarge, "request body is too large")
+		p.Internal = err
+		return p
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		p := NewProblem(http.StatusBadRequest, "request body is not valid JSON")
+		p.Internal = err
+		return p
+	case errors.As(err, &typeErr):
+		return newBindingProblem(err, FieldError{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Param:   typeErr.Type.String(),
+			Message: "must be of type " + jsonTypeName(typeErr.Type.Kind().String()),
+		})
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return newBindingProblem(err, FieldError{
+			Field:   strings.Trim(field, `"`),
+			Rule:    "unknown",
+			Message: "is not allowed",
+		})
+	}
+	return NewHttpErrorWithInternal(http.StatusBadRequest, err.Error(), err)
+}
+
+func newBindingProblem(err error, fe FieldError) *Problem {
+	p := NewProblem(http.StatusBadRequest, "request validation failed")
+	p.Extensions = map[string]any{"errors": []FieldError{fe}}
+	p.Internal = err
+	return p
+}
+
+func jsonTypeName(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "bool":
+		return "boolean"
+	case kind == "slice", kind == "array":
+		return "array"
+	case kind == "struct", kind == "map":
+		return "object"
+	default:
+		return kind
+	}
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	headerDebugBodyDump = "X-Debug-Body-Dump"
+
+	defaultBodyDumpMaxBodySize = 4 << 10
+)
+
+var (
+	// DefaultBodyDumpContentTypes are the content types dumped when BodyDumpOptions.ContentTypes
+	// is not set.
+	DefaultBodyDumpContentTypes = []string{
+		echo.MIMEApplicationJSON,
+		"application/problem+json",
+		echo.MIMEApplicationForm,
+		echo.MIMEApplicationXML,
+		"text/",
+	}
+)
+
+type BodyDumpOptions struct {
+	Skipper middleware.Skipper
+	// Header, if set, limits dumping to requests carrying the header, e.g. X-Debug-Body-Dump,
+	// that HeaderAllowed accepts. Otherwise every request the middleware applies to is dumped.
+	Header string
+	// HeaderAllowed reports whether the client of c may enable dumping with Header. It runs
+	// before the handler, so only principals of server wide authentication are known. Defaults
+	// to requests with a principal and to all requests while echo's Debug mode is on.
+	HeaderAllowed func(c echo.Context) bool
+	// MaxBodySize is the number of bytes of each body that is logged. Defaults to 4KB.
+	MaxBodySize int
+	// ContentTypes are the dumped content types. Entries ending in "/" match all subtypes. JSON
+	// and form bodies are logged with RedactFields redacted, other bodies can't be redacted and
+	// only their SHA-256 hash is logged. Defaults to DefaultBodyDumpContentTypes.
+	ContentTypes []string
+	// RedactFields are the JSON and form fields whose values are replaced with "[REDACTED]".
+	// Matching is case insensitive. Defaults to DefaultAuditRedactFields.
+	RedactFields []string
+}
+
+// BodyDump returns a middleware logging the request and response bodies of every request, meant
+// to be added to specific routes while diagnosing integration issues. Bodies are truncated to
+// MaxBodySize and JSON bodies that don't fit are omitted, since they can't be redacted.
+func BodyDump() echo.MiddlewareFunc {
+	return BodyDumpWithOptions(BodyDumpOptions{})
+}
+
+// DebugBodyDump returns a server wide middleware logging the bodies of requests carrying the
+// X-Debug-Body-Dump header, if they are authenticated or the server is in Debug mode. It should
+// only be enabled in non-production environments.
+func DebugBodyDump() echo.MiddlewareFunc {
+	return BodyDumpWithOptions(BodyDumpOptions{Header: headerDebugBodyDump})
+}
+
+func BodyDumpWithOptions(opts BodyDumpOptions) echo.MiddlewareFunc {
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultBodyDumpMaxBodySize
+	}
+	if len(opts.ContentTypes) == 0 {
+		opts.ContentTypes = DefaultBodyDumpContentTypes
+	}
+	if opts.RedactFields == nil {
+		opts.RedactFields = DefaultAuditRedactFields
+	}
+	if opts.HeaderAllowed == nil {
+		opts.HeaderAllowed = func(c echo.Context) bool {
+			_, ok := GetPrincipal(c)
+			return ok || c.Echo().Debug
+		}
+	}
+
+	redact := make(map[string]struct{}, len(opts.RedactFields))
+	for _, f := range opts.RedactFields {
+		redact[strings.ToLower(f)] = struct{}{}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if opts.Skipper(c) || (opts.Header != "" && (req.Header.Get(opts.Header) == "" || !opts.HeaderAllowed(c))) {
+				return next(c)
+			}
+
+			var reqBody []byte
+			reqTruncated := false
+			if req.Body != nil && matchesContentType(req.Header.Get(echo.HeaderContentType), opts.ContentTypes) {
+				bs, err := io.ReadAll(io.LimitReader(req.Body, int64(opts.MaxBodySize)+1))
+				req.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(bs), req.Body), req.Body}
+				if err == nil {
+					reqBody, reqTruncated = bs, len(bs) > opts.MaxBodySize
+					if reqTruncated {
+						reqBody = reqBody[:opts.MaxBodySize]
+					}
+				}
+			}
+
+			res := c.Response()
+			bdw := &bodyDumpWriter{ResponseWriter: res.Writer, max: opts.MaxBodySize}
+			res.Writer = bdw
+			err := next(c)
+			res.Writer = bdw.ResponseWriter
+
+			evt := Logger(c).Info().Int("status", responseStatus(c, err))
+			if reqBody != nil {
+				evt = evt.Str("request_body", dumpBody(req.Header.Get(echo.HeaderContentType), reqBody, reqTruncated, redact)).
+					Bool("request_body_truncated", reqTruncated)
+			}
+			if matchesContentType(res.Header().Get(echo.HeaderContentType), opts.ContentTypes) {
+				evt = evt.Str("response_body", dumpBody(res.Header().Get(echo.HeaderContentType), bdw.buf, bdw.truncated, redact)).
+					Bool("response_body_truncated", bdw.truncated)
+			}
+			evt.Msg("body dump")
+			return err
+		}
+	}
+}
+
+// dumpBody returns the body to log with the redacted fields replaced. Bodies that can't be
+// redacted are replaced with their hash, which still tells whether two bodies are equal.
+func dumpBody(contentType string, body []byte, truncated bool, redact map[string]struct{}) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == echo.MIMEApplicationJSON || strings.HasSuffix(mediaType, "+json"):
+		if truncated {
+			return "[OMITTED]"
+		}
+		var v any
+		if err := json.Unmarshal(body, &v); err != nil {
+			return "[INVALID JSON]"
+		}
+		bs, _ := json.Marshal(redactFields(v, redact))
+		return string(bs)
+	case mediaType == echo.MIMEApplicationForm:
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "[INVALID FORM]"
+		}
+		for k := range values {
+			if _, ok := redact[strings.ToLower(k)]; ok {
+				values[k] = []string{auditRedacted}
+			}
+		}
+		return values.Encode()
+	default:
+		sum := sha256.Sum256(body)
+		return "[SHA256 " + hex.EncodeToString(sum[:]) + "]"
+	}
+}
+
+// matchesContentType reports whether the media type of contentType is one of types. Entries
+// ending in "/" match all subtypes.
+func matchesContentType(contentType string, types []string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+type bodyDumpWriter struct {
+	http.ResponseWriter
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (w *bodyDumpWriter) Write(b []byte) (int, error) {
+	if remaining := w.max - len(w.buf); remaining > 0 {
+		if len(b) > remaining {
+			w.buf = append(w.buf, b[:remaining]...)
+			w.truncated = true
+		} else {
+			w.buf = append(w.buf, b...)
+		}
+	} else if len(b) > 0 {
+		w.truncated = true
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyDumpWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *bodyDumpWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *bodyDumpWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
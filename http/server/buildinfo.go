@@ -0,0 +1,116 @@
+package server
+
+import (
+	"net/http"
+	"path"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultBuildInfoPath = "/version"
+)
+
+var (
+	processStartedAt = time.Now()
+
+	readBuildInfo = sync.OnceValue(func() BuildInfo {
+		info := BuildInfo{GoVersion: runtime.Version()}
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			return info
+		}
+		info.Module = bi.Main.Path
+		info.Version = bi.Main.Version
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Revision = s.Value
+			case "vcs.time":
+				info.BuildTime = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+		return info
+	})
+)
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Module  string `json:"module,omitempty"`
+	Version string `json:"version,omitempty"`
+	// Revision is the VCS revision the binary was built from.
+	Revision string `json:"revision,omitempty"`
+	// BuildTime is the time of the VCS revision, as recorded by the go toolchain.
+	BuildTime string `json:"build_time,omitempty"`
+	// Modified reports whether the working tree had uncommitted changes.
+	Modified  bool      `json:"modified,omitempty"`
+	GoVersion string    `json:"go_version"`
+	StartedAt time.Time `json:"started_at"`
+	Uptime    string    `json:"uptime"`
+}
+
+// ReadBuildInfo returns the build info embedded by the go toolchain and the uptime of the
+// process.
+func ReadBuildInfo() BuildInfo {
+	info := readBuildInfo()
+	info.StartedAt = processStartedAt
+	info.Uptime = time.Since(processStartedAt).Round(time.Second).String()
+	return info
+}
+
+type BuildInfoOptions struct {
+	// Path of the version endpoint. Defaults to /version.
+	Path string
+	// Version overrides the module version, e.g. with a release version set with -ldflags. The
+	// toolchain only records module versions for binaries installed with go install.
+	Version string
+	// LogFields adds the version and revision to every log line of the server.
+	LogFields bool
+	// ServerHeader sets the Server response header to the module name and version.
+	ServerHeader bool
+}
+
+func (opts *BuildInfoOptions) buildInfo() BuildInfo {
+	info := ReadBuildInfo()
+	if opts.Version != "" {
+		info.Version = opts.Version
+	}
+	return info
+}
+
+// serverHeader returns the Server header value, e.g. api/v1.2.0.
+func (opts *BuildInfoOptions) serverHeader() string {
+	info := opts.buildInfo()
+	name := path.Base(info.Module)
+	if name == "." || name == "/" {
+		name = "server"
+	}
+	if info.Version == "" || info.Version == "(devel)" {
+		return name
+	}
+	return name + "/" + info.Version
+}
+
+// BuildInfoHandler returns a handler responding with the build info of the binary.
+func BuildInfoHandler(opts BuildInfoOptions) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, opts.buildInfo())
+	}
+}
+
+// newServerHeader sets the Server response header. See BuildInfoOptions.ServerHeader.
+func newServerHeader(opts BuildInfoOptions) echo.MiddlewareFunc {
+	server := opts.serverHeader()
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Set(echo.HeaderServer, server)
+			return next(c)
+		}
+	}
+}
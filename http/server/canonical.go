@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// CanonicalHost selects whether the www or the apex host is canonical.
+type CanonicalHost int
+
+const (
+	// CanonicalHostNone leaves the host unchanged.
+	CanonicalHostNone CanonicalHost = iota
+	// CanonicalHostWWW redirects example.com to www.example.com.
+	CanonicalHostWWW
+	// CanonicalHostApex redirects www.example.com to example.com.
+	CanonicalHostApex
+)
+
+type CanonicalRedirectOptions struct {
+	// Skipper skips the redirect, e.g. for health checks of load balancers probing over http.
+	Skipper middleware.Skipper
+	// HTTPS redirects http requests to https. The scheme is read from the X-Forwarded-Proto and
+	// similar headers set by TLS terminating proxies.
+	HTTPS bool
+	Host  CanonicalHost
+	// Code is the redirect status code. Defaults to 301.
+	Code int
+}
+
+// CanonicalRedirect returns a middleware redirecting requests to the canonical scheme and host.
+// It must be registered with Echo#Pre. See Options.CanonicalRedirect.
+func CanonicalRedirect(opts CanonicalRedirectOptions) echo.MiddlewareFunc {
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.Code == 0 {
+		opts.Code = http.StatusMovedPermanently
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if opts.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			scheme := c.Scheme()
+			host := req.Host
+			if opts.HTTPS && scheme != "https" {
+				scheme = "https"
+			}
+			if hostname := stripPort(host); net.ParseIP(hostname) == nil && hostname != "localhost" {
+				switch opts.Host {
+				case CanonicalHostWWW:
+					if !strings.HasPrefix(host, "www.") {
+						host = "www." + host
+					}
+				case CanonicalHostApex:
+					host = strings.TrimPrefix(host, "www.")
+				}
+			}
+
+			if scheme == c.Scheme() && host == req.Host {
+				return next(c)
+			}
+			return c.Redirect(opts.Code, scheme+"://"+host+req.URL.RequestURI())
+		}
+	}
+}
+
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	defaultCoalesceMaxBodySize = 1 << 20
+)
+
+type CoalesceOptions struct {
+	Skipper middleware.Skipper
+	// VaryHeaders are the request headers that make requests distinct, e.g. Authorization for
+	// routes whose responses depend on the caller.
+	VaryHeaders []string
+	// MaxBodySize is the largest response that is shared with waiting requests. Waiters of larger
+	// responses run the handler themselves. Defaults to 1MB.
+	MaxBodySize int
+}
+
+type coalesceCall struct {
+	done chan struct{}
+	resp *CachedResponse
+	err  error
+}
+
+// Coalesce returns a per-route middleware that runs the handler once for concurrent identical
+// GET requests and copies the response to all of them. Requests are identical if they have the
+// same host, path, query and vary headers. It protects expensive reads from thundering herds and
+// must only be used for routes whose responses don't depend on the caller, or that list the
+// relevant headers in VaryHeaders. If the handler of the first request fails with a context
+// error, e.g. because its client went away, the waiting requests run the handler themselves.
+func Coalesce() echo.MiddlewareFunc {
+	return CoalesceWithOptions(CoalesceOptions{})
+}
+
+func CoalesceWithOptions(opts CoalesceOptions) echo.MiddlewareFunc {
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultCoalesceMaxBodySize
+	}
+
+	var mu sync.Mutex
+	calls := make(map[string]*coalesceCall)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Method != http.MethodGet || opts.Skipper(c) {
+				return next(c)
+			}
+
+			key := requestKey(req, opts.VaryHeaders)
+			mu.Lock()
+			if call, ok := calls[key]; ok {
+				mu.Unlock()
+				select {
+				case <-call.done:
+				case <-req.Context().Done():
+					return req.Context().Err()
+				}
+				if isContextError(call.err) {
+					// The leader was canceled or timed out, which says nothing about this request.
+					return next(c)
+				}
+				if call.err != nil {
+					return call.err
+				}
+				if call.resp == nil {
+					return next(c)
+				}
+				return writeStoredResponse(c, call.resp)
+			}
+			call := &coalesceCall{done: make(chan struct{})}
+			calls[key] = call
+			mu.Unlock()
+
+			defer func() {
+				mu.Lock()
+				delete(calls, key)
+				mu.Unlock()
+				close(call.done)
+			}()
+
+			res := c.Response()
+			crw := &cacheResponseWriter{ResponseWriter: res.Writer, max: opts.MaxBodySize}
+			res.Writer = crw
+			call.err = next(c)
+			res.Writer = crw.ResponseWriter
+
+			if call.err == nil && crw.code != 0 && !crw.overflow && !crw.flushed {
+				call.resp = &CachedResponse{Status: crw.code, Header: cachedHeader(res.Header()), Body: crw.buf, StoredAt: time.Now()}
+			}
+			return call.err
+		}
+	}
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,327 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	encodingGzip   = "gzip"
+	encodingBrotli = "br"
+
+	defaultCompressionMinLength = 1024
+)
+
+var (
+	defaultCompressionContentTypes = []string{
+		"text/",
+		"application/json",
+		"application/javascript",
+		"application/xml",
+		"application/problem+json",
+		"application/wasm",
+		"image/svg+xml",
+	}
+)
+
+type CompressionOptions struct {
+	Skipper middleware.Skipper
+	// Level is the compression level used by the encoders. Defaults to each encoder's default
+	// level.
+	Level int
+	// MinLength is the minimum response size in bytes for a response to be compressed. Defaults to
+	// 1024.
+	MinLength int
+	// ContentTypes is the list of content types (or content type prefixes ending with "/") that
+	// are compressed. Defaults to common text based content types.
+	ContentTypes []string
+	// DisableBrotli disables brotli compression, leaving only gzip.
+	DisableBrotli bool
+}
+
+type compressEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+func Compress() echo.MiddlewareFunc {
+	return CompressWithOptions(CompressionOptions{})
+}
+
+func CompressWithOptions(opts CompressionOptions) echo.MiddlewareFunc {
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.MinLength <= 0 {
+		opts.MinLength = defaultCompressionMinLength
+	}
+	if len(opts.ContentTypes) == 0 {
+		opts.ContentTypes = defaultCompressionContentTypes
+	}
+
+	pools := map[string]*sync.Pool{
+		encodingGzip: {
+			New: func() any {
+				level := opts.Level
+				if level == 0 {
+					level = gzip.DefaultCompression
+				}
+				w, err := gzip.NewWriterLevel(io.Discard, level)
+				if err != nil {
+					w = gzip.NewWriter(io.Discard)
+				}
+				return w
+			},
+		},
+		encodingBrotli: {
+			New: func() any {
+				level := opts.Level
+				if level == 0 {
+					level = brotli.DefaultCompression
+				}
+				return brotli.NewWriterLevel(io.Discard, level)
+			},
+		},
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if opts.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			if req.Header.Get(echo.HeaderUpgrade) != "" || req.Method == http.MethodHead {
+				return next(c)
+			}
+
+			res := c.Response()
+			res.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+			encoding := negotiateEncoding(req.Header.Get(echo.HeaderAcceptEncoding), !opts.DisableBrotli)
+			if encoding == "" {
+				return next(c)
+			}
+
+			pool := pools[encoding]
+			enc := pool.Get().(compressEncoder)
+			crw := &compressResponseWriter{
+				ResponseWriter: res.Writer,
+				opts:           &opts,
+				encoding:       encoding,
+				enc:            enc,
+			}
+			res.Writer = crw
+			defer func() {
+				crw.close()
+				res.Writer = crw.ResponseWriter
+				enc.Reset(io.Discard)
+				pool.Put(enc)
+			}()
+
+			return next(c)
+		}
+	}
+}
+
+// negotiateEncoding picks the preferred supported encoding from an Accept-Encoding header value.
+// Brotli is preferred over gzip when the client accepts both with the same quality.
+func negotiateEncoding(acceptEncoding string, allowBrotli bool) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	best := ""
+	bestQ := 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		switch name {
+		case encodingBrotli:
+			if allowBrotli && q >= bestQ {
+				best, bestQ = encodingBrotli, q
+			}
+		case encodingGzip, "x-gzip":
+			if q > bestQ {
+				best, bestQ = encodingGzip, q
+			}
+		case "*":
+			if q > bestQ {
+				best, bestQ = encodingGzip, q
+				if allowBrotli {
+					best = encodingBrotli
+				}
+			}
+		}
+	}
+	return best
+}
+
+const (
+	compressStateUndecided = iota
+	compressStateCompressing
+	compressStatePassthrough
+)
+
+// compressResponseWriter buffers the start of a response until it can decide whether the
+// response should be compressed. Responses that are too small, have a content type that is not
+// compressible, are already encoded or are flushed early (streaming responses) are written as is.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	opts        *CompressionOptions
+	encoding    string
+	enc         compressEncoder
+	buf         []byte
+	code        int
+	state       int
+	wroteHeader bool
+}
+
+func (w *compressResponseWriter) WriteHeader(code int) {
+	w.code = code
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	switch w.state {
+	case compressStateCompressing:
+		return w.enc.Write(b)
+	case compressStatePassthrough:
+		return w.ResponseWriter.Write(b)
+	}
+
+	if !w.compressible() {
+		w.startPassthrough()
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.opts.MinLength {
+		if err := w.startCompressing(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *compressResponseWriter) Flush() {
+	switch w.state {
+	case compressStateUndecided:
+		w.startPassthrough()
+	case compressStateCompressing:
+		_ = w.enc.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressResponseWriter) compressible() bool {
+	header := w.Header()
+	if header.Get(echo.HeaderContentEncoding) != "" {
+		return false
+	}
+	if w.code == http.StatusNoContent || w.code == http.StatusNotModified || w.code == http.StatusPartialContent {
+		return false
+	}
+	if cl := header.Get(echo.HeaderContentLength); cl != "" {
+		if n, err := strconv.Atoi(cl); err == nil && n < w.opts.MinLength {
+			return false
+		}
+	}
+
+	contentType := header.Get(echo.HeaderContentType)
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if mediaType == "text/event-stream" {
+		return false
+	}
+	for _, ct := range w.opts.ContentTypes {
+		if strings.HasSuffix(ct, "/") && strings.HasPrefix(mediaType, ct) || mediaType == ct {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *compressResponseWriter) writeHeader() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+}
+
+func (w *compressResponseWriter) startPassthrough() {
+	w.state = compressStatePassthrough
+	w.writeHeader()
+	if len(w.buf) > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *compressResponseWriter) startCompressing() error {
+	header := w.Header()
+	if header.Get(echo.HeaderContentType) == "" {
+		header.Set(echo.HeaderContentType, http.DetectContentType(w.buf))
+		if !w.compressible() {
+			w.startPassthrough()
+			return nil
+		}
+	}
+
+	w.state = compressStateCompressing
+	header.Set(echo.HeaderContentEncoding, w.encoding)
+	header.Del(echo.HeaderContentLength)
+	w.writeHeader()
+	w.enc.Reset(w.ResponseWriter)
+	_, err := w.enc.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+func (w *compressResponseWriter) close() {
+	switch w.state {
+	case compressStateCompressing:
+		_ = w.enc.Close()
+	case compressStateUndecided:
+		if w.code != 0 || len(w.buf) > 0 {
+			w.startPassthrough()
+		}
+	}
+}
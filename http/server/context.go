@@ -4,6 +4,7 @@ import (
 	"io"
 
 	"github.com/go-playground/validator/v10"
+	golog "github.com/gpahal/golib/log"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog"
 )
@@ -14,6 +15,11 @@ type Context struct {
 	ConfigRaw          any
 	ServerLoggerWriter io.Writer
 	ServerLogger       *zerolog.Logger
+
+	errorTranslators []ErrorTranslator
+	requestLogger    *zerolog.Logger
+	logFormat        LogFormat
+	policyResolver   PolicyResolver
 }
 
 func GetContext(c echo.Context) *Context {
@@ -21,5 +27,15 @@ func GetContext(c echo.Context) *Context {
 }
 
 func (c *Context) Logger() echo.Logger {
-	return newGommonLogger(c.ServerLogger, c.ServerLoggerWriter)
+	return newGommonLogger(c.ServerLogger, c.ServerLoggerWriter, c.logFormat)
+}
+
+// Logger returns the logger of the request, a child of the server logger with the request ID,
+// route, method and trace IDs of the request. Outside of a server request it returns the logger
+// stored in the request's context, see log.FromContext.
+func Logger(c echo.Context) *zerolog.Logger {
+	if sctx, ok := c.(*Context); ok && sctx.requestLogger != nil {
+		return sctx.requestLogger
+	}
+	return golog.FromContext(c.Request().Context())
 }
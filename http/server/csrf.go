@@ -0,0 +1,89 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	csrfContextKey = "golib.server.csrf"
+
+	defaultCSRFTokenLookup  = "header:" + echo.HeaderXCSRFToken + ",form:_csrf"
+	defaultCSRFCookieName   = "_csrf"
+	defaultCSRFCookieMaxAge = 86400
+)
+
+type CSRFOptions struct {
+	// Skipper skips the CSRF check, e.g. for pure API routes authenticated with tokens. See
+	// PathPrefixSkipper.
+	Skipper middleware.Skipper
+	// TokenLookup is a comma separated list of "<source>:<name>" pairs the token is read from.
+	// Defaults to "header:X-CSRF-Token,form:_csrf".
+	TokenLookup    string
+	CookieName     string
+	CookieDomain   string
+	CookiePath     string
+	CookieMaxAge   int
+	CookieSecure   bool
+	CookieHTTPOnly bool
+	CookieSameSite http.SameSite
+}
+
+func CSRF() echo.MiddlewareFunc {
+	return CSRFWithOptions(CSRFOptions{})
+}
+
+func CSRFWithOptions(opts CSRFOptions) echo.MiddlewareFunc {
+	if opts.TokenLookup == "" {
+		opts.TokenLookup = defaultCSRFTokenLookup
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = defaultCSRFCookieName
+	}
+	if opts.CookiePath == "" {
+		opts.CookiePath = "/"
+	}
+	if opts.CookieMaxAge == 0 {
+		opts.CookieMaxAge = defaultCSRFCookieMaxAge
+	}
+	if opts.CookieSameSite == 0 {
+		opts.CookieSameSite = http.SameSiteLaxMode
+	}
+
+	return middleware.CSRFWithConfig(middleware.CSRFConfig{
+		Skipper:        opts.Skipper,
+		TokenLookup:    opts.TokenLookup,
+		ContextKey:     csrfContextKey,
+		CookieName:     opts.CookieName,
+		CookieDomain:   opts.CookieDomain,
+		CookiePath:     opts.CookiePath,
+		CookieMaxAge:   opts.CookieMaxAge,
+		CookieSecure:   opts.CookieSecure,
+		CookieHTTPOnly: opts.CookieHTTPOnly,
+		CookieSameSite: opts.CookieSameSite,
+	})
+}
+
+// CSRFToken returns the CSRF token of the request, to be embedded in forms or passed to
+// client-side code.
+func CSRFToken(c echo.Context) string {
+	token, _ := c.Get(csrfContextKey).(string)
+	return token
+}
+
+// PathPrefixSkipper returns a skipper that skips requests whose path starts with one of the given
+// prefixes.
+func PathPrefixSkipper(prefixes ...string) middleware.Skipper {
+	return func(c echo.Context) bool {
+		path := c.Request().URL.Path
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
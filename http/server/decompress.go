@@ -0,0 +1,120 @@
+package server
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	encodingZstd = "zstd"
+
+	defaultDecompressMaxSize = 10 << 20
+	// zstdMaxWindow bounds the memory allocated for the zstd window, which the encoder chooses.
+	zstdMaxWindow = 8 << 20
+)
+
+var (
+	// ErrDecompressedBodyTooLarge is returned when reading a decompressed request body larger
+	// than DecompressOptions.MaxSize.
+	ErrDecompressedBodyTooLarge = errors.New("decompressed request body is too large")
+)
+
+type DecompressOptions struct {
+	Skipper middleware.Skipper
+	// MaxSize is the largest accepted decompressed body in bytes, which protects against zip
+	// bombs. Defaults to 10MB.
+	MaxSize int64
+}
+
+// Decompress returns a middleware transparently decompressing gzip, zstd and brotli encoded
+// request bodies. Requests with other encodings are rejected with a 415 error and bodies
+// decompressing to more than MaxSize with a 413 error.
+func Decompress() echo.MiddlewareFunc {
+	return DecompressWithOptions(DecompressOptions{})
+}
+
+func DecompressWithOptions(opts DecompressOptions) echo.MiddlewareFunc {
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaultDecompressMaxSize
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			encoding := strings.ToLower(strings.TrimSpace(req.Header.Get(echo.HeaderContentEncoding)))
+			if encoding == "" || encoding == "identity" || req.Body == nil || req.Body == http.NoBody || opts.Skipper(c) {
+				return next(c)
+			}
+
+			var r io.Reader
+			switch encoding {
+			case encodingGzip, "x-gzip":
+				gr, err := gzip.NewReader(req.Body)
+				if err != nil {
+					return NewHttpErrorWithInternal(http.StatusBadRequest, "invalid gzip request body", err)
+				}
+				defer gr.Close()
+				r = gr
+			case encodingZstd:
+				zr, err := zstd.NewReader(req.Body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(zstdMaxWindow))
+				if err != nil {
+					return NewHttpErrorWithInternal(http.StatusBadRequest, "invalid zstd request body", err)
+				}
+				defer zr.Close()
+				r = zr
+			case encodingBrotli:
+				r = brotli.NewReader(req.Body)
+			default:
+				return NewProblem(http.StatusUnsupportedMediaType, "unsupported content encoding "+encoding)
+			}
+
+			req.Body = struct {
+				io.Reader
+				io.Closer
+			}{&maxSizeReader{r: r, remaining: opts.MaxSize}, req.Body}
+			req.Header.Del(echo.HeaderContentEncoding)
+			req.Header.Del(echo.HeaderContentLength)
+			req.ContentLength = -1
+
+			err := next(c)
+			if err != nil && errors.Is(err, ErrDecompressedBodyTooLarge) {
+				p := NewProblem(http.StatusRequestEntityTooLarge, ErrDecompressedBodyTooLarge.Error())
+				p.Internal = err
+				return p
+			}
+			return err
+		}
+	}
+}
+
+// maxSizeReader fails with ErrDecompressedBodyTooLarge once more than remaining bytes are read.
+type maxSizeReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (r *maxSizeReader) Read(p []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, ErrDecompressedBodyTooLarge
+	}
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.r.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n + int(r.remaining), ErrDecompressedBodyTooLarge
+	}
+	return n, err
+}
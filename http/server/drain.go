@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DrainStatus describes the draining state of a server.
+type DrainStatus struct {
+	Draining bool  `json:"draining"`
+	InFlight int64 `json:"in_flight"`
+}
+
+func newInFlightMiddleware(state *serverState) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			state.inFlight.Add(1)
+			defer state.inFlight.Add(-1)
+			return next(c)
+		}
+	}
+}
+
+func (s *serverState) started(drainDelay time.Duration, shutdown context.CancelFunc, shutdownDone <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drainDelay = drainDelay
+	s.shutdown = shutdown
+	s.shutdownDone = shutdownDone
+}
+
+// beginShutdown tells long-lived connections that the server is shutting down.
+func (s *serverState) beginShutdown() {
+	s.closeOnce.Do(func() { close(s.closing) })
+}
+
+// trackConnection counts a hijacked connection until the returned function is called.
+func (s *serverState) trackConnection() (done func()) {
+	s.connections.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() { s.connections.Add(-1) })
+	}
+}
+
+// waitConnections waits until all tracked connections are closed or ctx is done.
+func (s *serverState) waitConnections(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for s.connections.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// ShutdownNotify returns a channel that is closed when the server of c starts shutting down.
+// Handlers of long-lived responses, e.g. streams, should select on it to finish their response
+// within the graceful shutdown timeout. The websocket and SSE helpers do so already.
+func ShutdownNotify(c echo.Context) <-chan struct{} {
+	return getServerState(c.Echo()).closing
+}
+
+// Drain takes the server out of rotation for a zero-downtime deploy: readiness checks start
+// failing, Drain waits StartOptions.DrainDelay for load balancers to deregister the server and
+// then shuts it down gracefully. It returns once the shutdown completed or ctx is done.
+func Drain(ctx context.Context, e *echo.Echo) error {
+	state := getServerState(e)
+	state.draining.Store(true)
+
+	state.mu.Lock()
+	delay, shutdown, shutdownDone := state.drainDelay, state.shutdown, state.shutdownDone
+	state.mu.Unlock()
+	if shutdown == nil {
+		return errors.New("server: drain requires a server started with StartWithOptions")
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	shutdown()
+	select {
+	case <-shutdownDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// IsDraining reports whether Drain was called for the server.
+func IsDraining(e *echo.Echo) bool {
+	return getServerState(e).draining.Load()
+}
+
+// InFlightRequests returns the number of requests the server is currently handling.
+func InFlightRequests(e *echo.Echo) int64 {
+	return getServerState(e).inFlight.Load()
+}
+
+// ReadinessHandler returns a handler responding with 200 OK, or 503 once the server is draining.
+func ReadinessHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if IsDraining(c.Echo()) {
+			return c.String(http.StatusServiceUnavailable, "draining")
+		}
+		return c.String(http.StatusOK, "ok")
+	}
+}
+
+// DrainStatusHandler returns a handler reporting the draining state and the number of in-flight
+// requests of the server.
+func DrainStatusHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, drainStatus(c.Echo()))
+	}
+}
+
+func drainStatus(e *echo.Echo) DrainStatus {
+	return DrainStatus{Draining: IsDraining(e), InFlight: InFlightRequests(e)}
+}
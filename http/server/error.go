@@ -1,7 +1,21 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	goerrors "github.com/gpahal/golib/errors"
+	web "github.com/gpahal/golib/http"
 	"github.com/labstack/echo/v4"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultProblemType = "about:blank"
 )
 
 func NewHttpError(code int, msgOrErr interface{}) *echo.HTTPError {
@@ -15,3 +29,200 @@ func NewHttpError(code int, msgOrErr interface{}) *echo.HTTPError {
 func NewHttpErrorWithInternal(code int, msgOrErr interface{}, internal error) *echo.HTTPError {
 	return &echo.HTTPError{Code: code, Message: msgOrErr, Internal: internal}
 }
+
+// Problem is an RFC 7807 problem details object. It is rendered as application/problem+json by
+// the server's error handler and can be returned directly from handlers.
+type Problem struct {
+	Type      string `json:"type,omitempty"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// Extensions are additional members rendered alongside the standard ones.
+	Extensions map[string]any `json:"-"`
+	// Internal is the underlying error. It is logged but never rendered.
+	Internal error `json:"-"`
+}
+
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return fmt.Sprintf("%d %s: %s", p.Status, p.Title, p.Detail)
+	}
+	return fmt.Sprintf("%d %s", p.Status, p.Title)
+}
+
+func (p *Problem) Unwrap() error {
+	return p.Internal
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	bs, err := json.Marshal((*problem)(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return bs, err
+	}
+
+	m := make(map[string]any, len(p.Extensions)+6)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// ErrorTranslator converts an error into a problem. It returns nil if it doesn't handle the
+// error.
+type ErrorTranslator func(c echo.Context, err error) *Problem
+
+var (
+	errorTranslatorsMu sync.RWMutex
+	errorTranslators   []ErrorTranslator
+)
+
+// RegisterErrorTranslator registers an error translator used by all servers. Translators are
+// tried in registration order.
+func RegisterErrorTranslator(t ErrorTranslator) {
+	errorTranslatorsMu.Lock()
+	defer errorTranslatorsMu.Unlock()
+	errorTranslators = append(errorTranslators, t)
+}
+
+func translateError(e *echo.Echo, c echo.Context, err error, translators []ErrorTranslator) *Problem {
+	for _, t := range translators {
+		if p := t(c, err); p != nil {
+			return p
+		}
+	}
+
+	errorTranslatorsMu.RLock()
+	for _, t := range errorTranslators {
+		if p := t(c, err); p != nil {
+			errorTranslatorsMu.RUnlock()
+			return p
+		}
+	}
+	errorTranslatorsMu.RUnlock()
+
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	if p = NewValidationProblem(err); p != nil {
+		return p
+	}
+	var ge *goerrors.Error
+	if errors.As(err, &ge) {
+		p = NewProblem(ge.Code().HTTPStatus(), ge.Message())
+		p.Internal = err
+		p.Extensions = map[string]any{"code": ge.Code()}
+		if p.Status >= http.StatusInternalServerError && !e.Debug {
+			// Never leak internal details of server errors.
+			p.Detail = ""
+		}
+		return p
+	}
+
+	he, ok := err.(*echo.HTTPError)
+	if ok {
+		if he.Internal != nil {
+			if herr, ok := he.Internal.(*echo.HTTPError); ok {
+				he = herr
+			}
+		}
+	} else {
+		p = NewProblem(http.StatusInternalServerError, "")
+		p.Internal = err
+		if e.Debug {
+			p.Detail = err.Error()
+		}
+		return p
+	}
+
+	p = &Problem{Title: http.StatusText(he.Code), Status: he.Code, Internal: err}
+	switch m := he.Message.(type) {
+	case string:
+		if m != p.Title {
+			p.Detail = m
+		}
+	case error:
+		p.Detail = m.Error()
+	case nil:
+	default:
+		p.Extensions = map[string]any{"error": m}
+	}
+	if he.Code >= http.StatusInternalServerError && !e.Debug {
+		// Never leak internal details of server errors.
+		p.Detail = ""
+		p.Extensions = nil
+	}
+	return p
+}
+
+// withProblemDefaults returns a copy of p with the unset standard members filled. Handlers and
+// translators may return shared problems, e.g. package level sentinels, so p isn't modified.
+func withProblemDefaults(c echo.Context, p *Problem) *Problem {
+	cp := *p
+	p = &cp
+	if p.Type == "" {
+		p.Type = defaultProblemType
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = c.Request().URL.Path
+	}
+	return p
+}
+
+func newErrorHandler(e *echo.Echo, logger func() *zerolog.Logger, onHttpError OnHttpErrorHandler, translators []ErrorTranslator, reporter ErrorReporter) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+
+		p := withProblemDefaults(c, translateError(e, c, err, translators))
+		if p.RequestID == "" {
+			p.RequestID = RequestID(c)
+		}
+
+		if onHttpError != nil {
+			onHttpError(c, &echo.HTTPError{Code: p.Status, Message: p.Title, Internal: err})
+		}
+
+		reqLogger := newContextLogger(c, logger())
+		if p.Status >= http.StatusInternalServerError {
+			evt := reqLogger.Error().Err(err).Int("status", p.Status)
+			var st interface{ StackTrace() pkgerrors.StackTrace }
+			var ge *goerrors.Error
+			if errors.As(err, &st) {
+				evt = evt.Str("stack", fmt.Sprintf("%+v", st.StackTrace()))
+			} else if errors.As(err, &ge) {
+				evt = evt.Str("stack", ge.Stack())
+			}
+			evt.Msg("server error")
+			reportError(reporter, c, err)
+		}
+
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(p.Status)
+		} else {
+			var bs []byte
+			bs, err = json.Marshal(p)
+			if err == nil {
+				err = c.Blob(p.Status, web.MIMEApplicationProblemJSON, bs)
+			}
+		}
+
+		if err != nil {
+			reqLogger.Error().Err(err).Msg("error handler")
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	headerETag        = "ETag"
+	headerIfMatch     = "If-Match"
+	headerIfNoneMatch = "If-None-Match"
+
+	defaultETagMaxBufferSize = 1 << 20
+)
+
+type ETagOptions struct {
+	Skipper middleware.Skipper
+	// Weak generates weak ETags, which is appropriate when the same content may be served with
+	// different encodings.
+	Weak bool
+	// MaxBufferSize is the largest response that is buffered to compute an ETag. Larger and
+	// streamed responses are written without one. Defaults to 1MB.
+	MaxBufferSize int
+}
+
+// ETag returns a middleware that adds ETags to successful GET responses and answers matching
+// If-None-Match requests with 304 Not Modified. ETags set by handlers are kept as is.
+func ETag() echo.MiddlewareFunc {
+	return ETagWithOptions(ETagOptions{})
+}
+
+func ETagWithOptions(opts ETagOptions) echo.MiddlewareFunc {
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.MaxBufferSize <= 0 {
+		opts.MaxBufferSize = defaultETagMaxBufferSize
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Method != http.MethodGet && req.Method != http.MethodHead || opts.Skipper(c) || isStreamingRequest(c) {
+				return next(c)
+			}
+
+			res := c.Response()
+			erw := &etagResponseWriter{ResponseWriter: res.Writer, req: req, opts: &opts}
+			res.Writer = erw
+			defer func() {
+				erw.close()
+				res.Writer = erw.ResponseWriter
+				if erw.notModified {
+					res.Status = http.StatusNotModified
+				}
+			}()
+
+			return next(c)
+		}
+	}
+}
+
+// NotModified sets the ETag response header and reports whether the request's If-None-Match
+// header matches it, in which case the handler should respond with 304 Not Modified without
+// rendering the resource.
+func NotModified(c echo.Context, etag string) bool {
+	c.Response().Header().Set(headerETag, etag)
+	return etagMatches(c.Request().Header.Get(headerIfNoneMatch), etag, true)
+}
+
+// CheckIfMatch checks the If-Match precondition of an update against the current ETag of the
+// resource. It returns a 412 problem if the resource has changed since the client read it.
+// Requests without If-Match pass.
+func CheckIfMatch(c echo.Context, etag string) error {
+	ifMatch := c.Request().Header.Get(headerIfMatch)
+	if ifMatch == "" || etagMatches(ifMatch, etag, false) {
+		return nil
+	}
+	return NewProblem(http.StatusPreconditionFailed, "resource has been modified")
+}
+
+// etagMatches reports whether etag is in the comma separated list of ETags of a conditional
+// header. Weak comparison ignores the W/ prefix, strong comparison never matches weak ETags.
+func etagMatches(header, etag string, weak bool) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagResponseWriter buffers successful responses to compute their ETag. Responses that are not
+// 200 OK, too large or flushed early are written as is.
+type etagResponseWriter struct {
+	http.ResponseWriter
+	req         *http.Request
+	opts        *ETagOptions
+	buf         []byte
+	code        int
+	passthrough bool
+	notModified bool
+}
+
+func (w *etagResponseWriter) WriteHeader(code int) {
+	w.code = code
+	if code != http.StatusOK {
+		w.startPassthrough()
+	}
+}
+
+func (w *etagResponseWriter) Write(b []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) > w.opts.MaxBufferSize {
+		w.startPassthrough()
+	}
+	return len(b), nil
+}
+
+func (w *etagResponseWriter) Flush() {
+	if !w.passthrough {
+		w.startPassthrough()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *etagResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *etagResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *etagResponseWriter) startPassthrough() {
+	w.passthrough = true
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+	if len(w.buf) > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *etagResponseWriter) close() {
+	if w.passthrough || w.code == 0 && len(w.buf) == 0 {
+		return
+	}
+
+	header := w.Header()
+	etag := header.Get(headerETag)
+	// The body of HEAD responses is empty, so only ETags set by the handler are meaningful.
+	if etag == "" && w.req.Method == http.MethodGet {
+		sum := sha256.Sum256(w.buf)
+		etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+		if w.opts.Weak {
+			etag = "W/" + etag
+		}
+		header.Set(headerETag, etag)
+	}
+
+	if etagMatches(w.req.Header.Get(headerIfNoneMatch), etag, true) {
+		header.Del(echo.HeaderContentType)
+		header.Del(echo.HeaderContentLength)
+		w.ResponseWriter.WriteHeader(http.StatusNotModified)
+		w.buf = nil
+		w.notModified = true
+		return
+	}
+	w.startPassthrough()
+}
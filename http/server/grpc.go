@@ -0,0 +1,61 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	mimeApplicationGRPC = "application/grpc"
+)
+
+// newGRPCMux routes HTTP/2 requests with a gRPC content type to grpcHandler and all other
+// requests to h.
+func newGRPCMux(grpcHandler http.Handler, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get(echo.HeaderContentType), mimeApplicationGRPC) {
+			grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// startGRPCMultiplexed serves gRPC and e on the same port. Over TLS, HTTP/2 is negotiated with
+// ALPN, otherwise the server speaks h2c, which gRPC clients use for plaintext connections, and
+// HTTP/1.1.
+func startGRPCMultiplexed(e *echo.Echo, port int, opts *StartOptions) error {
+	handler := newGRPCMux(opts.GRPC, e)
+	if opts.TLS != nil {
+		s := e.TLSServer
+		s.Handler = handler
+		s.ErrorLog = e.StdLogger
+		if e.TLSListener == nil {
+			l, err := net.Listen("tcp", s.Addr)
+			if err != nil {
+				return err
+			}
+			e.TLSListener = tls.NewListener(l, s.TLSConfig)
+		}
+		return s.Serve(e.TLSListener)
+	}
+
+	s := e.Server
+	s.Addr = fmt.Sprintf(":%d", port)
+	s.Handler = h2c.NewHandler(handler, newHTTP2Server(opts.HTTP2))
+	s.ErrorLog = e.StdLogger
+	if e.Listener == nil {
+		l, err := net.Listen("tcp", s.Addr)
+		if err != nil {
+			return err
+		}
+		e.Listener = l
+	}
+	return s.Serve(e.Listener)
+}
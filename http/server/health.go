@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gpahal/golib/health"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultHealthPath = "/readyz"
+)
+
+type HealthOptions struct {
+	// Registry holds the probes of the components used by the server. Defaults to
+	// health.Default.
+	Registry *health.Registry
+	// Path of the readiness endpoint. Defaults to /readyz.
+	Path string
+	// DetailMiddleware, if set, exposes the JSON report of all probes at Path + "/detail",
+	// protected by the middleware, e.g. RequireRoles("admin"). The report is always available on
+	// the admin listener at /debug/health.
+	DetailMiddleware []echo.MiddlewareFunc
+}
+
+// registerHealthRoutes registers the readiness endpoint, which fails once the server is draining
+// or a required probe fails. See Options.Health.
+func registerHealthRoutes(e *echo.Echo, opts HealthOptions) {
+	if opts.Registry == nil {
+		opts.Registry = health.Default
+	}
+	if opts.Path == "" {
+		opts.Path = defaultHealthPath
+	}
+	state := getServerState(e)
+	state.mu.Lock()
+	state.health = opts.Registry
+	state.mu.Unlock()
+
+	e.GET(opts.Path, func(c echo.Context) error {
+		if IsDraining(c.Echo()) {
+			return c.String(http.StatusServiceUnavailable, "draining")
+		}
+		if report := opts.Registry.Check(c.Request().Context()); !report.Healthy() {
+			return c.String(http.StatusServiceUnavailable, "unhealthy")
+		}
+		return c.String(http.StatusOK, "ok")
+	})
+	if len(opts.DetailMiddleware) > 0 {
+		e.GET(opts.Path+"/detail", healthDetailHandler(e, opts.Registry), opts.DetailMiddleware...)
+	}
+}
+
+func healthDetailHandler(e *echo.Echo, registry *health.Registry) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		report := registry.Check(c.Request().Context())
+		status := http.StatusOK
+		if !report.Healthy() || IsDraining(e) {
+			status = http.StatusServiceUnavailable
+		}
+		return c.JSON(status, healthDetail{Report: report, Draining: IsDraining(e)})
+	}
+}
+
+type healthDetail struct {
+	*health.Report
+	Draining bool `json:"draining"`
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	requestHostContextKey = "golib.server.request_host"
+	subdomainContextKey   = "golib.server.subdomain"
+)
+
+// hostRegistry holds the host patterns with a separate route tree. Requests are routed by
+// rewriting their Host to the matching pattern before routing, which is how echo selects the
+// router registered with Echo#Host, and restoring it afterwards.
+type hostRegistry struct {
+	mu        sync.RWMutex
+	exact     map[string]struct{}
+	wildcards []string
+}
+
+func getHostRegistry(e *echo.Echo) *hostRegistry {
+	return getServerState(e).hosts
+}
+
+// Host returns a router for requests to the host, with its own route tree and middleware. The
+// pattern is a host name without port, optionally with a leading wildcard label, e.g.
+// *.example.com for tenant subdomains, or a trailing wildcard, e.g. api.* for the api subdomain of
+// any domain. Exact patterns take precedence over wildcards and longer wildcards over shorter
+// ones. Requests matching no pattern are routed to e. The server must be created with
+// NewWithOptions.
+func Host(e *echo.Echo, pattern string, m ...echo.MiddlewareFunc) *echo.Group {
+	pattern = strings.ToLower(pattern)
+	r := getHostRegistry(e)
+	r.mu.Lock()
+	first := len(r.exact) == 0 && len(r.wildcards) == 0
+	if strings.HasPrefix(pattern, "*.") || strings.HasSuffix(pattern, ".*") {
+		r.wildcards = append(r.wildcards, pattern)
+	} else {
+		r.exact[pattern] = struct{}{}
+	}
+	r.mu.Unlock()
+
+	if first {
+		e.Pre(newHostRouter(r))
+	}
+	return e.Host(pattern, m...)
+}
+
+// Subdomain returns the part of the request host matched by the leading wildcard of a Host
+// pattern, e.g. acme for acme.example.com and *.example.com.
+func Subdomain(c echo.Context) string {
+	s, _ := c.Get(subdomainContextKey).(string)
+	return s
+}
+
+func (r *hostRegistry) match(host string) (pattern string, subdomain string, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.exact[host]; ok {
+		return host, "", true
+	}
+	for _, w := range r.wildcards {
+		if len(w) <= len(pattern) {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(w, "*."):
+			if rest, found := strings.CutSuffix(host, w[1:]); found && rest != "" && !strings.Contains(rest, ".") {
+				pattern, subdomain, ok = w, rest, true
+			}
+		case strings.HasSuffix(w, ".*"):
+			if rest, found := strings.CutPrefix(host, w[:len(w)-1]); found && rest != "" {
+				pattern, subdomain, ok = w, "", true
+			}
+		}
+	}
+	return pattern, subdomain, ok
+}
+
+func newHostRouter(r *hostRegistry) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			pattern, subdomain, ok := r.match(strings.ToLower(stripPort(req.Host)))
+			if !ok {
+				return next(c)
+			}
+
+			c.Set(requestHostContextKey, req.Host)
+			if subdomain != "" {
+				c.Set(subdomainContextKey, subdomain)
+			}
+			req.Host = pattern
+			defer func() {
+				req.Host, _ = c.Get(requestHostContextKey).(string)
+			}()
+			return next(c)
+		}
+	}
+}
+
+// newHostRestorer restores the request host rewritten for routing by Host before any other
+// middleware runs.
+func newHostRestorer() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if host, ok := c.Get(requestHostContextKey).(string); ok {
+				c.Request().Host = host
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// HTTP2Options tunes the HTTP/2 server. Zero values use the golang.org/x/net/http2 defaults.
+type HTTP2Options struct {
+	MaxConcurrentStreams         uint32
+	MaxReadFrameSize             uint32
+	MaxDecoderHeaderTableSize    uint32
+	MaxEncoderHeaderTableSize    uint32
+	MaxUploadBufferPerConnection int32
+	MaxUploadBufferPerStream     int32
+	IdleTimeout                  time.Duration
+}
+
+func newHTTP2Server(opts *HTTP2Options) *http2.Server {
+	if opts == nil {
+		return &http2.Server{}
+	}
+
+	return &http2.Server{
+		MaxConcurrentStreams:         opts.MaxConcurrentStreams,
+		MaxReadFrameSize:             opts.MaxReadFrameSize,
+		MaxDecoderHeaderTableSize:    opts.MaxDecoderHeaderTableSize,
+		MaxEncoderHeaderTableSize:    opts.MaxEncoderHeaderTableSize,
+		MaxUploadBufferPerConnection: opts.MaxUploadBufferPerConnection,
+		MaxUploadBufferPerStream:     opts.MaxUploadBufferPerStream,
+		IdleTimeout:                  opts.IdleTimeout,
+	}
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/text/language"
+)
+
+const (
+	localeContextKey  = "golib.server.locale"
+	catalogContextKey = "golib.server.catalog"
+
+	headerContentLanguage = "Content-Language"
+
+	defaultLocaleQueryParam = "lang"
+	defaultLocaleCookieName = "lang"
+)
+
+// Catalog holds translated messages per locale. Lookups fall back from a regional locale to its
+// base language (en-GB -> en) and then to the fallback locale.
+type Catalog struct {
+	mu       sync.RWMutex
+	fallback language.Tag
+	tags     []language.Tag
+	messages map[language.Tag]map[string]string
+	matcher  language.Matcher
+}
+
+func NewCatalog(fallback string) (*Catalog, error) {
+	tag, err := language.Parse(fallback)
+	if err != nil {
+		return nil, err
+	}
+	return &Catalog{fallback: tag, messages: make(map[language.Tag]map[string]string)}, nil
+}
+
+// LoadCatalog loads message files from the root of fsys, e.g. an embed.FS. Files are named after
+// their locale, e.g. en.json or pt-BR.toml. Nested objects are flattened into dot separated keys.
+func LoadCatalog(fsys fs.FS, fallback string) (*Catalog, error) {
+	cat, err := NewCatalog(fallback)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		ext := path.Ext(name)
+		if ext != ".json" && ext != ".toml" {
+			continue
+		}
+
+		bs, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var raw map[string]any
+		if ext == ".json" {
+			err = json.Unmarshal(bs, &raw)
+		} else {
+			err = toml.Unmarshal(bs, &raw)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("catalog file %s: %w", name, err)
+		}
+
+		messages := make(map[string]string)
+		flattenMessages(messages, "", raw)
+		if err := cat.Add(strings.TrimSuffix(name, ext), messages); err != nil {
+			return nil, fmt.Errorf("catalog file %s: %w", name, err)
+		}
+	}
+	return cat, nil
+}
+
+func flattenMessages(messages map[string]string, prefix string, raw map[string]any) {
+	for k, v := range raw {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			flattenMessages(messages, key, v)
+		case string:
+			messages[key] = v
+		default:
+			messages[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+// Add adds messages for the locale, overriding existing messages with the same keys.
+func (cat *Catalog) Add(locale string, messages map[string]string) error {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return err
+	}
+
+	cat.mu.Lock()
+	defer cat.mu.Unlock()
+
+	existing, ok := cat.messages[tag]
+	if !ok {
+		existing = make(map[string]string, len(messages))
+		cat.messages[tag] = existing
+		cat.tags = append(cat.tags, tag)
+		cat.matcher = nil
+	}
+	for k, v := range messages {
+		existing[k] = v
+	}
+	return nil
+}
+
+// Locales returns the locales with messages, starting with the fallback locale.
+func (cat *Catalog) Locales() []string {
+	tags := cat.supported()
+	locales := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		locales = append(locales, tag.String())
+	}
+	return locales
+}
+
+// Match returns the supported locale best matching the given locales in order of preference,
+// or the fallback locale.
+func (cat *Catalog) Match(locales ...string) string {
+	tags := make([]language.Tag, 0, len(locales))
+	for _, l := range locales {
+		if tag, err := language.Parse(l); err == nil {
+			tags = append(tags, tag)
+		}
+	}
+	locale, _ := cat.match(tags...)
+	return locale
+}
+
+func (cat *Catalog) match(tags ...language.Tag) (string, language.Confidence) {
+	supported := cat.supported()
+
+	cat.mu.Lock()
+	if cat.matcher == nil {
+		cat.matcher = language.NewMatcher(supported)
+	}
+	matcher := cat.matcher
+	cat.mu.Unlock()
+
+	_, index, confidence := matcher.Match(tags...)
+	return supported[index].String(), confidence
+}
+
+func (cat *Catalog) supported() []language.Tag {
+	cat.mu.RLock()
+	defer cat.mu.RUnlock()
+
+	tags := []language.Tag{cat.fallback}
+	for _, tag := range cat.tags {
+		if tag != cat.fallback {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Message returns the message for key in the locale, formatted with args using fmt.Sprintf. The
+// key itself is returned if no locale has the message.
+func (cat *Catalog) Message(locale, key string, args ...any) string {
+	msg, ok := cat.lookup(locale, key)
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+func (cat *Catalog) lookup(locale, key string) (string, bool) {
+	cat.mu.RLock()
+	defer cat.mu.RUnlock()
+
+	if tag, err := language.Parse(locale); err == nil {
+		for ; ; tag = tag.Parent() {
+			if msg, ok := cat.messages[tag][key]; ok {
+				return msg, true
+			}
+			if tag.IsRoot() {
+				break
+			}
+		}
+	}
+	msg, ok := cat.messages[cat.fallback][key]
+	return msg, ok
+}
+
+type LocaleOptions struct {
+	Skipper middleware.Skipper
+	Catalog *Catalog
+	// QueryParam is the query parameter that selects the locale explicitly. Defaults to "lang".
+	QueryParam string
+	// CookieName is the cookie that remembers the locale chosen by the user. Defaults to "lang".
+	CookieName string
+}
+
+// Locale returns a middleware negotiating the locale of the request from the query parameter,
+// the cookie and the Accept-Language header, in that order. See GetLocale and T.
+func Locale(catalog *Catalog) echo.MiddlewareFunc {
+	return LocaleWithOptions(LocaleOptions{Catalog: catalog})
+}
+
+func LocaleWithOptions(opts LocaleOptions) echo.MiddlewareFunc {
+	if opts.Catalog == nil {
+		panic("server: locale middleware requires a catalog")
+	}
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.QueryParam == "" {
+		opts.QueryParam = defaultLocaleQueryParam
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = defaultLocaleCookieName
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if opts.Skipper(c) {
+				return next(c)
+			}
+
+			locale := negotiateLocale(c, opts)
+			c.Set(localeContextKey, locale)
+			c.Set(catalogContextKey, opts.Catalog)
+			c.Response().Header().Set(headerContentLanguage, locale)
+			c.Response().Header().Add(echo.HeaderVary, "Accept-Language")
+			return next(c)
+		}
+	}
+}
+
+func negotiateLocale(c echo.Context, opts LocaleOptions) string {
+	explicit := c.QueryParam(opts.QueryParam)
+	if explicit == "" {
+		if cookie, err := c.Cookie(opts.CookieName); err == nil {
+			explicit = cookie.Value
+		}
+	}
+	if explicit != "" {
+		if tag, err := language.Parse(explicit); err == nil {
+			if locale, confidence := opts.Catalog.match(tag); confidence != language.No {
+				return locale
+			}
+		}
+	}
+
+	tags, _, _ := language.ParseAcceptLanguage(c.Request().Header.Get("Accept-Language"))
+	locale, _ := opts.Catalog.match(tags...)
+	return locale
+}
+
+// GetLocale returns the negotiated locale of the request, or an empty string if the locale
+// middleware isn't used.
+func GetLocale(c echo.Context) string {
+	locale, _ := c.Get(localeContextKey).(string)
+	return locale
+}
+
+// T returns the message for key in the locale of the request. See Catalog.Message.
+func T(c echo.Context, key string, args ...any) string {
+	cat, ok := c.Get(catalogContextKey).(*Catalog)
+	if !ok {
+		return key
+	}
+	return cat.Message(GetLocale(c), key, args...)
+}
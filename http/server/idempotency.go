@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	headerIdempotencyKey      = "Idempotency-Key"
+	headerIdempotentReplayed  = "Idempotent-Replayed"
+	defaultIdempotencyTTL     = 24 * time.Hour
+	maxIdempotencyKeyLength   = 255
+	defaultIdempotencyMaxBody = 1 << 20
+)
+
+type IdempotencyOptions struct {
+	Skipper middleware.Skipper
+	// Store defaults to a MemoryIdempotencyStore, which only works for a single instance.
+	Store IdempotencyStore
+	// Header is the request header carrying the key. Defaults to Idempotency-Key.
+	Header string
+	// TTL is how long responses are kept for replay. Defaults to 24h.
+	TTL time.Duration
+	// Methods are the request methods the middleware applies to. Defaults to POST and PATCH.
+	Methods []string
+	// Required rejects requests without a key with a 400 error.
+	Required bool
+	// Scope returns the namespace of the key, so that keys of different callers can't collide.
+	// Defaults to the ID of the authenticated principal, if any.
+	Scope func(c echo.Context) string
+	// MaxBodySize is the largest response that is stored. Larger responses release the key.
+	// Defaults to 1MB.
+	MaxBodySize int
+	// MaxRequestBodySize is the largest request body that is fingerprinted. Larger requests are
+	// rejected with a 413 error. Defaults to 1MB.
+	MaxRequestBodySize int64
+}
+
+// Idempotency returns a middleware that makes retries of mutating requests safe. The response
+// to the first request with a key is stored and replayed for later requests with the same key.
+// Requests arriving while the first one is in flight get a 409 error, requests reusing a key for
+// a different payload a 422 error. Keys are released when the handler fails with an error or a
+// 5xx response so that the request can be retried.
+func Idempotency() echo.MiddlewareFunc {
+	return IdempotencyWithOptions(IdempotencyOptions{})
+}
+
+func IdempotencyWithOptions(opts IdempotencyOptions) echo.MiddlewareFunc {
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryIdempotencyStore()
+	}
+	if opts.Header == "" {
+		opts.Header = headerIdempotencyKey
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = defaultIdempotencyTTL
+	}
+	if len(opts.Methods) == 0 {
+		opts.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if opts.Scope == nil {
+		opts.Scope = func(c echo.Context) string {
+			if p, ok := GetPrincipal(c); ok {
+				return p.ID
+			}
+			return ""
+		}
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultIdempotencyMaxBody
+	}
+	if opts.MaxRequestBodySize <= 0 {
+		opts.MaxRequestBodySize = defaultIdempotencyMaxBody
+	}
+
+	methods := make(map[string]struct{}, len(opts.Methods))
+	for _, m := range opts.Methods {
+		methods[strings.ToUpper(m)] = struct{}{}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if _, ok := methods[req.Method]; !ok || opts.Skipper(c) {
+				return next(c)
+			}
+
+			idempotencyKey := req.Header.Get(opts.Header)
+			if idempotencyKey == "" {
+				if opts.Required {
+					return NewProblem(http.StatusBadRequest, "missing "+opts.Header+" header")
+				}
+				return next(c)
+			}
+			if len(idempotencyKey) > maxIdempotencyKeyLength {
+				return NewProblem(http.StatusBadRequest, opts.Header+" header is too long")
+			}
+
+			fingerprint, err := requestFingerprint(req, opts.MaxRequestBodySize)
+			if err != nil {
+				return err
+			}
+
+			ctx := req.Context()
+			key := opts.Scope(c) + "|" + req.Method + "|" + req.URL.Path + "|" + idempotencyKey
+			existing, err := opts.Store.Start(ctx, key, &IdempotencyRecord{Fingerprint: fingerprint}, opts.TTL)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				switch {
+				case existing.Fingerprint != fingerprint:
+					return NewProblem(http.StatusUnprocessableEntity, opts.Header+" was already used for a different request")
+				case existing.Response == nil:
+					return NewProblem(http.StatusConflict, "a request with the same "+opts.Header+" is in progress")
+				}
+				c.Response().Header().Set(headerIdempotentReplayed, "true")
+				return writeStoredResponse(c, existing.Response)
+			}
+
+			abort := func() {
+				if aerr := opts.Store.Abort(ctx, key); aerr != nil {
+					c.Logger().Errorf("idempotency: %v", aerr)
+				}
+			}
+
+			res := c.Response()
+			crw := &cacheResponseWriter{ResponseWriter: res.Writer, max: opts.MaxBodySize}
+			res.Writer = crw
+			defer func() {
+				// Release the key of a panicking handler so that the request can be retried.
+				if r := recover(); r != nil {
+					res.Writer = crw.ResponseWriter
+					abort()
+					panic(r)
+				}
+			}()
+			err = next(c)
+			res.Writer = crw.ResponseWriter
+
+			if err != nil || crw.code == 0 || crw.code >= http.StatusInternalServerError || crw.overflow {
+				abort()
+				return err
+			}
+
+			record := &IdempotencyRecord{
+				Fingerprint: fingerprint,
+				Response:    &CachedResponse{Status: crw.code, Header: cachedHeader(res.Header()), Body: crw.buf, StoredAt: time.Now()},
+			}
+			if ferr := opts.Store.Finish(ctx, key, record, opts.TTL); ferr != nil {
+				c.Logger().Errorf("idempotency: %v", ferr)
+			}
+			return nil
+		}
+	}
+}
+
+// requestFingerprint hashes the request body and restores it for the handler. Bodies larger than
+// max are rejected.
+func requestFingerprint(req *http.Request, max int64) (string, error) {
+	h := sha256.New()
+	if req.Body != nil {
+		bs, err := io.ReadAll(io.LimitReader(req.Body, max+1))
+		if err != nil {
+			return "", NewHttpErrorWithInternal(http.StatusBadRequest, "failed to read request body", err)
+		}
+		if int64(len(bs)) > max {
+			return "", NewProblem(http.StatusRequestEntityTooLarge, "request body is too large")
+		}
+		req.Body = io.NopCloser(bytes.NewReader(bs))
+		h.Write(bs)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisIdempotencyPrefix = "idempotency:"
+)
+
+// IdempotencyRecord is the state of an idempotency key. Response is nil while the first request
+// with the key is in flight.
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request the key was first used with.
+	Fingerprint string          `json:"fingerprint"`
+	Response    *CachedResponse `json:"response,omitempty"`
+}
+
+// IdempotencyStore stores idempotency records.
+type IdempotencyStore interface {
+	// Start atomically stores the in-flight record under key unless the key is already in use,
+	// in which case the existing record is returned.
+	Start(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error)
+	// Finish stores the completed record.
+	Finish(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error
+	// Abort removes the record so that the request can be retried.
+	Abort(ctx context.Context, key string) error
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore keeping records in memory.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[string]memoryIdempotencyRecord
+	lastSweep time.Time
+}
+
+type memoryIdempotencyRecord struct {
+	record    *IdempotencyRecord
+	expiresAt time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]memoryIdempotencyRecord), lastSweep: time.Now()}
+}
+
+func (s *MemoryIdempotencyStore) Start(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := s.records[key]; ok && now.Before(existing.expiresAt) {
+		return existing.record, nil
+	}
+	s.records[key] = memoryIdempotencyRecord{record: record, expiresAt: now.Add(ttl)}
+
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, r := range s.records {
+			if now.After(r.expiresAt) {
+				delete(s.records, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Finish(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[key] = memoryIdempotencyRecord{record: record, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Abort(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+type redisIdempotencyStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisIdempotencyStore returns an IdempotencyStore keeping records in Redis under keys with
+// the given prefix. The prefix defaults to "idempotency:".
+func NewRedisIdempotencyStore(client redis.UniversalClient, prefix string) IdempotencyStore {
+	if prefix == "" {
+		prefix = defaultRedisIdempotencyPrefix
+	}
+	return &redisIdempotencyStore{client: client, prefix: prefix}
+}
+
+func (s *redisIdempotencyStore) Start(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.client.SetNX(ctx, s.prefix+key, data, ttl).Result()
+	if err != nil || ok {
+		return nil, err
+	}
+
+	existing, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// The record expired or was aborted in the meantime.
+		return s.Start(ctx, key, record, ttl)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var r IdempotencyRecord
+	if err := json.Unmarshal(existing, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *redisIdempotencyStore) Finish(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.prefix+key, data, ttl).Err()
+}
+
+func (s *redisIdempotencyStore) Abort(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
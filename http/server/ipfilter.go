@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// IPRangeProvider provides IP ranges dynamically, e.g. from a database or a config service.
+type IPRangeProvider interface {
+	IPRanges(ctx context.Context) ([]netip.Prefix, error)
+}
+
+type IPRangeProviderFunc func(ctx context.Context) ([]netip.Prefix, error)
+
+func (f IPRangeProviderFunc) IPRanges(ctx context.Context) ([]netip.Prefix, error) {
+	return f(ctx)
+}
+
+// IPFilterOptions configures the IP filter. The client IP is the direct peer's address unless an
+// IP extractor is configured with Options.TrustedProxies, since forwarded headers of untrusted
+// peers can be spoofed.
+type IPFilterOptions struct {
+	Skipper middleware.Skipper
+	// Allow is a list of IPs or CIDR ranges allowed to access the server. If Allow and
+	// AllowProvider are both empty, all IPs not denied are allowed.
+	Allow         []string
+	AllowProvider IPRangeProvider
+	// Deny is a list of IPs or CIDR ranges denied access. Deny takes precedence over Allow.
+	Deny         []string
+	DenyProvider IPRangeProvider
+}
+
+// IPFilter returns a middleware that only allows requests from the given IPs or CIDR ranges.
+func IPFilter(allow ...string) echo.MiddlewareFunc {
+	return IPFilterWithOptions(IPFilterOptions{Allow: allow})
+}
+
+// IPFilterWithOptions returns an IP filter middleware. It panics if a range is invalid.
+func IPFilterWithOptions(opts IPFilterOptions) echo.MiddlewareFunc {
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	allow := mustParseIPRanges(opts.Allow)
+	deny := mustParseIPRanges(opts.Deny)
+	restricted := len(allow) > 0 || opts.AllowProvider != nil
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if opts.Skipper(c) {
+				return next(c)
+			}
+
+			ip, err := netip.ParseAddr(trustedClientIP(c))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusForbidden, "forbidden")
+			}
+			ip = ip.Unmap()
+
+			ctx := c.Request().Context()
+			denied, err := ipInRanges(ctx, ip, deny, opts.DenyProvider)
+			if err != nil {
+				return NewHttpErrorWithInternal(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), err)
+			}
+			if denied {
+				return echo.NewHTTPError(http.StatusForbidden, "forbidden")
+			}
+
+			if restricted {
+				allowed, err := ipInRanges(ctx, ip, allow, opts.AllowProvider)
+				if err != nil {
+					return NewHttpErrorWithInternal(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), err)
+				}
+				if !allowed {
+					return echo.NewHTTPError(http.StatusForbidden, "forbidden")
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// trustedClientIP returns the client IP extracted by the configured IP extractor, or the address
+// of the direct peer if there is none. Unlike echo.Context.RealIP, it never trusts forwarded
+// headers by default.
+func trustedClientIP(c echo.Context) string {
+	if extract := c.Echo().IPExtractor; extract != nil {
+		return extract(c.Request())
+	}
+	return echo.ExtractIPDirect()(c.Request())
+}
+
+func ipInRanges(ctx context.Context, ip netip.Addr, ranges []netip.Prefix, provider IPRangeProvider) (bool, error) {
+	for _, r := range ranges {
+		if r.Contains(ip) {
+			return true, nil
+		}
+	}
+	if provider == nil {
+		return false, nil
+	}
+
+	dynamic, err := provider.IPRanges(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range dynamic {
+		if r.Contains(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ParseIPRanges parses a list of IPs or CIDR ranges. Plain IPs are converted to single address
+// ranges.
+func ParseIPRanges(ranges []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(ranges))
+	for _, r := range ranges {
+		r = strings.TrimSpace(r)
+		if strings.Contains(r, "/") {
+			prefix, err := netip.ParsePrefix(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ip range %q: %w", r, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		ip, err := netip.ParseAddr(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip %q: %w", r, err)
+		}
+		ip = ip.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func mustParseIPRanges(ranges []string) []netip.Prefix {
+	prefixes, err := ParseIPRanges(ranges)
+	if err != nil {
+		panic("server: " + err.Error())
+	}
+	return prefixes
+}
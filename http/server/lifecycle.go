@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultHookTimeout = 15 * time.Second
+)
+
+// Hook is a component's startup and shutdown callbacks. Either callback may be nil.
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+	// Timeout bounds each callback. Defaults to 15s.
+	Timeout time.Duration
+}
+
+// Lifecycle is a registry of hooks run by StartWithOptions. Start hooks run in registration
+// order before the server starts listening; stop hooks run in reverse order after the server has
+// shut down.
+type Lifecycle struct {
+	mu                sync.Mutex
+	hooks             []Hook
+	onShutdownTimeout []func()
+}
+
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{}
+}
+
+func (l *Lifecycle) Append(h Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, h)
+}
+
+func (l *Lifecycle) OnStart(name string, fn func(ctx context.Context) error) {
+	l.Append(Hook{Name: name, OnStart: fn})
+}
+
+func (l *Lifecycle) OnStop(name string, fn func(ctx context.Context) error) {
+	l.Append(Hook{Name: name, OnStop: fn})
+}
+
+// OnShutdownTimeout registers a function called when the graceful shutdown doesn't complete
+// within StartOptions.GracefulShutdownTimeout.
+func (l *Lifecycle) OnShutdownTimeout(fn func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onShutdownTimeout = append(l.onShutdownTimeout, fn)
+}
+
+func (l *Lifecycle) snapshot() ([]Hook, []func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Hook(nil), l.hooks...), append([]func(){}, l.onShutdownTimeout...)
+}
+
+// start runs the start hooks in order. If a hook fails, the stop hooks of the hooks started so
+// far are run and the error is returned.
+func (l *Lifecycle) start(ctx context.Context, logger echo.Logger) (started int, err error) {
+	hooks, _ := l.snapshot()
+	for i, h := range hooks {
+		if h.OnStart != nil {
+			logger.Infof("starting %s", hookName(h, i))
+			if err := runHook(ctx, h, h.OnStart); err != nil {
+				logger.Errorf("starting %s failed: %v", hookName(h, i), err)
+				l.stop(ctx, logger, i)
+				return i, fmt.Errorf("start hook %s: %w", hookName(h, i), err)
+			}
+		}
+	}
+	return len(hooks), nil
+}
+
+// stop runs the stop hooks of the first n hooks in reverse order. Errors are logged and don't
+// prevent the remaining hooks from running.
+func (l *Lifecycle) stop(ctx context.Context, logger echo.Logger, n int) {
+	hooks, _ := l.snapshot()
+	for i := min(n, len(hooks)) - 1; i >= 0; i-- {
+		h := hooks[i]
+		if h.OnStop != nil {
+			logger.Infof("stopping %s", hookName(h, i))
+			if err := runHook(ctx, h, h.OnStop); err != nil {
+				logger.Errorf("stopping %s failed: %v", hookName(h, i), err)
+			}
+		}
+	}
+}
+
+func (l *Lifecycle) shutdownTimedOut() {
+	_, fns := l.snapshot()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+func runHook(ctx context.Context, h Hook, fn func(ctx context.Context) error) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- fn(ctx)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func hookName(h Hook, i int) string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return fmt.Sprintf("hook %d", i)
+}
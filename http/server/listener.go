@@ -0,0 +1,183 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	// systemdListenFDsStart is the first file descriptor passed by systemd socket activation.
+	systemdListenFDsStart = 3
+)
+
+// SystemdListeners returns the listeners passed by systemd socket activation, in the order of the
+// sockets in the socket unit, or nil if the process wasn't socket activated. The LISTEN_*
+// environment variables are unset so that child processes don't inherit them.
+func SystemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("LISTEN_FD_%d", systemdListenFDsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(systemdListenFDsStart+i), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("systemd socket %s: %w", name, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// listenUnix listens on a Unix socket, removing a stale socket file left by a previous run.
+func listenUnix(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+// setupListener sets the listener echo serves on according to opts. Without a listener, socket
+// activation or Unix socket, echo listens on the TCP port itself.
+func setupListener(e *echo.Echo, opts *StartOptions, tlsConfig *tls.Config) error {
+	l := opts.Listener
+	if l == nil && opts.SocketActivation {
+		listeners, err := SystemdListeners()
+		if err != nil {
+			return err
+		}
+		if len(listeners) > 1 {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return fmt.Errorf("%d systemd sockets passed, serve them with SystemdListeners", len(listeners))
+		}
+		if len(listeners) == 1 {
+			l = listeners[0]
+		}
+	}
+	if l == nil && opts.UnixSocketPath != "" {
+		var err error
+		if l, err = listenUnix(opts.UnixSocketPath); err != nil {
+			return err
+		}
+	}
+	if l == nil {
+		return nil
+	}
+
+	if tlsConfig != nil {
+		e.TLSListener = tls.NewListener(l, tlsConfig)
+	} else {
+		e.Listener = l
+	}
+	return nil
+}
+
+// ListenerOptions configures an additional listener the server is served on. Exactly one of
+// Addr, UnixSocketPath and Listener must be set.
+type ListenerOptions struct {
+	// Addr is the TCP address, e.g. ":8443".
+	Addr           string
+	UnixSocketPath string
+	Listener       net.Listener
+	// TLS serves https on the listener. RedirectHttp and HttpPort are ignored, use the main
+	// listener for redirects.
+	TLS *TLSOptions
+	// H2C serves HTTP/2 over cleartext connections. It is ignored when TLS is set.
+	H2C bool
+}
+
+type extraServer struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+// newExtraServers listens on the additional listeners. Listeners are opened before the server
+// starts so that an unavailable address fails the start instead of the running server.
+func newExtraServers(e *echo.Echo, opts *StartOptions) ([]*extraServer, error) {
+	servers := make([]*extraServer, 0, len(opts.Listeners))
+	closeAll := func() {
+		for _, s := range servers {
+			s.listener.Close()
+		}
+	}
+
+	for _, lo := range opts.Listeners {
+		var handler http.Handler = e
+		if opts.GRPC != nil {
+			handler = newGRPCMux(opts.GRPC, e)
+		}
+		s := &http.Server{Handler: handler, ErrorLog: e.StdLogger, ReadHeaderTimeout: 10 * time.Second}
+		if lo.TLS != nil {
+			tlsConfig, _, err := newTLSConfig(lo.TLS, 0)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			s.TLSConfig = tlsConfig
+			if !e.DisableHTTP2 {
+				if err := http2.ConfigureServer(s, newHTTP2Server(opts.HTTP2)); err != nil {
+					closeAll()
+					return nil, err
+				}
+			}
+		} else if lo.H2C || opts.GRPC != nil {
+			s.Handler = h2c.NewHandler(handler, newHTTP2Server(opts.HTTP2))
+		}
+
+		l, err := listenExtra(&lo)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		if s.TLSConfig != nil {
+			l = tls.NewListener(l, s.TLSConfig)
+		}
+		servers = append(servers, &extraServer{server: s, listener: l})
+	}
+	return servers, nil
+}
+
+func listenExtra(lo *ListenerOptions) (net.Listener, error) {
+	switch {
+	case lo.Listener != nil:
+		return lo.Listener, nil
+	case lo.UnixSocketPath != "":
+		return listenUnix(lo.UnixSocketPath)
+	case lo.Addr != "":
+		return net.Listen("tcp", lo.Addr)
+	default:
+		return nil, errors.New("listener requires an address, a unix socket path or a listener")
+	}
+}
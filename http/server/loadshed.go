@@ -0,0 +1,178 @@
+package server
+
+import (
+	"expvar"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	defaultLoadShedQueueTarget   = 5 * time.Millisecond
+	defaultLoadShedQueueInterval = 100 * time.Millisecond
+	defaultLoadShedRetryAfter    = time.Second
+)
+
+type LoadShedOptions struct {
+	Skipper middleware.Skipper
+	// MaxConcurrent is the maximum number of requests handled concurrently.
+	MaxConcurrent int
+	// MaxQueue is the maximum number of requests waiting for a slot. Requests arriving at a full
+	// queue are shed immediately. Defaults to MaxConcurrent.
+	MaxQueue int
+	// QueueTarget and QueueInterval control how long requests wait for a slot, following CoDel:
+	// while the queue has drained within the last QueueInterval requests wait up to
+	// QueueInterval, otherwise the server is considered overloaded and requests only wait up to
+	// QueueTarget. Default to 5ms and 100ms.
+	QueueTarget   time.Duration
+	QueueInterval time.Duration
+	// RetryAfter is sent in the Retry-After header of shed requests. Defaults to 1s.
+	RetryAfter time.Duration
+	// MetricsName, if set, publishes the shedder's stats with expvar under the name, which makes
+	// them available on the admin listener. Names must be unique.
+	MetricsName string
+}
+
+// LoadShedStats are the counters of a LoadShedder.
+type LoadShedStats struct {
+	InFlight int64 `json:"in_flight"`
+	Queued   int64 `json:"queued"`
+	Admitted int64 `json:"admitted"`
+	Shed     int64 `json:"shed"`
+}
+
+// LoadShedder limits the number of concurrent requests and sheds requests with a 503 error
+// when they can't be handled soon, instead of letting every request time out under overload.
+type LoadShedder struct {
+	opts      LoadShedOptions
+	slots     chan struct{}
+	inFlight  atomic.Int64
+	queued    atomic.Int64
+	admitted  atomic.Int64
+	shed      atomic.Int64
+	mu        sync.Mutex
+	lastEmpty time.Time
+}
+
+// NewLoadShedder returns a LoadShedder. It panics if MaxConcurrent isn't positive.
+func NewLoadShedder(opts LoadShedOptions) *LoadShedder {
+	if opts.MaxConcurrent <= 0 {
+		panic("server: load shedder requires a positive max concurrency")
+	}
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.MaxQueue <= 0 {
+		opts.MaxQueue = opts.MaxConcurrent
+	}
+	if opts.QueueTarget <= 0 {
+		opts.QueueTarget = defaultLoadShedQueueTarget
+	}
+	if opts.QueueInterval <= 0 {
+		opts.QueueInterval = defaultLoadShedQueueInterval
+	}
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = defaultLoadShedRetryAfter
+	}
+
+	ls := &LoadShedder{opts: opts, slots: make(chan struct{}, opts.MaxConcurrent), lastEmpty: time.Now()}
+	if opts.MetricsName != "" {
+		expvar.Publish(opts.MetricsName, expvar.Func(func() any { return ls.Stats() }))
+	}
+	return ls
+}
+
+// LoadShed returns a load shedding middleware. See LoadShedder.
+func LoadShed(opts LoadShedOptions) echo.MiddlewareFunc {
+	return NewLoadShedder(opts).Middleware()
+}
+
+func (ls *LoadShedder) Stats() LoadShedStats {
+	return LoadShedStats{
+		InFlight: ls.inFlight.Load(),
+		Queued:   ls.queued.Load(),
+		Admitted: ls.admitted.Load(),
+		Shed:     ls.shed.Load(),
+	}
+}
+
+func (ls *LoadShedder) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if ls.opts.Skipper(c) {
+				return next(c)
+			}
+
+			start := time.Now()
+			if !ls.acquire(c) {
+				ls.shed.Add(1)
+				c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(int(ls.opts.RetryAfter.Seconds()+0.5)))
+				return NewProblem(http.StatusServiceUnavailable, "server is overloaded")
+			}
+			defer ls.release()
+
+			ls.admitted.Add(1)
+			c.Set(queueDelayContextKey, time.Since(start))
+			return next(c)
+		}
+	}
+}
+
+func (ls *LoadShedder) acquire(c echo.Context) bool {
+	select {
+	case ls.slots <- struct{}{}:
+		ls.markEmpty()
+		ls.inFlight.Add(1)
+		return true
+	default:
+	}
+
+	if ls.queued.Add(1) > int64(ls.opts.MaxQueue) {
+		ls.queued.Add(-1)
+		return false
+	}
+	defer ls.queued.Add(-1)
+
+	timer := time.NewTimer(ls.queueTimeout())
+	defer timer.Stop()
+	select {
+	case ls.slots <- struct{}{}:
+		ls.inFlight.Add(1)
+		return true
+	case <-timer.C:
+		return false
+	case <-c.Request().Context().Done():
+		return false
+	}
+}
+
+func (ls *LoadShedder) release() {
+	ls.inFlight.Add(-1)
+	<-ls.slots
+	if ls.queued.Load() == 0 {
+		ls.markEmpty()
+	}
+}
+
+func (ls *LoadShedder) markEmpty() {
+	ls.mu.Lock()
+	ls.lastEmpty = time.Now()
+	ls.mu.Unlock()
+}
+
+// queueTimeout returns how long a request may wait for a slot. Once the queue hasn't drained for
+// a whole interval, the shedder switches to the short target timeout.
+func (ls *LoadShedder) queueTimeout() time.Duration {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if time.Since(ls.lastEmpty) > ls.opts.QueueInterval {
+		return ls.opts.QueueTarget
+	}
+	return ls.opts.QueueInterval
+}
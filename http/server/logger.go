@@ -4,35 +4,41 @@ import (
 	"fmt"
 	"io"
 
+	golog "github.com/gpahal/golib/log"
 	"github.com/labstack/gommon/log"
 	"github.com/rs/zerolog"
 )
 
-func newLogger(w io.Writer) *zerolog.Logger {
-	loggerStruct := zerolog.New(
-		zerolog.ConsoleWriter{
-			Out:         w,
-			TimeFormat:  "02 Jan 06 15:04:05 MST",
-			FieldsOrder: []string{"status", "method", "uri", "error", "request_id", "latency", "size"},
-		},
-	).
-		With().
-		Timestamp().
-		Logger()
-	return &loggerStruct
+// LogFormat is the format of the server logs.
+type LogFormat = golog.Format
+
+const (
+	// LogFormatAuto uses LogFormatJSON when Options.Production is set and LogFormatConsole
+	// otherwise.
+	LogFormatAuto = golog.FormatAuto
+	// LogFormatConsole writes human readable, colored lines for local development.
+	LogFormatConsole = golog.FormatConsole
+	// LogFormatJSON writes one JSON object per line for log aggregation in production.
+	LogFormatJSON = golog.FormatJSON
+)
+
+func newLogger(w io.Writer, format LogFormat) *zerolog.Logger {
+	return golog.NewWithOptions(golog.Options{Writer: w, Format: format, Level: zerolog.TraceLevel.String()})
 }
 
 type gommonLogger struct {
 	logger *zerolog.Logger
 	w      io.Writer
+	format LogFormat
 	level  log.Lvl
 	prefix string
 }
 
-func newGommonLogger(logger *zerolog.Logger, loggerWriter io.Writer) *gommonLogger {
+func newGommonLogger(logger *zerolog.Logger, loggerWriter io.Writer, format LogFormat) *gommonLogger {
 	return &gommonLogger{
 		logger: logger,
 		w:      loggerWriter,
+		format: format,
 		level:  getGommonLevel(logger.GetLevel()),
 	}
 }
@@ -43,7 +49,7 @@ func (l gommonLogger) Output() io.Writer {
 
 func (l *gommonLogger) SetOutput(w io.Writer) {
 	l.w = w
-	newLogger := l.logger.Output(w)
+	newLogger := l.logger.Output(golog.NewWriter(w, l.format))
 	l.logger = &newLogger
 }
 
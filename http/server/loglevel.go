@@ -0,0 +1,167 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+// LogLevelStatus describes the current log level of a server.
+type LogLevelStatus struct {
+	Level string `json:"level"`
+	// Base is the level of the logger the server was created with, which is restored after a
+	// temporary change.
+	Base string `json:"base"`
+	// RevertAt is when a temporary change is reverted, or nil if the level isn't temporary.
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// logLevelController holds the server logger at a level that can be changed at runtime. Changing
+// the level swaps the logger, so disabled events are skipped before they are built. Request
+// loggers are derived from the current logger when a request starts.
+type logLevelController struct {
+	logger atomic.Pointer[zerolog.Logger]
+	level  atomic.Int32
+	base   zerolog.Logger
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	revertAt time.Time
+}
+
+func newLogLevelController(base zerolog.Logger) *logLevelController {
+	l := &logLevelController{base: base}
+	l.logger.Store(&base)
+	l.level.Store(int32(base.GetLevel()))
+	return l
+}
+
+// Logger returns the server logger at the current level.
+func (l *logLevelController) Logger() *zerolog.Logger {
+	return l.logger.Load()
+}
+
+func (l *logLevelController) set(level zerolog.Level, duration time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.revertAt = time.Time{}
+	logger := l.base.Level(level)
+	l.logger.Store(&logger)
+	l.level.Store(int32(level))
+	if duration > 0 && level != l.base.GetLevel() {
+		l.revertAt = time.Now().Add(duration)
+		l.timer = time.AfterFunc(duration, func() {
+			l.set(l.base.GetLevel(), 0)
+		})
+	}
+}
+
+func (l *logLevelController) status() LogLevelStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := LogLevelStatus{Level: zerolog.Level(l.level.Load()).String(), Base: l.base.GetLevel().String()}
+	if !l.revertAt.IsZero() {
+		revertAt := l.revertAt
+		s.RevertAt = &revertAt
+	}
+	return s
+}
+
+func getLogLevelController(e *echo.Echo) (*logLevelController, error) {
+	state := getServerState(e)
+	state.mu.Lock()
+	l := state.logLevels
+	state.mu.Unlock()
+	if l == nil {
+		return nil, errors.New("server: log level requires a server created with NewWithOptions")
+	}
+	return l, nil
+}
+
+// SetLogLevel changes the log level of the server, e.g. to debug while investigating an issue. If
+// duration is positive, the level reverts to the level of the logger the server was created with
+// once it elapses.
+func SetLogLevel(e *echo.Echo, level zerolog.Level, duration time.Duration) error {
+	l, err := getLogLevelController(e)
+	if err != nil {
+		return err
+	}
+	l.set(level, duration)
+	return nil
+}
+
+// ResetLogLevel restores the level of the logger the server was created with.
+func ResetLogLevel(e *echo.Echo) error {
+	l, err := getLogLevelController(e)
+	if err != nil {
+		return err
+	}
+	l.set(l.base.GetLevel(), 0)
+	return nil
+}
+
+// GetLogLevel returns the current log level of the server.
+func GetLogLevel(e *echo.Echo) (LogLevelStatus, error) {
+	l, err := getLogLevelController(e)
+	if err != nil {
+		return LogLevelStatus{}, err
+	}
+	return l.status(), nil
+}
+
+type logLevelRequest struct {
+	Level string `json:"level" query:"level" form:"level"`
+	// Duration is a Go duration, e.g. 10m. An empty duration changes the level permanently.
+	Duration string `json:"duration" query:"duration" form:"duration"`
+}
+
+// registerLogLevelRoutes registers GET /debug/loglevel, returning the LogLevelStatus of e, PUT
+// /debug/loglevel, changing it, and DELETE /debug/loglevel, resetting it, on the admin server.
+func registerLogLevelRoutes(admin *echo.Echo, e *echo.Echo) {
+	admin.GET("/debug/loglevel", func(c echo.Context) error {
+		s, err := GetLogLevel(e)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return c.JSON(http.StatusOK, s)
+	})
+	admin.PUT("/debug/loglevel", func(c echo.Context) error {
+		var r logLevelRequest
+		if err := c.Bind(&r); err != nil {
+			return err
+		}
+		level, err := zerolog.ParseLevel(r.Level)
+		if err != nil || r.Level == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid level")
+		}
+		var duration time.Duration
+		if r.Duration != "" {
+			if duration, err = time.ParseDuration(r.Duration); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid duration")
+			}
+		}
+		if err := SetLogLevel(e, level, duration); err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		s, _ := GetLogLevel(e)
+		return c.JSON(http.StatusOK, s)
+	})
+	admin.DELETE("/debug/loglevel", func(c echo.Context) error {
+		if err := ResetLogLevel(e); err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		s, _ := GetLogLevel(e)
+		return c.JSON(http.StatusOK, s)
+	})
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	headerHTTPMethodOverride = "X-HTTP-Method-Override"
+	methodOverrideFormField  = "_method"
+)
+
+type MethodOverrideOptions struct {
+	Skipper middleware.Skipper
+	// Header is the request header carrying the method. Defaults to X-HTTP-Method-Override.
+	Header string
+	// FormField is the form field carrying the method, used when the header is missing. It is
+	// read from URL encoded bodies and the query string. Multipart bodies aren't parsed, so that
+	// uploads can still be streamed, and must put it in the query string. Defaults to _method.
+	FormField string
+	// Methods are the methods a request can be overridden to. Defaults to PUT, PATCH and DELETE.
+	Methods []string
+}
+
+// MethodOverride returns a middleware that lets POST requests from HTML forms and clients behind
+// restrictive proxies be handled as another method, read from the X-HTTP-Method-Override header
+// or the _method form field. It must be registered with Echo#Pre so that it runs before routing.
+// See Options.MethodOverride.
+func MethodOverride() echo.MiddlewareFunc {
+	return MethodOverrideWithOptions(MethodOverrideOptions{})
+}
+
+func MethodOverrideWithOptions(opts MethodOverrideOptions) echo.MiddlewareFunc {
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.Header == "" {
+		opts.Header = headerHTTPMethodOverride
+	}
+	if opts.FormField == "" {
+		opts.FormField = methodOverrideFormField
+	}
+	if len(opts.Methods) == 0 {
+		opts.Methods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+
+	methods := make(map[string]struct{}, len(opts.Methods))
+	for _, m := range opts.Methods {
+		methods[strings.ToUpper(m)] = struct{}{}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Method != http.MethodPost || opts.Skipper(c) {
+				return next(c)
+			}
+
+			method := req.Header.Get(opts.Header)
+			if method == "" {
+				if strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEApplicationForm) {
+					method = c.FormValue(opts.FormField)
+				} else {
+					method = c.QueryParam(opts.FormField)
+				}
+			}
+			method = strings.ToUpper(method)
+			if _, ok := methods[method]; ok {
+				req.Method = method
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"expvar"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	queueDelayContextKey = "golib.server.queue_delay"
+
+	defaultMetricsName = "http_requests"
+)
+
+var (
+	// DefaultMetricsBuckets are the upper bounds of the request duration histogram buckets used
+	// when RequestMetricsOptions.Buckets is not set.
+	DefaultMetricsBuckets = []time.Duration{
+		5 * time.Millisecond,
+		10 * time.Millisecond,
+		25 * time.Millisecond,
+		50 * time.Millisecond,
+		100 * time.Millisecond,
+		250 * time.Millisecond,
+		500 * time.Millisecond,
+		time.Second,
+		2500 * time.Millisecond,
+		5 * time.Second,
+		10 * time.Second,
+	}
+
+	expvarMetricsRecorders sync.Map // map[string]*ExpvarMetricsRecorder
+)
+
+// RequestMetrics are the metrics of a completed request.
+type RequestMetrics struct {
+	Method string
+	// Route is the route template, e.g. /users/:id, which keeps the number of label values
+	// bounded.
+	Route  string
+	Status int
+	// TenantID is the ID of the tenant resolved by the tenancy middleware, if any.
+	TenantID     string
+	RequestSize  int64
+	ResponseSize int64
+	// TimeToFirstByte is the time until the response header was written, or zero if the handler
+	// wrote no response.
+	TimeToFirstByte time.Duration
+	// Duration is the total handler time.
+	Duration time.Duration
+	// QueueDelay is the time the request waited for a slot of the load shedder.
+	QueueDelay time.Duration
+}
+
+// MetricsRecorder records request metrics, e.g. in Prometheus collectors.
+type MetricsRecorder interface {
+	RecordRequest(m *RequestMetrics)
+}
+
+type MetricsRecorderFunc func(m *RequestMetrics)
+
+func (mrf MetricsRecorderFunc) RecordRequest(m *RequestMetrics) {
+	mrf(m)
+}
+
+type RequestMetricsOptions struct {
+	Skipper middleware.Skipper
+	// Recorder records the metrics. Defaults to an ExpvarMetricsRecorder published under Name.
+	Recorder MetricsRecorder
+	// Name is the expvar name of the default recorder. Defaults to http_requests.
+	Name string
+	// Buckets are the upper bounds of the duration histogram of the default recorder. Defaults
+	// to DefaultMetricsBuckets.
+	Buckets []time.Duration
+}
+
+// newRequestMetrics records the sizes and timings of every request. See Options.Metrics.
+func newRequestMetrics(opts RequestMetricsOptions) echo.MiddlewareFunc {
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.Recorder == nil {
+		if opts.Name == "" {
+			opts.Name = defaultMetricsName
+		}
+		opts.Recorder = NewExpvarMetricsRecorder(opts.Name, opts.Buckets)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if opts.Skipper(c) {
+				return next(c)
+			}
+
+			start := time.Now()
+			var firstByte time.Time
+			res := c.Response()
+			res.Before(func() {
+				firstByte = time.Now()
+			})
+			req := c.Request()
+			var body *countingReadCloser
+			if req.Body != nil {
+				body = &countingReadCloser{ReadCloser: req.Body}
+				req.Body = body
+			}
+
+			err := next(c)
+
+			m := &RequestMetrics{
+				Method:       req.Method,
+				Route:        c.Path(),
+				Status:       responseStatus(c, err),
+				ResponseSize: res.Size,
+				Duration:     time.Since(start),
+			}
+			if body != nil {
+				m.RequestSize = body.n
+			}
+			if !firstByte.IsZero() {
+				m.TimeToFirstByte = firstByte.Sub(start)
+			}
+			if d, ok := c.Get(queueDelayContextKey).(time.Duration); ok {
+				m.QueueDelay = d
+			}
+			if t, ok := GetTenant(c); ok {
+				m.TenantID = t.ID
+			}
+			opts.Recorder.RecordRequest(m)
+			return err
+		}
+	}
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// ExpvarMetricsRecorder aggregates request metrics per method and route and publishes them with
+// expvar, which makes them available on the admin listener.
+type ExpvarMetricsRecorder struct {
+	buckets []time.Duration
+	routes  sync.Map // map[string]*routeMetrics
+}
+
+type routeMetrics struct {
+	requests          atomic.Int64
+	serverErrors      atomic.Int64
+	requestBytes      atomic.Int64
+	responseBytes     atomic.Int64
+	timeToFirstByteNs atomic.Int64
+	durationNs        atomic.Int64
+	queueDelayNs      atomic.Int64
+	durationBuckets   []atomic.Int64
+}
+
+// NewExpvarMetricsRecorder returns the recorder published under name, creating and publishing it
+// if needed.
+func NewExpvarMetricsRecorder(name string, buckets []time.Duration) *ExpvarMetricsRecorder {
+	if len(buckets) == 0 {
+		buckets = DefaultMetricsBuckets
+	}
+	r := &ExpvarMetricsRecorder{buckets: buckets}
+	if existing, loaded := expvarMetricsRecorders.LoadOrStore(name, r); loaded {
+		return existing.(*ExpvarMetricsRecorder)
+	}
+	expvar.Publish(name, expvar.Func(func() any { return r.snapshot() }))
+	return r
+}
+
+func (r *ExpvarMetricsRecorder) RecordRequest(m *RequestMetrics) {
+	key := m.Method + " " + m.Route
+	v, ok := r.routes.Load(key)
+	if !ok {
+		v, _ = r.routes.LoadOrStore(key, &routeMetrics{durationBuckets: make([]atomic.Int64, len(r.buckets)+1)})
+	}
+	rm := v.(*routeMetrics)
+
+	rm.requests.Add(1)
+	if m.Status >= 500 {
+		rm.serverErrors.Add(1)
+	}
+	rm.requestBytes.Add(m.RequestSize)
+	rm.responseBytes.Add(m.ResponseSize)
+	rm.timeToFirstByteNs.Add(int64(m.TimeToFirstByte))
+	rm.durationNs.Add(int64(m.Duration))
+	rm.queueDelayNs.Add(int64(m.QueueDelay))
+
+	i := 0
+	for i < len(r.buckets) && m.Duration > r.buckets[i] {
+		i++
+	}
+	rm.durationBuckets[i].Add(1)
+}
+
+func (r *ExpvarMetricsRecorder) snapshot() map[string]any {
+	out := make(map[string]any)
+	r.routes.Range(func(k, v any) bool {
+		rm := v.(*routeMetrics)
+		buckets := make(map[string]int64, len(rm.durationBuckets))
+		var cumulative int64
+		for i := range rm.durationBuckets {
+			cumulative += rm.durationBuckets[i].Load()
+			le := "+Inf"
+			if i < len(r.buckets) {
+				le = strconv.FormatFloat(r.buckets[i].Seconds(), 'g', -1, 64)
+			}
+			buckets[le] = cumulative
+		}
+		out[k.(string)] = map[string]any{
+			"requests":                   rm.requests.Load(),
+			"server_errors":              rm.serverErrors.Load(),
+			"request_bytes":              rm.requestBytes.Load(),
+			"response_bytes":             rm.responseBytes.Load(),
+			"time_to_first_byte_seconds": time.Duration(rm.timeToFirstByteNs.Load()).Seconds(),
+			"duration_seconds":           time.Duration(rm.durationNs.Load()).Seconds(),
+			"queue_delay_seconds":        time.Duration(rm.queueDelayNs.Load()).Seconds(),
+			"duration_seconds_buckets":   buckets,
+		}
+		return true
+	})
+	return out
+}
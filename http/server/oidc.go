@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/gpahal/golib/http/server/oidc"
+)
+
+const (
+	oidcRequestSessionKey   = "golib.oidc.request"
+	oidcPrincipalSessionKey = "golib.oidc.principal"
+
+	defaultOIDCLoginPath    = "/auth/login"
+	defaultOIDCCallbackPath = "/auth/callback"
+	defaultOIDCLogoutPath   = "/auth/logout"
+	oidcDiscoveryTimeout    = 10 * time.Second
+)
+
+type OIDCOptions struct {
+	oidc.Config
+	// LoginPath starts the login, optionally with a return_to query parameter holding the local
+	// path to return to afterwards. Defaults to /auth/login.
+	LoginPath string
+	// CallbackPath is the path of Config.RedirectURL. Defaults to /auth/callback.
+	CallbackPath string
+	// LogoutPath destroys the session and, if supported, logs out at the provider. It only
+	// accepts POST requests, which the CSRF middleware protects. Defaults to /auth/logout.
+	LogoutPath string
+	// PostLogoutRedirectURL is where users are sent after logging out. Defaults to "/".
+	PostLogoutRedirectURL string
+	// Principal maps the identity to the principal of the session, e.g. to read roles from a
+	// claim. Returning an error rejects the login with a 403 error. The principal is stored in
+	// the session, so it should only hold what requests need: with the default cookie store the
+	// whole session must fit in 4KB. Defaults to a principal with the subject as ID, type "oidc"
+	// and the email and name as metadata.
+	Principal func(c echo.Context, identity *oidc.Identity) (*Principal, error)
+}
+
+// UseOIDC mounts the OpenID Connect login flow on e: the login, callback and logout routes, and a
+// middleware attaching the principal of logged in sessions to requests. It requires the session
+// middleware, which must be registered before UseOIDC is called. Use RequireLogin to protect
+// routes.
+func UseOIDC(e *echo.Echo, opts OIDCOptions) error {
+	if opts.LoginPath == "" {
+		opts.LoginPath = defaultOIDCLoginPath
+	}
+	if opts.CallbackPath == "" {
+		opts.CallbackPath = defaultOIDCCallbackPath
+	}
+	if opts.LogoutPath == "" {
+		opts.LogoutPath = defaultOIDCLogoutPath
+	}
+	if opts.PostLogoutRedirectURL == "" {
+		opts.PostLogoutRedirectURL = "/"
+	}
+	if opts.Principal == nil {
+		opts.Principal = func(c echo.Context, identity *oidc.Identity) (*Principal, error) {
+			return &Principal{
+				ID:       identity.Subject,
+				Type:     "oidc",
+				Metadata: map[string]any{"email": identity.Email, "name": identity.Name},
+			}, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), oidcDiscoveryTimeout)
+	defer cancel()
+	client, err := oidc.NewClient(ctx, opts.Config)
+	if err != nil {
+		return err
+	}
+
+	state := getServerState(e)
+	state.mu.Lock()
+	state.loginPath = opts.LoginPath
+	state.mu.Unlock()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, ok := GetPrincipal(c); !ok {
+				if p, ok := SessionValue[*Principal](c, oidcPrincipalSessionKey); ok && p != nil {
+					SetPrincipal(c, p)
+				}
+			}
+			return next(c)
+		}
+	})
+
+	e.GET(opts.LoginPath, func(c echo.Context) error {
+		s := GetSession(c)
+		if s == nil {
+			return errors.New("server: oidc requires the session middleware")
+		}
+
+		authReq, err := client.NewAuthRequest()
+		if err != nil {
+			return err
+		}
+		if err := s.Set(oidcRequestSessionKey, oidcSessionRequest{AuthRequest: *authReq, ReturnTo: localRedirectPath(c.QueryParam("return_to"))}); err != nil {
+			return err
+		}
+		return c.Redirect(http.StatusFound, authReq.URL)
+	})
+
+	e.GET(opts.CallbackPath, func(c echo.Context) error {
+		s := GetSession(c)
+		if s == nil {
+			return errors.New("server: oidc requires the session middleware")
+		}
+
+		var flow oidcSessionRequest
+		ok, err := s.Get(oidcRequestSessionKey, &flow)
+		if err != nil || !ok {
+			return NewProblem(http.StatusBadRequest, "no login in progress")
+		}
+		s.Delete(oidcRequestSessionKey)
+
+		if errorCode := c.QueryParam("error"); errorCode != "" {
+			return NewProblem(http.StatusUnauthorized, "login failed: "+errorCode)
+		}
+		if c.QueryParam("state") != flow.State {
+			return NewProblem(http.StatusBadRequest, "invalid login state")
+		}
+
+		identity, _, err := client.Exchange(c.Request().Context(), &flow.AuthRequest, c.QueryParam("code"))
+		if err != nil {
+			p := NewProblem(http.StatusUnauthorized, "login failed")
+			p.Internal = err
+			return p
+		}
+		principal, err := opts.Principal(c, identity)
+		if err != nil {
+			p := NewProblem(http.StatusForbidden, "forbidden")
+			p.Internal = err
+			return p
+		}
+
+		// The raw ID token isn't kept, it would take up most of a session cookie.
+		s.Rotate()
+		if err := s.Set(oidcPrincipalSessionKey, principal); err != nil {
+			return err
+		}
+		return c.Redirect(http.StatusFound, flow.ReturnTo)
+	})
+
+	// Logout is POST only, so that other sites can't log users out with a link or an image.
+	e.POST(opts.LogoutPath, func(c echo.Context) error {
+		redirectURL := opts.PostLogoutRedirectURL
+		if s := GetSession(c); s != nil {
+			s.Destroy()
+			if endSessionURL := client.EndSessionURL(); endSessionURL != "" {
+				if u, err := url.Parse(endSessionURL); err == nil {
+					// Without an id_token_hint, providers identify the client by its ID.
+					q := u.Query()
+					q.Set("client_id", opts.ClientID)
+					q.Set("post_logout_redirect_uri", absoluteURL(c, opts.PostLogoutRedirectURL))
+					u.RawQuery = q.Encode()
+					redirectURL = u.String()
+				}
+			}
+		}
+		return c.Redirect(http.StatusSeeOther, redirectURL)
+	})
+	return nil
+}
+
+// RequireLogin returns a middleware rejecting requests without a principal. GET requests of a
+// server using UseOIDC are redirected to the login instead, and return to the requested page
+// afterwards.
+func RequireLogin() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, ok := GetPrincipal(c); ok {
+				return next(c)
+			}
+
+			req := c.Request()
+			if loginPath := oidcLoginPath(c.Echo()); loginPath != "" && req.Method == http.MethodGet {
+				return c.Redirect(http.StatusFound, loginPath+"?return_to="+url.QueryEscape(req.URL.RequestURI()))
+			}
+			return NewProblem(http.StatusUnauthorized, "login required")
+		}
+	}
+}
+
+// oidcLoginPath returns the login path of the server if it uses UseOIDC, and "" otherwise.
+func oidcLoginPath(e *echo.Echo) string {
+	state, ok := serverStates.lookup(e)
+	if !ok {
+		return ""
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.loginPath
+}
+
+type oidcSessionRequest struct {
+	oidc.AuthRequest
+	ReturnTo string `json:"return_to"`
+}
+
+// localRedirectPath returns path if it is a local path, and "/" otherwise, which prevents open
+// redirects.
+func localRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	return path
+}
+
+func absoluteURL(c echo.Context, path string) string {
+	if u, err := url.Parse(path); err == nil && u.IsAbs() {
+		return path
+	}
+	return c.Scheme() + "://" + c.Request().Host + path
+}
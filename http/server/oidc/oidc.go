@@ -0,0 +1,161 @@
+// Package oidc implements the OpenID Connect relying party flow: provider discovery, the
+// authorization code flow with PKCE, state and nonce checks and ID token verification. See
+// server.UseOIDC for mounting the flow on a server.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	// ErrNonceMismatch is returned when the nonce of the ID token doesn't match the nonce of the
+	// authorization request, e.g. because the token was replayed.
+	ErrNonceMismatch = errors.New("oidc: nonce mismatch")
+	// ErrMissingIDToken is returned when the token response contains no ID token.
+	ErrMissingIDToken = errors.New("oidc: token response has no id token")
+)
+
+type Config struct {
+	// IssuerURL is the URL of the provider, from which the configuration is discovered at
+	// <IssuerURL>/.well-known/openid-configuration.
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the absolute URL of the callback handler registered with the provider.
+	RedirectURL string
+	// Scopes default to openid, profile and email.
+	Scopes []string
+}
+
+// Client is an OpenID Connect relying party.
+type Client struct {
+	provider *gooidc.Provider
+	oauth2   oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// NewClient discovers the provider configuration and returns a Client.
+func NewClient(ctx context.Context, cfg Config) (*Client, error) {
+	if cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("oidc: issuer url, client id and redirect url are required")
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{gooidc.ScopeOpenID, "profile", "email"}
+	}
+
+	provider, err := gooidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		provider: provider,
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&gooidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// AuthRequest is an authorization request. State, Nonce and Verifier must be kept, e.g. in the
+// session, until the callback.
+type AuthRequest struct {
+	URL      string `json:"-"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// NewAuthRequest returns an authorization request with a random state, nonce and PKCE verifier.
+func (c *Client) NewAuthRequest() (*AuthRequest, error) {
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+	return &AuthRequest{
+		URL:      c.oauth2.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)),
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+	}, nil
+}
+
+// Identity is the authenticated end user.
+type Identity struct {
+	Subject       string         `json:"sub"`
+	Email         string         `json:"email,omitempty"`
+	EmailVerified bool           `json:"email_verified,omitempty"`
+	Name          string         `json:"name,omitempty"`
+	Claims        map[string]any `json:"claims,omitempty"`
+	// IDToken is the raw ID token, e.g. for the id_token_hint of a logout request.
+	IDToken string    `json:"id_token"`
+	Expiry  time.Time `json:"expiry"`
+}
+
+// Exchange exchanges the authorization code of the callback for tokens and verifies the ID token
+// against the request. The caller must check that the state of the callback matches the state of
+// the request.
+func (c *Client) Exchange(ctx context.Context, req *AuthRequest, code string) (*Identity, *oauth2.Token, error) {
+	token, err := c.oauth2.Exchange(ctx, code, oauth2.VerifierOption(req.Verifier))
+	if err != nil {
+		return nil, nil, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, nil, ErrMissingIDToken
+	}
+
+	idToken, err := c.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if idToken.Nonce != req.Nonce {
+		return nil, nil, ErrNonceMismatch
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, nil, err
+	}
+	identity := &Identity{Subject: idToken.Subject, Claims: claims, IDToken: rawIDToken, Expiry: idToken.Expiry}
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	identity.Name, _ = claims["name"].(string)
+	return identity, token, nil
+}
+
+// EndSessionURL returns the RP-initiated logout URL of the provider, or "" if the provider
+// doesn't support it.
+func (c *Client) EndSessionURL() string {
+	var metadata struct {
+		EndSessionEndpoint string `json:"end_session_endpoint"`
+	}
+	if err := c.provider.Claims(&metadata); err != nil {
+		return ""
+	}
+	return metadata.EndSessionEndpoint
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,432 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	web "github.com/gpahal/golib/http"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultOpenAPIPath = "/openapi.json"
+	openAPIVersion     = "3.0.3"
+)
+
+var (
+	openAPIPathParamPattern = regexp.MustCompile(`:([^/]+)`)
+	timeType                = reflect.TypeOf(time.Time{})
+	jsonRawMessageType      = reflect.TypeOf(json.RawMessage{})
+
+	swaggerUITemplate = template.Must(template.New("swagger").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>window.ui = SwaggerUIBundle({url: {{.SpecURL}}, dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`))
+)
+
+// Op documents an operation in the generated OpenAPI document. Request, Query and Response are
+// values of the corresponding Go types, e.g. CreateUserRequest{}; their schemas are derived from
+// the json, query and validate struct tags.
+type Op struct {
+	// ID is the operationId. It is also used as the route name.
+	ID          string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  bool
+	// Query is a struct whose fields with query tags are the query parameters.
+	Query any
+	// Request is the JSON request body.
+	Request any
+	// Response is the JSON response body.
+	Response any
+	// Status is the status of successful responses. Defaults to 200.
+	Status int
+}
+
+type OpenAPIOptions struct {
+	// Title defaults to "API".
+	Title string
+	// Version is the version of the API. Defaults to "1.0.0".
+	Version     string
+	Description string
+	// Servers are the base URLs of the API.
+	Servers []string
+	// Path is where the document is served. Defaults to /openapi.json.
+	Path string
+	// SwaggerUIPath, if set, serves Swagger UI for the document at the path, e.g. /docs.
+	SwaggerUIPath string
+}
+
+// GET registers a documented GET route. See Op and ServeOpenAPI.
+func GET(r Router, path string, h echo.HandlerFunc, op Op, m ...echo.MiddlewareFunc) *echo.Route {
+	return Document(TrackRoute(r.GET(path, h, m...), h, m...), op)
+}
+
+func POST(r Router, path string, h echo.HandlerFunc, op Op, m ...echo.MiddlewareFunc) *echo.Route {
+	return Document(TrackRoute(r.POST(path, h, m...), h, m...), op)
+}
+
+func PUT(r Router, path string, h echo.HandlerFunc, op Op, m ...echo.MiddlewareFunc) *echo.Route {
+	return Document(TrackRoute(r.PUT(path, h, m...), h, m...), op)
+}
+
+func PATCH(r Router, path string, h echo.HandlerFunc, op Op, m ...echo.MiddlewareFunc) *echo.Route {
+	return Document(TrackRoute(r.PATCH(path, h, m...), h, m...), op)
+}
+
+func DELETE(r Router, path string, h echo.HandlerFunc, op Op, m ...echo.MiddlewareFunc) *echo.Route {
+	return Document(TrackRoute(r.DELETE(path, h, m...), h, m...), op)
+}
+
+// Document attaches the operation documentation to an already registered route.
+func Document(route *echo.Route, op Op) *echo.Route {
+	if op.ID != "" {
+		route.Name = op.ID
+	}
+	meta := getRouteMeta(route)
+	meta.mu.Lock()
+	meta.op = &op
+	meta.mu.Unlock()
+	return route
+}
+
+// routeOp returns the operation documentation of route, if any.
+func routeOp(route *echo.Route) (Op, bool) {
+	meta, ok := routeStates.lookup(route)
+	if !ok {
+		return Op{}, false
+	}
+	meta.mu.Lock()
+	defer meta.mu.Unlock()
+	if meta.op == nil {
+		return Op{}, false
+	}
+	return *meta.op, true
+}
+
+// ServeOpenAPI serves the OpenAPI document of the documented routes of e, and optionally Swagger
+// UI. The document is generated on each request so that it includes routes registered later.
+func ServeOpenAPI(e *echo.Echo, opts OpenAPIOptions) {
+	if opts.Path == "" {
+		opts.Path = defaultOpenAPIPath
+	}
+
+	e.GET(opts.Path, func(c echo.Context) error {
+		return c.JSON(http.StatusOK, GenerateOpenAPI(c.Echo(), opts))
+	})
+	if opts.SwaggerUIPath != "" {
+		title := opts.Title
+		if title == "" {
+			title = "API"
+		}
+		e.GET(opts.SwaggerUIPath, func(c echo.Context) error {
+			c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+			return swaggerUITemplate.Execute(c.Response(), map[string]string{"Title": title, "SpecURL": opts.Path})
+		})
+	}
+}
+
+// GenerateOpenAPI generates the OpenAPI document of the documented routes of e.
+func GenerateOpenAPI(e *echo.Echo, opts OpenAPIOptions) map[string]any {
+	if opts.Title == "" {
+		opts.Title = "API"
+	}
+	if opts.Version == "" {
+		opts.Version = "1.0.0"
+	}
+
+	g := &schemaGenerator{components: map[string]any{}, names: map[reflect.Type]string{}}
+	g.components["Problem"] = map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"type":       map[string]any{"type": "string"},
+			"title":      map[string]any{"type": "string"},
+			"status":     map[string]any{"type": "integer"},
+			"detail":     map[string]any{"type": "string"},
+			"instance":   map[string]any{"type": "string"},
+			"request_id": map[string]any{"type": "string"},
+		},
+	}
+
+	routes := e.Routes()
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	paths := map[string]any{}
+	for _, route := range routes {
+		op, ok := routeOp(route)
+		if !ok {
+			continue
+		}
+
+		p := openAPIPathParamPattern.ReplaceAllString(route.Path, "{$1}")
+		item, ok := paths[p].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[p] = item
+		}
+		item[strings.ToLower(route.Method)] = g.operation(route, op)
+	}
+
+	info := map[string]any{"title": opts.Title, "version": opts.Version}
+	if opts.Description != "" {
+		info["description"] = opts.Description
+	}
+	doc := map[string]any{
+		"openapi":    openAPIVersion,
+		"info":       info,
+		"paths":      paths,
+		"components": map[string]any{"schemas": g.components},
+	}
+	if len(opts.Servers) > 0 {
+		servers := make([]map[string]any, 0, len(opts.Servers))
+		for _, url := range opts.Servers {
+			servers = append(servers, map[string]any{"url": url})
+		}
+		doc["servers"] = servers
+	}
+	return doc
+}
+
+func (g *schemaGenerator) operation(route *echo.Route, op Op) map[string]any {
+	o := map[string]any{}
+	if op.ID != "" {
+		o["operationId"] = op.ID
+	}
+	if op.Summary != "" {
+		o["summary"] = op.Summary
+	}
+	if op.Description != "" {
+		o["description"] = op.Description
+	}
+	if len(op.Tags) > 0 {
+		o["tags"] = op.Tags
+	}
+	if op.Deprecated {
+		o["deprecated"] = true
+	}
+
+	var params []map[string]any
+	for _, m := range openAPIPathParamPattern.FindAllStringSubmatch(route.Path, -1) {
+		params = append(params, map[string]any{
+			"name":     m[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+	if op.Query != nil {
+		params = append(params, g.queryParams(reflect.TypeOf(op.Query))...)
+	}
+	if len(params) > 0 {
+		o["parameters"] = params
+	}
+
+	if op.Request != nil {
+		o["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{echo.MIMEApplicationJSON: map[string]any{"schema": g.schema(reflect.TypeOf(op.Request))}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]any{"description": http.StatusText(status)}
+	if op.Response != nil {
+		success["content"] = map[string]any{echo.MIMEApplicationJSON: map[string]any{"schema": g.schema(reflect.TypeOf(op.Response))}}
+	}
+	o["responses"] = map[string]any{
+		fmt.Sprint(status): success,
+		"default": map[string]any{
+			"description": "Error",
+			"content":     map[string]any{web.MIMEApplicationProblemJSON: map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Problem"}}},
+		},
+	}
+	return o
+}
+
+// schemaGenerator derives JSON schemas from Go types. Named struct types are added to the
+// components and referenced, which also handles recursive types.
+type schemaGenerator struct {
+	components map[string]any
+	names      map[reflect.Type]string
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == jsonRawMessageType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := g.componentName(t)
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (g *schemaGenerator) componentName(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if _, taken := g.components[name]; taken {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	g.names[t] = name
+	// Reserve the name before generating the schema so that recursive references resolve.
+	g.components[name] = map[string]any{}
+	g.components[name] = g.structSchema(t)
+	return name
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	g.addFields(t, properties, &required)
+
+	s := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+func (g *schemaGenerator) addFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(ft, properties, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s := g.schema(f.Type)
+		rules := strings.Split(f.Tag.Get("validate"), ",")
+		for _, rule := range rules {
+			if rule == "required" {
+				*required = append(*required, name)
+			} else if values, ok := strings.CutPrefix(rule, "oneof="); ok {
+				s = annotateSchema(s, "enum", strings.Fields(values))
+			}
+		}
+		if desc := f.Tag.Get("description"); desc != "" {
+			s = annotateSchema(s, "description", desc)
+		}
+		properties[name] = s
+	}
+}
+
+func (g *schemaGenerator) queryParams(t reflect.Type) []map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var params []map[string]any
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("query")
+		if name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+		param := map[string]any{"name": name, "in": "query", "schema": g.schema(f.Type)}
+		for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+			if rule == "required" {
+				param["required"] = true
+			}
+		}
+		if desc := f.Tag.Get("description"); desc != "" {
+			param["description"] = desc
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// annotateSchema returns a copy of the schema with the given keyword set. References can't have
+// sibling keywords in OpenAPI 3.0, so they are wrapped in allOf.
+func annotateSchema(s map[string]any, keyword string, value any) map[string]any {
+	if _, ok := s["$ref"]; ok {
+		return map[string]any{"allOf": []any{s}, keyword: value}
+	}
+
+	c := make(map[string]any, len(s)+1)
+	for k, v := range s {
+		c[k] = v
+	}
+	c[keyword] = value
+	return c
+}
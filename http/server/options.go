@@ -0,0 +1,45 @@
+package server
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+// Option configures the Options of a server. Options are applied in order, so later options
+// override earlier ones and middleware is registered in the order it is passed.
+type Option func(opts *Options)
+
+// WithTimeout sets the default handler timeout. A negative value disables it.
+func WithTimeout(timeout time.Duration) Option {
+	return func(opts *Options) {
+		opts.Timeout = timeout
+	}
+}
+
+// WithoutTrailingSlashStrip keeps trailing slashes instead of removing them before routing.
+func WithoutTrailingSlashStrip() Option {
+	return WithTrailingSlash(TrailingSlashKeep)
+}
+
+// WithTrailingSlash selects how trailing slashes of request paths are handled.
+func WithTrailingSlash(mode TrailingSlashMode) Option {
+	return func(opts *Options) {
+		opts.TrailingSlash = mode
+	}
+}
+
+// WithMiddleware appends middleware that runs after the built-in middleware.
+func WithMiddleware(m ...echo.MiddlewareFunc) Option {
+	return func(opts *Options) {
+		opts.Middleware = append(opts.Middleware, m...)
+	}
+}
+
+// WithLogger sets the server logger.
+func WithLogger(logger *zerolog.Logger) Option {
+	return func(opts *Options) {
+		opts.Logger = logger
+	}
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	headerLink = "Link"
+
+	defaultPerPage    = 20
+	defaultMaxPerPage = 100
+)
+
+type PageOptions struct {
+	// DefaultPerPage is used when the request has no per_page parameter. Defaults to 20.
+	DefaultPerPage int
+	// MaxPerPage is the largest accepted per_page value. Defaults to 100.
+	MaxPerPage int
+}
+
+// Page holds the page/per_page pagination parameters of a request. Pages start at 1.
+type Page struct {
+	Page    int
+	PerPage int
+}
+
+func (p Page) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+func (p Page) Limit() int {
+	return p.PerPage
+}
+
+// ParsePage parses the page and per_page query parameters.
+func ParsePage(c echo.Context, opts PageOptions) (Page, error) {
+	defaultLimit, maxLimit := paginationBounds(opts.DefaultPerPage, opts.MaxPerPage)
+	page, err := parsePositiveIntParam(c, "page", 1)
+	if err != nil {
+		return Page{}, err
+	}
+	perPage, err := parsePositiveIntParam(c, "per_page", defaultLimit)
+	if err != nil {
+		return Page{}, err
+	}
+	return Page{Page: page, PerPage: min(perPage, maxLimit)}, nil
+}
+
+type CursorOptions struct {
+	// DefaultLimit is used when the request has no limit parameter. Defaults to 20.
+	DefaultLimit int
+	// MaxLimit is the largest accepted limit value. Defaults to 100.
+	MaxLimit int
+}
+
+// CursorPage holds the cursor/limit pagination parameters of a request. Cursor is empty for the
+// first page.
+type CursorPage struct {
+	Cursor string
+	Limit  int
+}
+
+// Decode decodes the cursor into v. See EncodeCursor.
+func (p CursorPage) Decode(v any) error {
+	if p.Cursor == "" {
+		return nil
+	}
+	return DecodeCursor(p.Cursor, v)
+}
+
+// ParseCursor parses the cursor and limit query parameters.
+func ParseCursor(c echo.Context, opts CursorOptions) (CursorPage, error) {
+	defaultLimit, maxLimit := paginationBounds(opts.DefaultLimit, opts.MaxLimit)
+	limit, err := parsePositiveIntParam(c, "limit", defaultLimit)
+	if err != nil {
+		return CursorPage{}, err
+	}
+	return CursorPage{Cursor: c.QueryParam("cursor"), Limit: min(limit, maxLimit)}, nil
+}
+
+// EncodeCursor encodes v, typically the sort key of the last returned item, into an opaque
+// cursor.
+func EncodeCursor(v any) (string, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bs), nil
+}
+
+// DecodeCursor decodes a cursor created by EncodeCursor into v. Malformed cursors result in a 400
+// error.
+func DecodeCursor(cursor string, v any) error {
+	bs, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(bs, v)
+	}
+	if err != nil {
+		return NewHttpErrorWithInternal(http.StatusBadRequest, "invalid cursor", err)
+	}
+	return nil
+}
+
+type PageMeta struct {
+	Page       int   `json:"page"`
+	PerPage    int   `json:"per_page"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+}
+
+func NewPageMeta(p Page, total int64) PageMeta {
+	totalPages := 0
+	if p.PerPage > 0 {
+		totalPages = int((total + int64(p.PerPage) - 1) / int64(p.PerPage))
+	}
+	return PageMeta{Page: p.Page, PerPage: p.PerPage, Total: total, TotalPages: totalPages}
+}
+
+type CursorMeta struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+func NewCursorMeta(p CursorPage, nextCursor string) CursorMeta {
+	return CursorMeta{Limit: p.Limit, NextCursor: nextCursor, HasMore: nextCursor != ""}
+}
+
+// SetPageLinks sets the Link header with first, prev, next and last page links.
+func SetPageLinks(c echo.Context, p Page, total int64) {
+	meta := NewPageMeta(p, total)
+	links := []string{pageLink(c, "first", url.Values{"page": {"1"}, "per_page": {strconv.Itoa(p.PerPage)}})}
+	if p.Page > 1 {
+		links = append(links, pageLink(c, "prev", url.Values{"page": {strconv.Itoa(p.Page - 1)}, "per_page": {strconv.Itoa(p.PerPage)}}))
+	}
+	if p.Page < meta.TotalPages {
+		links = append(links, pageLink(c, "next", url.Values{"page": {strconv.Itoa(p.Page + 1)}, "per_page": {strconv.Itoa(p.PerPage)}}))
+	}
+	if meta.TotalPages > 0 {
+		links = append(links, pageLink(c, "last", url.Values{"page": {strconv.Itoa(meta.TotalPages)}, "per_page": {strconv.Itoa(p.PerPage)}}))
+	}
+	c.Response().Header().Set(headerLink, strings.Join(links, ", "))
+}
+
+// SetCursorLinks sets the Link header with the next page link, if there is one.
+func SetCursorLinks(c echo.Context, p CursorPage, nextCursor string) {
+	if nextCursor == "" {
+		return
+	}
+	c.Response().Header().Set(headerLink, pageLink(c, "next", url.Values{"cursor": {nextCursor}, "limit": {strconv.Itoa(p.Limit)}}))
+}
+
+// RespondPage writes data with page metadata and Link headers.
+func RespondPage(c echo.Context, data any, p Page, total int64) error {
+	SetPageLinks(c, p, total)
+	return OKWithMeta(c, data, NewPageMeta(p, total))
+}
+
+// RespondCursor writes data with cursor metadata and Link headers.
+func RespondCursor(c echo.Context, data any, p CursorPage, nextCursor string) error {
+	SetCursorLinks(c, p, nextCursor)
+	return OKWithMeta(c, data, NewCursorMeta(p, nextCursor))
+}
+
+func pageLink(c echo.Context, rel string, params url.Values) string {
+	u := *c.Request().URL
+	query := u.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+	return fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel)
+}
+
+func paginationBounds(defaultLimit, maxLimit int) (int, int) {
+	if maxLimit <= 0 {
+		maxLimit = defaultMaxPerPage
+	}
+	if defaultLimit <= 0 {
+		defaultLimit = min(defaultPerPage, maxLimit)
+	}
+	return defaultLimit, maxLimit
+}
+
+func parsePositiveIntParam(c echo.Context, name string, defaultValue int) (int, error) {
+	s := c.QueryParam(name)
+	if s == "" {
+		return defaultValue, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v <= 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s must be a positive integer", name))
+	}
+	return v, nil
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	headerCFConnectingIP          = "CF-Connecting-IP"
+	headerCloudFrontViewerAddress = "CloudFront-Viewer-Address"
+)
+
+type TrustedProxyMode int
+
+const (
+	// TrustedProxyXForwardedFor reads the client IP from the X-Forwarded-For header, skipping
+	// trusted proxies from the right.
+	TrustedProxyXForwardedFor TrustedProxyMode = iota
+	// TrustedProxyXRealIP reads the client IP from the X-Real-IP header.
+	TrustedProxyXRealIP
+	// TrustedProxyCloudflare reads the client IP from the CF-Connecting-IP header. Cloudflare's
+	// published IP ranges are trusted in addition to Ranges.
+	TrustedProxyCloudflare
+	// TrustedProxyCloudFront reads the client IP from the CloudFront-Viewer-Address header.
+	TrustedProxyCloudFront
+)
+
+var (
+	// cloudflareIPRanges are the ranges published at https://www.cloudflare.com/ips/.
+	cloudflareIPRanges = []string{
+		"173.245.48.0/20",
+		"103.21.244.0/22",
+		"103.22.200.0/22",
+		"103.31.4.0/22",
+		"141.101.64.0/18",
+		"108.162.192.0/18",
+		"190.93.240.0/20",
+		"188.114.96.0/20",
+		"197.234.240.0/22",
+		"198.41.128.0/17",
+		"162.158.0.0/15",
+		"104.16.0.0/13",
+		"104.24.0.0/14",
+		"172.64.0.0/13",
+		"131.0.72.0/22",
+		"2400:cb00::/32",
+		"2606:4700::/32",
+		"2803:f800::/32",
+		"2405:b500::/32",
+		"2405:8100::/32",
+		"2a06:98c0::/29",
+		"2c0f:f248::/32",
+	}
+)
+
+// TrustedProxiesOptions configures how the real client IP is extracted from requests that pass
+// through proxies or load balancers. It affects echo.Context.RealIP and everything built on it,
+// e.g. request logs, rate limits and IP filters.
+type TrustedProxiesOptions struct {
+	Mode TrustedProxyMode
+	// Ranges is a list of IPs or CIDR ranges of trusted proxies.
+	Ranges []string
+	// TrustPrivateNetworks trusts loopback, link-local and private network addresses, which is
+	// typical for load balancers inside a VPC.
+	TrustPrivateNetworks bool
+	// Depth, if set, is the number of proxies in front of the server. The client IP is read from
+	// the X-Forwarded-For entry that many hops from the right, ignoring Ranges. Only used with
+	// TrustedProxyXForwardedFor.
+	Depth int
+}
+
+// NewIPExtractor returns the echo IP extractor for the options. It panics if a range is invalid.
+func NewIPExtractor(opts TrustedProxiesOptions) echo.IPExtractor {
+	ranges := opts.Ranges
+	if opts.Mode == TrustedProxyCloudflare {
+		ranges = append(append([]string(nil), ranges...), cloudflareIPRanges...)
+	}
+	prefixes := mustParseIPRanges(ranges)
+
+	switch opts.Mode {
+	case TrustedProxyXRealIP:
+		return echo.ExtractIPFromRealIPHeader(trustOptions(prefixes, opts.TrustPrivateNetworks)...)
+	case TrustedProxyCloudflare:
+		return headerIPExtractor(headerCFConnectingIP, prefixes, opts.TrustPrivateNetworks, parseIPHeader)
+	case TrustedProxyCloudFront:
+		return headerIPExtractor(headerCloudFrontViewerAddress, prefixes, opts.TrustPrivateNetworks, parseCloudFrontViewerAddress)
+	default:
+		if opts.Depth > 0 {
+			return forwardedForDepthExtractor(opts.Depth)
+		}
+		return echo.ExtractIPFromXFFHeader(trustOptions(prefixes, opts.TrustPrivateNetworks)...)
+	}
+}
+
+func trustOptions(prefixes []netip.Prefix, trustPrivate bool) []echo.TrustOption {
+	options := []echo.TrustOption{
+		echo.TrustLoopback(trustPrivate),
+		echo.TrustLinkLocal(trustPrivate),
+		echo.TrustPrivateNet(trustPrivate),
+	}
+	for _, p := range prefixes {
+		options = append(options, echo.TrustIPRange(&net.IPNet{
+			IP:   net.IP(p.Addr().AsSlice()),
+			Mask: net.CIDRMask(p.Bits(), p.Addr().BitLen()),
+		}))
+	}
+	return options
+}
+
+// headerIPExtractor reads the client IP from a CDN specific header if the direct peer is a
+// trusted proxy.
+func headerIPExtractor(header string, prefixes []netip.Prefix, trustPrivate bool, parse func(string) string) echo.IPExtractor {
+	direct := echo.ExtractIPDirect()
+	return func(req *http.Request) string {
+		peer := direct(req)
+		peerIP, err := netip.ParseAddr(peer)
+		if err != nil || !isTrustedProxy(peerIP.Unmap(), prefixes, trustPrivate) {
+			return peer
+		}
+		if ip := parse(req.Header.Get(header)); ip != "" {
+			return ip
+		}
+		return peer
+	}
+}
+
+func isTrustedProxy(ip netip.Addr, prefixes []netip.Prefix, trustPrivate bool) bool {
+	if trustPrivate && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()) {
+		return true
+	}
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func forwardedForDepthExtractor(depth int) echo.IPExtractor {
+	direct := echo.ExtractIPDirect()
+	return func(req *http.Request) string {
+		xff := req.Header.Values(echo.HeaderXForwardedFor)
+		var ips []string
+		for _, v := range xff {
+			for _, ip := range strings.Split(v, ",") {
+				ips = append(ips, strings.TrimSpace(ip))
+			}
+		}
+		if len(ips) < depth {
+			return direct(req)
+		}
+		if ip := parseIPHeader(ips[len(ips)-depth]); ip != "" {
+			return ip
+		}
+		return direct(req)
+	}
+}
+
+func parseIPHeader(value string) string {
+	ip, err := netip.ParseAddr(strings.TrimSpace(value))
+	if err != nil {
+		return ""
+	}
+	return ip.Unmap().String()
+}
+
+// parseCloudFrontViewerAddress parses the "<ip>:<port>" value of the CloudFront-Viewer-Address
+// header. IPv6 addresses are not bracketed.
+func parseCloudFrontViewerAddress(value string) string {
+	i := strings.LastIndexByte(value, ':')
+	if i < 0 {
+		return parseIPHeader(value)
+	}
+	return parseIPHeader(value[:i])
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	headerRateLimitLimit     = "RateLimit-Limit"
+	headerRateLimitRemaining = "RateLimit-Remaining"
+	headerRateLimitReset     = "RateLimit-Reset"
+)
+
+// QuotaKeyFunc returns the key requests are counted under. Requests without a key aren't
+// limited.
+type QuotaKeyFunc func(c echo.Context) (string, bool)
+
+// QuotaKeyPrincipal counts requests per authenticated principal, e.g. per user or API key.
+func QuotaKeyPrincipal(c echo.Context) (string, bool) {
+	p, ok := GetPrincipal(c)
+	if !ok || p.ID == "" {
+		return "", false
+	}
+	return "principal:" + p.Type + ":" + p.ID, true
+}
+
+// QuotaKeyTenant counts requests per tenant, resolved by the tenancy middleware or read from the
+// principal.
+func QuotaKeyTenant(c echo.Context) (string, bool) {
+	if t, ok := GetTenant(c); ok {
+		return "tenant:" + t.ID, true
+	}
+	if p, ok := GetPrincipal(c); ok && p.TenantID != "" {
+		return "tenant:" + p.TenantID, true
+	}
+	return "", false
+}
+
+type QuotaOptions struct {
+	Skipper middleware.Skipper
+	// Store counts the requests. Defaults to a MemoryQuotaStore.
+	Store QuotaStore
+	// Key returns the key requests are counted under. Defaults to QuotaKeyPrincipal.
+	Key QuotaKeyFunc
+	// Limit is the limit of keys Resolver doesn't return a limit for.
+	Limit QuotaLimit
+	// Resolver, if set, returns the limit of a key, e.g. based on the plan of the tenant. A limit
+	// with zero Requests falls back to Limit.
+	Resolver func(c echo.Context, key string) (QuotaLimit, error)
+}
+
+// Quota returns a middleware limiting the requests of each authenticated principal to limit.
+// It must run after the authentication middleware. Every limited response carries the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers and exceeding the limit
+// results in a 429 error with a Retry-After header.
+func Quota(limit QuotaLimit) echo.MiddlewareFunc {
+	return QuotaWithOptions(QuotaOptions{Limit: limit})
+}
+
+func QuotaWithOptions(opts QuotaOptions) echo.MiddlewareFunc {
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryQuotaStore()
+	}
+	if opts.Key == nil {
+		opts.Key = QuotaKeyPrincipal
+	}
+	if opts.Resolver == nil && (opts.Limit.Requests <= 0 || opts.Limit.Window <= 0) {
+		panic("server: quota requires a limit or a resolver")
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if opts.Skipper(c) {
+				return next(c)
+			}
+			key, ok := opts.Key(c)
+			if !ok {
+				return next(c)
+			}
+
+			limit := opts.Limit
+			if opts.Resolver != nil {
+				l, err := opts.Resolver(c, key)
+				if err != nil {
+					return NewHttpErrorWithInternal(http.StatusInternalServerError, "failed to resolve quota", err)
+				}
+				if l.Requests > 0 {
+					limit = l
+				}
+			}
+			if limit.Requests <= 0 || limit.Window <= 0 {
+				return next(c)
+			}
+
+			usage, err := opts.Store.Take(c.Request().Context(), key, limit.Window)
+			if err != nil {
+				// Failing open keeps the service available when the store is down.
+				Logger(c).Warn().Err(err).Str("quota_key", key).Msg("quota store failed")
+				return next(c)
+			}
+
+			resetSeconds := int(math.Ceil(time.Until(usage.Reset).Seconds()))
+			header := c.Response().Header()
+			header.Set(headerRateLimitLimit, strconv.Itoa(limit.Requests))
+			header.Set(headerRateLimitRemaining, strconv.Itoa(max(limit.Requests-usage.Count, 0)))
+			header.Set(headerRateLimitReset, strconv.Itoa(resetSeconds))
+			if usage.Count > limit.Requests {
+				header.Set(echo.HeaderRetryAfter, strconv.Itoa(resetSeconds))
+				return NewProblem(http.StatusTooManyRequests, "request quota exceeded")
+			}
+			return next(c)
+		}
+	}
+}
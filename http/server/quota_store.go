@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisQuotaPrefix = "quota:"
+)
+
+// QuotaLimit allows Requests requests per Window.
+type QuotaLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// QuotaUsage is the state of a quota after a request was counted.
+type QuotaUsage struct {
+	// Count is the number of requests in the current window, including the counted one.
+	Count int
+	// Reset is the end of the current window.
+	Reset time.Time
+}
+
+// QuotaStore counts the requests of quota keys in fixed windows.
+type QuotaStore interface {
+	// Take counts a request for key in the current window of the given length.
+	Take(ctx context.Context, key string, window time.Duration) (QuotaUsage, error)
+}
+
+// MemoryQuotaStore is a QuotaStore counting requests in memory. Counts are not shared between
+// server instances.
+type MemoryQuotaStore struct {
+	mu        sync.Mutex
+	windows   map[string]memoryQuotaWindow
+	lastSweep time.Time
+}
+
+type memoryQuotaWindow struct {
+	count int
+	reset time.Time
+}
+
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{windows: make(map[string]memoryQuotaWindow), lastSweep: time.Now()}
+}
+
+func (s *MemoryQuotaStore) Take(ctx context.Context, key string, window time.Duration) (QuotaUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	reset := quotaWindowStart(now, window).Add(window)
+	w := s.windows[key]
+	if !w.reset.Equal(reset) {
+		w = memoryQuotaWindow{reset: reset}
+	}
+	w.count++
+	s.windows[key] = w
+
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, w := range s.windows {
+			if now.After(w.reset) {
+				delete(s.windows, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	return QuotaUsage{Count: w.count, Reset: w.reset}, nil
+}
+
+type redisQuotaStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisQuotaStore returns a QuotaStore counting requests in Redis under keys with the given
+// prefix, which shares quotas between server instances. The prefix defaults to "quota:".
+func NewRedisQuotaStore(client redis.UniversalClient, prefix string) QuotaStore {
+	if prefix == "" {
+		prefix = defaultRedisQuotaPrefix
+	}
+	return &redisQuotaStore{client: client, prefix: prefix}
+}
+
+func (s *redisQuotaStore) Take(ctx context.Context, key string, window time.Duration) (QuotaUsage, error) {
+	start := quotaWindowStart(time.Now(), window)
+	redisKey := s.prefix + key + ":" + strconv.FormatInt(start.UnixMilli(), 10)
+
+	var incr *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, redisKey)
+		pipe.PExpire(ctx, redisKey, window)
+		return nil
+	})
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	return QuotaUsage{Count: int(incr.Val()), Reset: start.Add(window)}, nil
+}
+
+// quotaWindowStart returns the start of the fixed window containing t.
+func quotaWindowStart(t time.Time, window time.Duration) time.Time {
+	return t.Truncate(window)
+}
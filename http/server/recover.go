@@ -0,0 +1,60 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+// RecoverOptions configures how panics in handlers are recovered.
+type RecoverOptions struct {
+	// DisableStack omits the stack trace from the log line.
+	DisableStack bool
+	// OnPanic is called with every recovered panic and its stack trace, e.g. to increment a
+	// metric. The panic is turned into a 500 error afterwards.
+	OnPanic func(c echo.Context, err error, stack []byte)
+}
+
+// newRecoverer recovers panics in handlers, logs them with the request logger and the stack trace
+// and reports them to the error reporter. http.ErrAbortHandler is re-panicked so that net/http
+// aborts the response.
+func newRecoverer(opts RecoverOptions, logger func() *zerolog.Logger, reporter ErrorReporter) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (returnErr error) {
+			defer func() {
+				if r := recover(); r != nil {
+					if r == http.ErrAbortHandler {
+						panic(r)
+					}
+
+					err, ok := r.(error)
+					if !ok {
+						err = fmt.Errorf("%v", r)
+					}
+					stack := debug.Stack()
+
+					reqLogger := logger()
+					if sctx, ok := c.(*Context); ok && sctx.requestLogger != nil {
+						reqLogger = sctx.requestLogger
+					}
+					evt := reqLogger.Error().Err(err).Str("uri", c.Request().RequestURI)
+					if !opts.DisableStack {
+						evt = evt.Str("stack", string(stack))
+					}
+					evt.Msg("recovery handler")
+
+					if opts.OnPanic != nil {
+						opts.OnPanic(c, err, stack)
+					}
+					pe := &panicError{err: err, stack: stack}
+					reportPanic(reporter, c, pe)
+					returnErr = pe
+				}
+			}()
+			return next(c)
+		}
+	}
+}
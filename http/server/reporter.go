@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultReporterTimeout   = 10 * time.Second
+	defaultReporterQueueSize = 100
+	defaultReporterWorkers   = 2
+)
+
+// ErrorReport describes a panic or server error that occurred while handling a request.
+type ErrorReport struct {
+	Err       error
+	Stack     []byte
+	Panic     bool
+	Time      time.Time
+	Request   *http.Request
+	RequestID string
+	Route     string
+	UserID    string
+	TenantID  string
+}
+
+// ErrorReporter sends error reports to an external service. Report is called synchronously from
+// the request goroutine, so implementations should not block.
+type ErrorReporter interface {
+	Report(ctx context.Context, r *ErrorReport)
+}
+
+type ErrorReporterFunc func(ctx context.Context, r *ErrorReport)
+
+func (erf ErrorReporterFunc) Report(ctx context.Context, r *ErrorReport) {
+	erf(ctx, r)
+}
+
+// panicError wraps a recovered panic so that it is reported only once.
+type panicError struct {
+	err   error
+	stack []byte
+}
+
+func (pe *panicError) Error() string {
+	return pe.err.Error()
+}
+
+func (pe *panicError) Unwrap() error {
+	return pe.err
+}
+
+func newErrorReport(c echo.Context, err error, stack []byte, isPanic bool) *ErrorReport {
+	r := &ErrorReport{
+		Err:       err,
+		Stack:     stack,
+		Panic:     isPanic,
+		Time:      time.Now(),
+		Request:   c.Request(),
+		RequestID: RequestID(c),
+		Route:     c.Path(),
+	}
+	if r.Stack == nil {
+		r.Stack = debug.Stack()
+	}
+	if p, ok := GetPrincipal(c); ok {
+		r.UserID = p.ID
+		r.TenantID = p.TenantID
+	}
+	return r
+}
+
+func reportError(reporter ErrorReporter, c echo.Context, err error) {
+	if reporter == nil {
+		return
+	}
+
+	var pe *panicError
+	if errors.As(err, &pe) {
+		return
+	}
+	reporter.Report(c.Request().Context(), newErrorReport(c, err, nil, false))
+}
+
+func reportPanic(reporter ErrorReporter, c echo.Context, pe *panicError) {
+	if reporter == nil {
+		return
+	}
+	reporter.Report(c.Request().Context(), newErrorReport(c, pe.err, pe.stack, true))
+}
+
+type errorReportPayload struct {
+	Error     string    `json:"error"`
+	Stack     string    `json:"stack,omitempty"`
+	Panic     bool      `json:"panic"`
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Route     string    `json:"route,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+}
+
+// NewWebhookReporter returns a reporter that posts reports as JSON to the given URL. Reports are
+// sent in the background; failures are ignored, and reports are dropped while the queue of
+// unsent reports is full, e.g. during an error storm.
+func NewWebhookReporter(webhookURL string, client *http.Client) ErrorReporter {
+	if client == nil {
+		client = &http.Client{Timeout: defaultReporterTimeout}
+	}
+	sender := newReportSender(client)
+
+	return ErrorReporterFunc(func(ctx context.Context, r *ErrorReport) {
+		payload := errorReportPayload{
+			Error:     r.Err.Error(),
+			Stack:     string(r.Stack),
+			Panic:     r.Panic,
+			Time:      r.Time,
+			RequestID: r.RequestID,
+			Route:     r.Route,
+			UserID:    r.UserID,
+			TenantID:  r.TenantID,
+		}
+		if r.Request != nil {
+			payload.Method = r.Request.Method
+			payload.URL = r.Request.URL.String()
+		}
+
+		sender.send(webhookURL, nil, payload)
+	})
+}
+
+// NewSentryReporter returns a reporter that sends reports to Sentry using the given DSN. Reports
+// are sent in the background like with NewWebhookReporter.
+func NewSentryReporter(dsn string, client *http.Client) (ErrorReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, errors.New("sentry dsn is missing the public key")
+	}
+	projectID := strings.Trim(u.Path, "/")
+	if projectID == "" {
+		return nil, errors.New("sentry dsn is missing the project id")
+	}
+	if client == nil {
+		client = &http.Client{Timeout: defaultReporterTimeout}
+	}
+
+	storeURL := fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, projectID)
+	authHeader := fmt.Sprintf("Sentry sentry_version=7, sentry_client=golib/1.0, sentry_key=%s", u.User.Username())
+	if secret, ok := u.User.Password(); ok {
+		authHeader += ", sentry_secret=" + secret
+	}
+	sender := newReportSender(client)
+
+	return ErrorReporterFunc(func(ctx context.Context, r *ErrorReport) {
+		event := map[string]any{
+			"event_id":  newEventID(),
+			"timestamp": r.Time.UTC().Format(time.RFC3339),
+			"level":     "error",
+			"platform":  "go",
+			"exception": map[string]any{
+				"values": []map[string]any{{"type": fmt.Sprintf("%T", r.Err), "value": r.Err.Error()}},
+			},
+			"tags":  map[string]string{"request_id": r.RequestID, "route": r.Route, "tenant_id": r.TenantID, "panic": fmt.Sprint(r.Panic)},
+			"extra": map[string]string{"stack": string(r.Stack)},
+		}
+		if r.UserID != "" {
+			event["user"] = map[string]string{"id": r.UserID}
+		}
+		if r.Request != nil {
+			event["request"] = map[string]string{"method": r.Request.Method, "url": r.Request.URL.String()}
+		}
+
+		sender.send(storeURL, map[string]string{"X-Sentry-Auth": authHeader}, event)
+	}), nil
+}
+
+type reportRequest struct {
+	url     string
+	headers map[string]string
+	payload any
+}
+
+// reportSender posts reports with a fixed number of workers, so that an error storm doesn't
+// start a goroutine and a connection per error.
+type reportSender struct {
+	client *http.Client
+	queue  chan reportRequest
+	start  sync.Once
+}
+
+func newReportSender(client *http.Client) *reportSender {
+	return &reportSender{client: client, queue: make(chan reportRequest, defaultReporterQueueSize)}
+}
+
+// send queues the report, or drops it if the queue is full. The workers are started by the first
+// report.
+func (rs *reportSender) send(url string, headers map[string]string, payload any) {
+	rs.start.Do(func() {
+		for i := 0; i < defaultReporterWorkers; i++ {
+			go func() {
+				for r := range rs.queue {
+					postJson(rs.client, r.url, r.headers, r.payload)
+				}
+			}()
+		}
+	})
+
+	select {
+	case rs.queue <- reportRequest{url: url, headers: headers, payload: payload}:
+	default:
+	}
+}
+
+func postJson(client *http.Client, url string, headers map[string]string, payload any) {
+	bs, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(bs))
+	if err != nil {
+		return
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
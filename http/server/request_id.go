@@ -0,0 +1,27 @@
+package server
+
+import (
+	web "github.com/gpahal/golib/http"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	requestIDContextKey = "golib.server.request_id"
+)
+
+// RequestID returns the ID of the request. It is either the X-Request-ID header sent by the
+// client or a generated ID, and is echoed in the X-Request-ID response header.
+func RequestID(c echo.Context) string {
+	if requestID, ok := c.Get(requestIDContextKey).(string); ok {
+		return requestID
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
+
+// setRequestID stores the request ID in the echo context and in the request's context, from
+// where the http client picks it up for outbound requests.
+func setRequestID(c echo.Context, requestID string) {
+	c.Set(requestIDContextKey, requestID)
+	req := c.Request()
+	c.SetRequest(req.WithContext(web.WithRequestID(req.Context(), requestID)))
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog"
+)
+
+const (
+	headerTraceparent = "traceparent"
+
+	logFieldsContextKey = "golib.server.log_fields"
+)
+
+// RequestLoggerOptions selects the fields included in the request log line. Status, latency,
+// error, request ID and response size are always included.
+type RequestLoggerOptions struct {
+	RemoteIP  bool
+	UserAgent bool
+	// TraceID logs the trace ID read from TraceIDHeader.
+	TraceID bool
+	// TraceIDHeader is the header the trace ID is read from. Defaults to the W3C traceparent
+	// header, from which the trace-id part is extracted.
+	TraceIDHeader string
+	// Route logs the route template, e.g. /users/:id.
+	Route bool
+	// Principal logs the ID and tenant ID of the authenticated principal, if any.
+	Principal bool
+	// Headers is a list of request headers to log.
+	Headers []string
+	// Fields returns additional fields to log for the request, e.g. values handlers stored in
+	// the context.
+	Fields func(c echo.Context) map[string]any
+	// SkipPaths is a list of request paths that are never logged, e.g. health checks.
+	SkipPaths []string
+	// Skipper skips logging for requests it returns true for.
+	Skipper middleware.Skipper
+	// Sampler decides whether a completed request is logged. Requests that returned an error are
+	// always logged. Defaults to logging every request.
+	Sampler LogSampler
+}
+
+// LogSampler decides whether a completed request is logged.
+type LogSampler interface {
+	Sample(c echo.Context, status int) bool
+}
+
+type LogSamplerFunc func(c echo.Context, status int) bool
+
+func (lsf LogSamplerFunc) Sample(c echo.Context, status int) bool {
+	return lsf(c, status)
+}
+
+// StatusClassSampler returns a sampler that logs requests with the given probability per status
+// class, e.g. {2: 0.01} logs 1% of 2xx responses. Status classes without a rate are always
+// logged.
+func StatusClassSampler(rates map[int]float64) LogSampler {
+	return LogSamplerFunc(func(c echo.Context, status int) bool {
+		rate, ok := rates[status/100]
+		if !ok || rate >= 1 {
+			return true
+		}
+		return rand.Float64() < rate
+	})
+}
+
+func newRequestLogger(opts RequestLoggerOptions) echo.MiddlewareFunc {
+	if opts.TraceIDHeader == "" {
+		opts.TraceIDHeader = headerTraceparent
+	}
+
+	skipper := opts.Skipper
+	if len(opts.SkipPaths) > 0 {
+		skipPaths := make(map[string]struct{}, len(opts.SkipPaths))
+		for _, path := range opts.SkipPaths {
+			skipPaths[path] = struct{}{}
+		}
+		skipper = func(c echo.Context) bool {
+			if _, ok := skipPaths[c.Request().URL.Path]; ok {
+				return true
+			}
+			return opts.Skipper != nil && opts.Skipper(c)
+		}
+	}
+
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		Skipper:         skipper,
+		LogMethod:       true,
+		LogURI:          true,
+		LogStatus:       true,
+		LogError:        true,
+		LogLatency:      true,
+		LogResponseSize: true,
+		LogRemoteIP:     opts.RemoteIP,
+		LogUserAgent:    opts.UserAgent,
+		LogRoutePath:    opts.Route,
+		LogHeaders:      opts.Headers,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			if v.Error == nil && opts.Sampler != nil && !opts.Sampler.Sample(c, v.Status) {
+				return nil
+			}
+
+			sctx := c.(*Context)
+			evt := sctx.ServerLogger.Info()
+			if v.Error != nil {
+				evt = sctx.ServerLogger.Error()
+			}
+
+			evt = evt.Int("status", v.Status).Err(v.Error).Str("latency", v.Latency.String())
+			if v.RequestID != "" {
+				evt = evt.Str("request_id", v.RequestID)
+			}
+			if v.ResponseSize > 0 {
+				evt = evt.Str("size", humanize.Bytes(uint64(v.ResponseSize)))
+			}
+
+			evt = addRequestLoggerFields(evt, c, v, opts)
+			evt.Msg("request")
+			return nil
+		},
+	})
+}
+
+func addRequestLoggerFields(evt *zerolog.Event, c echo.Context, v middleware.RequestLoggerValues, opts RequestLoggerOptions) *zerolog.Event {
+	if opts.RemoteIP && v.RemoteIP != "" {
+		evt = evt.Str("remote_ip", v.RemoteIP)
+	}
+	if opts.UserAgent && v.UserAgent != "" {
+		evt = evt.Str("user_agent", v.UserAgent)
+	}
+	if opts.Route && v.RoutePath != "" {
+		evt = evt.Str("route", v.RoutePath)
+	}
+	if opts.TraceID {
+		if traceID := extractTraceID(c.Request(), opts.TraceIDHeader); traceID != "" {
+			evt = evt.Str("trace_id", traceID)
+		}
+	}
+	if opts.Principal {
+		if p, ok := GetPrincipal(c); ok {
+			evt = evt.Str("user_id", p.ID)
+			if p.TenantID != "" {
+				evt = evt.Str("tenant_id", p.TenantID)
+			}
+		}
+	}
+	for name, values := range v.Headers {
+		evt = evt.Str("header_"+strings.ToLower(strings.ReplaceAll(name, "-", "_")), strings.Join(values, ", "))
+	}
+	if opts.Fields != nil {
+		for k, val := range opts.Fields(c) {
+			evt = evt.Interface(k, val)
+		}
+	}
+	if fields, ok := c.Get(logFieldsContextKey).(*logFields); ok {
+		fields.mu.Lock()
+		for _, k := range fields.keys {
+			evt = evt.Interface(k, fields.values[k])
+		}
+		fields.mu.Unlock()
+	}
+	return evt
+}
+
+// logFields are the fields added with LogField, in the order they were first added.
+type logFields struct {
+	mu     sync.Mutex
+	keys   []string
+	values map[string]any
+}
+
+// LogField attaches a key/value pair to the request log line, e.g. the ID of the order a handler
+// operates on. A later value for the same key replaces the earlier one. The field is only
+// logged if the request log line is, see RequestLoggerOptions.
+func LogField(c echo.Context, key string, value any) {
+	fields, ok := c.Get(logFieldsContextKey).(*logFields)
+	if !ok {
+		fields = &logFields{values: make(map[string]any)}
+		c.Set(logFieldsContextKey, fields)
+	}
+
+	fields.mu.Lock()
+	defer fields.mu.Unlock()
+	if _, ok := fields.values[key]; !ok {
+		fields.keys = append(fields.keys, key)
+	}
+	fields.values[key] = value
+}
+
+// extractTraceID reads the trace ID from the given request header. For the W3C traceparent
+// header only the trace-id part is returned.
+func extractTraceID(req *http.Request, header string) string {
+	traceID, _ := extractTraceIDs(req, header)
+	return traceID
+}
+
+// extractTraceIDs reads the trace ID and, for the W3C traceparent header, the parent span ID from
+// the given request header.
+func extractTraceIDs(req *http.Request, header string) (string, string) {
+	value := req.Header.Get(header)
+	if value == "" || !strings.EqualFold(header, headerTraceparent) {
+		return value, ""
+	}
+
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 {
+		return "", ""
+	}
+	return parts[1], parts[2]
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Envelope is the JSON body written by the response helpers. Exactly one of Data and Error is
+// set.
+type Envelope struct {
+	Data      any      `json:"data,omitempty"`
+	Error     *Problem `json:"error,omitempty"`
+	Meta      any      `json:"meta,omitempty"`
+	RequestID string   `json:"request_id,omitempty"`
+}
+
+// OK writes data in a 200 response envelope.
+func OK(c echo.Context, data any) error {
+	return Respond(c, http.StatusOK, data, nil)
+}
+
+// OKWithMeta writes data and meta in a 200 response envelope.
+func OKWithMeta(c echo.Context, data any, meta any) error {
+	return Respond(c, http.StatusOK, data, meta)
+}
+
+// Created writes data in a 201 response envelope.
+func Created(c echo.Context, data any) error {
+	return Respond(c, http.StatusCreated, data, nil)
+}
+
+// NoContent writes an empty 204 response.
+func NoContent(c echo.Context) error {
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Respond writes data and meta in a response envelope with the given status code.
+func Respond(c echo.Context, code int, data any, meta any) error {
+	return c.JSON(code, Envelope{Data: data, Meta: meta, RequestID: RequestID(c)})
+}
+
+// Fail writes err in an error response envelope. The error is translated into a problem the same
+// way the server's error handler does it.
+func Fail(c echo.Context, err error) error {
+	var translators []ErrorTranslator
+	if sctx, ok := c.(*Context); ok {
+		translators = sctx.errorTranslators
+	}
+
+	p := withProblemDefaults(c, translateError(c.Echo(), c, err, translators))
+	return c.JSON(p.Status, Envelope{Error: p, RequestID: RequestID(c)})
+}
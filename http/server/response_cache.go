@@ -0,0 +1,337 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	headerAge    = "Age"
+	headerXCache = "X-Cache"
+
+	defaultResponseCacheTTL         = time.Minute
+	defaultResponseCacheMaxBodySize = 1 << 20
+)
+
+type ResponseCacheOptions struct {
+	// Store defaults to a MemoryResponseCacheStore.
+	Store ResponseCacheStore
+	// TTL is how long responses are served from the cache. Defaults to 1m.
+	TTL time.Duration
+	// StaleWhileRevalidate is how long after TTL a stale response is still served while it is
+	// refreshed in the background.
+	StaleWhileRevalidate time.Duration
+	// VaryHeaders are the request headers that are part of the cache key. The default key
+	// consists of the host, without port, the path and the query, so that host routes and tenant
+	// subdomains don't share responses. Requests with an Authorization or Cookie header are not
+	// cached, since their responses may depend on the caller, unless the header is listed here.
+	VaryHeaders []string
+	// Tags returns the tags of a cached response. Defaults to the request path, so that
+	// Invalidate(ctx, "/items") drops all cached variants of /items.
+	Tags func(c echo.Context) []string
+	// MaxBodySize is the largest response that is cached. Defaults to 1MB.
+	MaxBodySize int
+}
+
+// CacheRouteOptions overrides the ResponseCacheOptions of a single route. Zero values inherit
+// the cache's options.
+type CacheRouteOptions struct {
+	Skipper              middleware.Skipper
+	TTL                  time.Duration
+	StaleWhileRevalidate time.Duration
+	VaryHeaders          []string
+	Tags                 func(c echo.Context) []string
+}
+
+// ResponseCache caches successful GET responses of the routes using its middleware. Handlers of
+// writes call Invalidate so that later reads aren't served outdated responses.
+type ResponseCache struct {
+	opts         ResponseCacheOptions
+	revalidating sync.Map
+}
+
+// responseCacheRevalidationKeys are the context values copied to the context of background
+// revalidations, which only run the cached handler.
+var responseCacheRevalidationKeys = []string{
+	principalContextKey,
+	tenantContextKey,
+	requestIDContextKey,
+	requestHostContextKey,
+	subdomainContextKey,
+	localeContextKey,
+	catalogContextKey,
+}
+
+func NewResponseCache(opts ResponseCacheOptions) *ResponseCache {
+	if opts.Store == nil {
+		opts.Store = NewMemoryResponseCacheStore()
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = defaultResponseCacheTTL
+	}
+	if opts.Tags == nil {
+		opts.Tags = func(c echo.Context) []string {
+			return []string{c.Request().URL.Path}
+		}
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultResponseCacheMaxBodySize
+	}
+	return &ResponseCache{opts: opts}
+}
+
+// Invalidate removes all cached responses with one of the tags.
+func (rc *ResponseCache) Invalidate(ctx context.Context, tags ...string) error {
+	return rc.opts.Store.Invalidate(ctx, tags...)
+}
+
+// Middleware returns the middleware to use on cached routes.
+func (rc *ResponseCache) Middleware() echo.MiddlewareFunc {
+	return rc.MiddlewareWithOptions(CacheRouteOptions{})
+}
+
+func (rc *ResponseCache) MiddlewareWithOptions(opts CacheRouteOptions) echo.MiddlewareFunc {
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = rc.opts.TTL
+	}
+	if opts.StaleWhileRevalidate <= 0 {
+		opts.StaleWhileRevalidate = rc.opts.StaleWhileRevalidate
+	}
+	if opts.VaryHeaders == nil {
+		opts.VaryHeaders = rc.opts.VaryHeaders
+	}
+	if opts.Tags == nil {
+		opts.Tags = rc.opts.Tags
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Method != http.MethodGet || opts.Skipper(c) || strings.Contains(req.Header.Get(echo.HeaderCacheControl), "no-cache") ||
+				hasUnvariedCredentials(req, opts.VaryHeaders) {
+				return next(c)
+			}
+
+			ctx := req.Context()
+			key := requestKey(req, opts.VaryHeaders)
+			cached, err := rc.opts.Store.Get(ctx, key)
+			if err != nil && !errors.Is(err, ErrCacheMiss) {
+				c.Logger().Errorf("response cache: %v", err)
+			}
+			if cached != nil {
+				age := time.Since(cached.StoredAt)
+				if age <= opts.TTL {
+					return writeCachedResponse(c, cached, age, "HIT")
+				}
+				if age <= opts.TTL+opts.StaleWhileRevalidate {
+					rc.revalidate(c, key, next, &opts)
+					return writeCachedResponse(c, cached, age, "STALE")
+				}
+			}
+
+			c.Response().Header().Set(headerXCache, "MISS")
+			return rc.fill(c, key, next, &opts)
+		}
+	}
+}
+
+// fill runs the handler and caches its response if it is cacheable.
+func (rc *ResponseCache) fill(c echo.Context, key string, next echo.HandlerFunc, opts *CacheRouteOptions) error {
+	res := c.Response()
+	crw := &cacheResponseWriter{ResponseWriter: res.Writer, max: rc.opts.MaxBodySize}
+	res.Writer = crw
+	err := next(c)
+	res.Writer = crw.ResponseWriter
+	if err != nil || !crw.cacheable() {
+		return err
+	}
+
+	cached := &CachedResponse{Status: crw.code, Header: cachedHeader(res.Header()), Body: crw.buf, StoredAt: time.Now()}
+	if err := rc.opts.Store.Set(c.Request().Context(), key, cached, opts.TTL+opts.StaleWhileRevalidate, opts.Tags(c)); err != nil {
+		c.Logger().Errorf("response cache: %v", err)
+	}
+	return nil
+}
+
+// hasUnvariedCredentials reports whether req carries an Authorization or Cookie header that
+// isn't part of the cache key.
+func hasUnvariedCredentials(req *http.Request, varyHeaders []string) bool {
+	for _, name := range []string{echo.HeaderAuthorization, echo.HeaderCookie} {
+		if req.Header.Get(name) == "" {
+			continue
+		}
+		varied := false
+		for _, vary := range varyHeaders {
+			if strings.EqualFold(vary, name) {
+				varied = true
+				break
+			}
+		}
+		if !varied {
+			return true
+		}
+	}
+	return false
+}
+
+// requestKey derives a key identifying equivalent requests from the host, the path, the sorted
+// query and the vary headers. The host keeps apart the responses of host routes and tenant
+// subdomains.
+func requestKey(req *http.Request, varyHeaders []string) string {
+	h := sha256.New()
+	h.Write([]byte(strings.ToLower(stripPort(req.Host))))
+	h.Write([]byte{0})
+	h.Write([]byte(req.URL.Path))
+	h.Write([]byte{0})
+	h.Write([]byte(req.URL.Query().Encode()))
+	for _, name := range varyHeaders {
+		h.Write([]byte{0})
+		h.Write([]byte(strings.Join(req.Header.Values(name), ",")))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// revalidate refreshes a stale entry by running the cached handler again in the background, with
+// a copy of the request and the route of c. The middleware of the server and the route isn't run
+// again. At most one revalidation per key runs at a time.
+func (rc *ResponseCache) revalidate(c echo.Context, key string, next echo.HandlerFunc, opts *CacheRouteOptions) {
+	if _, loaded := rc.revalidating.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+
+	req := c.Request().Clone(context.WithoutCancel(c.Request().Context()))
+	ectx := c.Echo().NewContext(req, &discardResponseWriter{header: make(http.Header)})
+	ectx.SetPath(c.Path())
+	ectx.SetParamNames(c.ParamNames()...)
+	ectx.SetParamValues(c.ParamValues()...)
+	for _, k := range responseCacheRevalidationKeys {
+		if v := c.Get(k); v != nil {
+			ectx.Set(k, v)
+		}
+	}
+	rctx := ectx
+	if sctx, ok := c.(*Context); ok {
+		cp := *sctx
+		cp.Context = ectx
+		rctx = &cp
+	}
+
+	go func() {
+		defer rc.revalidating.Delete(key)
+		if err := rc.fill(rctx, key, next, opts); err != nil {
+			Logger(rctx).Warn().Err(err).Msg("response cache: revalidation failed")
+		}
+	}()
+}
+
+func writeCachedResponse(c echo.Context, cached *CachedResponse, age time.Duration, status string) error {
+	header := c.Response().Header()
+	header.Set(headerAge, strconv.Itoa(int(age.Seconds())))
+	header.Set(headerXCache, status)
+	return writeStoredResponse(c, cached)
+}
+
+func writeStoredResponse(c echo.Context, stored *CachedResponse) error {
+	header := c.Response().Header()
+	for name, values := range stored.Header {
+		header[name] = values
+	}
+	c.Response().WriteHeader(stored.Status)
+	_, err := c.Response().Write(stored.Body)
+	return err
+}
+
+// cachedHeader returns the response headers worth caching. Per request and per user headers are
+// dropped, as is the encoding set by an outer compression middleware since the body is captured
+// before compression.
+func cachedHeader(header http.Header) http.Header {
+	cached := header.Clone()
+	for _, name := range []string{echo.HeaderXRequestID, echo.HeaderSetCookie, headerXCache, headerAge, echo.HeaderContentLength, echo.HeaderContentEncoding} {
+		cached.Del(name)
+	}
+	return cached
+}
+
+// cacheResponseWriter copies the response body while writing it.
+type cacheResponseWriter struct {
+	http.ResponseWriter
+	buf      []byte
+	code     int
+	max      int
+	overflow bool
+	flushed  bool
+}
+
+func (w *cacheResponseWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheResponseWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if !w.overflow {
+		if len(w.buf)+len(b) > w.max {
+			w.overflow = true
+			w.buf = nil
+		} else {
+			w.buf = append(w.buf, b...)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *cacheResponseWriter) Flush() {
+	w.flushed = true
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *cacheResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *cacheResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *cacheResponseWriter) cacheable() bool {
+	if w.code != http.StatusOK || w.overflow || w.flushed {
+		return false
+	}
+	header := w.Header()
+	if header.Get(echo.HeaderSetCookie) != "" {
+		return false
+	}
+	cacheControl := header.Get(echo.HeaderCacheControl)
+	return !strings.Contains(cacheControl, "no-store") && !strings.Contains(cacheControl, "private")
+}
+
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(int) {}
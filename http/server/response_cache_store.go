@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gpahal/golib/cache"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisResponseCachePrefix = "response_cache:"
+)
+
+var (
+	// ErrCacheMiss is returned by a ResponseCacheStore when there is no entry for a key.
+	ErrCacheMiss = errors.New("cache miss")
+)
+
+// CachedResponse is a response stored by the response cache.
+type CachedResponse struct {
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	StoredAt time.Time   `json:"stored_at"`
+}
+
+// ResponseCacheStore stores cached responses. Entries are tagged so that all variants of a
+// resource can be invalidated together.
+type ResponseCacheStore interface {
+	Get(ctx context.Context, key string) (*CachedResponse, error)
+	Set(ctx context.Context, key string, resp *CachedResponse, ttl time.Duration, tags []string) error
+	// Invalidate removes all entries with one of the tags.
+	Invalidate(ctx context.Context, tags ...string) error
+}
+
+type MemoryResponseCacheStoreOptions struct {
+	// MaxEntries, if set, is the maximum number of cached responses.
+	MaxEntries int
+	// MaxBytes, if set, is the maximum total size of the cached response bodies.
+	MaxBytes int64
+}
+
+// MemoryResponseCacheStore is a ResponseCacheStore keeping responses in memory. Once it is full,
+// the least recently used responses are evicted.
+type MemoryResponseCacheStore struct {
+	mu        sync.Mutex
+	cache     *cache.Cache[string, memoryCacheEntry]
+	tags      map[string]map[string]struct{}
+	lastSweep time.Time
+}
+
+type memoryCacheEntry struct {
+	resp *CachedResponse
+	tags []string
+}
+
+func NewMemoryResponseCacheStore() *MemoryResponseCacheStore {
+	return NewMemoryResponseCacheStoreWithOptions(MemoryResponseCacheStoreOptions{})
+}
+
+func NewMemoryResponseCacheStoreWithOptions(opts MemoryResponseCacheStoreOptions) *MemoryResponseCacheStore {
+	s := &MemoryResponseCacheStore{
+		tags:      make(map[string]map[string]struct{}),
+		lastSweep: time.Now(),
+	}
+	// Evictions always happen within a call of the store, which holds s.mu.
+	s.cache = cache.NewWithOptions(cache.Options[string, memoryCacheEntry]{
+		MaxEntries: opts.MaxEntries,
+		MaxBytes:   opts.MaxBytes,
+		Size: func(key string, entry memoryCacheEntry) int64 {
+			return int64(len(key) + len(entry.resp.Body))
+		},
+		OnEvict: func(key string, entry memoryCacheEntry, _ cache.EvictionReason) {
+			s.removeTags(key, entry.tags)
+		},
+	})
+	return s
+}
+
+func (s *MemoryResponseCacheStore) Get(ctx context.Context, key string) (*CachedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.cache.Get(key)
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	return entry.resp, nil
+}
+
+func (s *MemoryResponseCacheStore) Set(ctx context.Context, key string, resp *CachedResponse, ttl time.Duration, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cache.Delete(key)
+	for _, tag := range tags {
+		keys, ok := s.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			s.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	s.cache.SetWithTTL(key, memoryCacheEntry{resp: resp, tags: tags}, ttl)
+
+	if now := time.Now(); now.Sub(s.lastSweep) > time.Minute {
+		s.cache.DeleteExpired()
+		s.lastSweep = now
+	}
+	return nil
+}
+
+func (s *MemoryResponseCacheStore) Invalidate(ctx context.Context, tags ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range s.tags[tag] {
+			s.cache.Delete(key)
+		}
+	}
+	return nil
+}
+
+// Stats returns the counters of the underlying cache.
+func (s *MemoryResponseCacheStore) Stats() cache.Stats {
+	return s.cache.Stats()
+}
+
+func (s *MemoryResponseCacheStore) removeTags(key string, tags []string) {
+	for _, tag := range tags {
+		delete(s.tags[tag], key)
+		if len(s.tags[tag]) == 0 {
+			delete(s.tags, tag)
+		}
+	}
+}
+
+type redisResponseCacheStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisResponseCacheStore returns a ResponseCacheStore keeping responses in Redis under keys
+// with the given prefix. The prefix defaults to "response_cache:".
+func NewRedisResponseCacheStore(client redis.UniversalClient, prefix string) ResponseCacheStore {
+	if prefix == "" {
+		prefix = defaultRedisResponseCachePrefix
+	}
+	return &redisResponseCacheStore{client: client, prefix: prefix}
+}
+
+func (s *redisResponseCacheStore) Get(ctx context.Context, key string) (*CachedResponse, error) {
+	data, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrCacheMiss
+	} else if err != nil {
+		return nil, err
+	}
+
+	var resp CachedResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (s *redisResponseCacheStore) Set(ctx context.Context, key string, resp *CachedResponse, ttl time.Duration, tags []string) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.prefix+key, data, ttl)
+		for _, tag := range tags {
+			// Tag sets live at least as long as the entries they reference.
+			pipe.SAdd(ctx, s.tagKey(tag), key)
+			pipe.ExpireGT(ctx, s.tagKey(tag), ttl)
+			pipe.ExpireNX(ctx, s.tagKey(tag), ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *redisResponseCacheStore) Invalidate(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		keys, err := s.client.SMembers(ctx, s.tagKey(tag)).Result()
+		if err != nil {
+			return err
+		}
+
+		_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				pipe.Del(ctx, s.prefix+key)
+			}
+			pipe.Del(ctx, s.tagKey(tag))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *redisResponseCacheStore) tagKey(tag string) string {
+	return s.prefix + "tag:" + tag
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// routeMeta is the state of a route that isn't part of echo.Route.
+type routeMeta struct {
+	mu         sync.Mutex
+	handler    string
+	middleware []string
+	tags       []string
+	op         *Op
+}
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+	// Handler is the name of the handler function.
+	Handler string `json:"handler"`
+	// Middleware are the names of the route level middleware functions. They are only known for
+	// routes registered with the GET, POST, PUT, PATCH and DELETE helpers or TrackRoute.
+	Middleware []string `json:"middleware,omitempty"`
+	// Tags are the tags added with TagRoute and the tags of the route's Op.
+	Tags       []string `json:"tags,omitempty"`
+	Deprecated bool     `json:"deprecated,omitempty"`
+}
+
+func getRouteMeta(route *echo.Route) *routeMeta {
+	return routeStates.get(route)
+}
+
+// TrackRoute records the handler and route level middleware of a route registered directly on an
+// echo router, so that Routes can report them.
+func TrackRoute(route *echo.Route, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	meta := getRouteMeta(route)
+	meta.mu.Lock()
+	defer meta.mu.Unlock()
+
+	meta.handler = funcName(h)
+	meta.middleware = meta.middleware[:0]
+	for _, mw := range m {
+		meta.middleware = append(meta.middleware, funcName(mw))
+	}
+	return route
+}
+
+// TagRoute adds tags to a route, e.g. to group routes in audits of route permissions.
+func TagRoute(route *echo.Route, tags ...string) *echo.Route {
+	meta := getRouteMeta(route)
+	meta.mu.Lock()
+	defer meta.mu.Unlock()
+	meta.tags = append(meta.tags, tags...)
+	return route
+}
+
+// Routes returns the routes registered on e, sorted by path and method.
+func Routes(e *echo.Echo) []RouteInfo {
+	routes := e.Routes()
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	infos := make([]RouteInfo, 0, len(routes))
+	for _, route := range routes {
+		info := RouteInfo{Method: route.Method, Path: route.Path, Name: route.Name, Handler: route.Name}
+		if meta, ok := routeStates.lookup(route); ok {
+			meta.mu.Lock()
+			if meta.handler != "" {
+				info.Handler = meta.handler
+			}
+			info.Middleware = append([]string(nil), meta.middleware...)
+			info.Tags = append([]string(nil), meta.tags...)
+			if meta.op != nil {
+				info.Tags = append(info.Tags, meta.op.Tags...)
+				info.Deprecated = meta.op.Deprecated
+			}
+			meta.mu.Unlock()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// RoutesHandler returns a handler listing the routes of the server. See Routes.
+func RoutesHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, Routes(c.Echo()))
+	}
+}
+
+func funcName(f any) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return ""
+	}
+	return strings.TrimSuffix(fn.Name(), "-fm")
+}
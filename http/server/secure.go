@@ -0,0 +1,51 @@
+package server
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// SecureHeadersOptions configures the security related response headers. Empty values omit the
+// corresponding header.
+type SecureHeadersOptions struct {
+	Skipper middleware.Skipper
+	// HSTSMaxAge is the max-age in seconds of the Strict-Transport-Security header. The header is
+	// only sent for requests made over https.
+	HSTSMaxAge            int
+	HSTSExcludeSubdomains bool
+	HSTSPreload           bool
+	ContentTypeNosniff    string
+	XFrameOptions         string
+	ReferrerPolicy        string
+	ContentSecurityPolicy string
+	// CSPReportOnly sends the Content-Security-Policy-Report-Only header instead of
+	// Content-Security-Policy.
+	CSPReportOnly bool
+}
+
+// DefaultSecureHeadersOptions are the secure headers installed by default when
+// Options.Production is set.
+var DefaultSecureHeadersOptions = SecureHeadersOptions{
+	HSTSMaxAge:         31536000,
+	ContentTypeNosniff: "nosniff",
+	XFrameOptions:      "SAMEORIGIN",
+	ReferrerPolicy:     "strict-origin-when-cross-origin",
+}
+
+func SecureHeaders() echo.MiddlewareFunc {
+	return SecureHeadersWithOptions(DefaultSecureHeadersOptions)
+}
+
+func SecureHeadersWithOptions(opts SecureHeadersOptions) echo.MiddlewareFunc {
+	return middleware.SecureWithConfig(middleware.SecureConfig{
+		Skipper:               opts.Skipper,
+		ContentTypeNosniff:    opts.ContentTypeNosniff,
+		XFrameOptions:         opts.XFrameOptions,
+		HSTSMaxAge:            opts.HSTSMaxAge,
+		HSTSExcludeSubdomains: opts.HSTSExcludeSubdomains,
+		HSTSPreloadEnabled:    opts.HSTSPreload,
+		ContentSecurityPolicy: opts.ContentSecurityPolicy,
+		CSPReportOnly:         opts.CSPReportOnly,
+		ReferrerPolicy:        opts.ReferrerPolicy,
+	})
+}
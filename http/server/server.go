@@ -2,19 +2,22 @@ package server
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/dustin/go-humanize"
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
 	"github.com/rs/zerolog"
+	"golang.org/x/net/http2"
 )
 
 type OnHttpErrorHandler func(c echo.Context, err *echo.HTTPError)
@@ -23,91 +26,253 @@ type Options struct {
 	Validator    *validator.Validate
 	Config       any
 	LoggerWriter io.Writer
-	Logger       *zerolog.Logger
-	OnHttpError  OnHttpErrorHandler
+	// LogFormat selects JSON or console output for the logger created when Logger isn't set.
+	// Defaults to JSON when Production is set and to console otherwise.
+	LogFormat   LogFormat
+	Logger      *zerolog.Logger
+	OnHttpError OnHttpErrorHandler
+	// ErrorTranslators convert errors returned by handlers into problem details. They are tried
+	// before the translators registered with RegisterErrorTranslator.
+	ErrorTranslators []ErrorTranslator
+	// ErrorReporter receives panics and server errors, e.g. to forward them to Sentry.
+	ErrorReporter ErrorReporter
+	// RequestLogger selects the fields included in the request log line.
+	RequestLogger RequestLoggerOptions
+	// Recover configures how panics in handlers are logged.
+	Recover RecoverOptions
+	// Production enables defaults suited for production deployments, e.g. secure headers.
+	Production  bool
+	Compression *CompressionOptions
+	// SecureHeaders configures the security response headers. Defaults to
+	// DefaultSecureHeadersOptions when Production is set.
+	SecureHeaders        *SecureHeadersOptions
+	DisableSecureHeaders bool
+	// Metrics, if set, records the sizes and timings of every request, labelled with the route.
+	// See RequestMetrics.
+	Metrics *RequestMetricsOptions
+	// SlowRequestThreshold, if set, logs a warning for every request slower than the threshold,
+	// separate from the request log.
+	SlowRequestThreshold time.Duration
+	// TrustedProxies configures how the real client IP is extracted behind proxies. Defaults to
+	// echo's behaviour of trusting X-Forwarded-For and X-Real-IP headers from any peer.
+	TrustedProxies *TrustedProxiesOptions
+	// Timeout is the default handler timeout. Defaults to 30s; a negative value disables it. See
+	// RouteTimeout and GroupTimeout for per-route overrides.
+	Timeout time.Duration
+	// TimeoutResponse customizes the response and logging of timed out requests.
+	TimeoutResponse TimeoutResponseOptions
+	// BasicAuth protects all routes, except the ones skipped by its Skipper, with HTTP basic
+	// authentication, e.g. for internal dashboards.
+	BasicAuth *BasicAuthOptions
+	// BuildInfo registers an endpoint reporting the build info of the binary and optionally adds
+	// it to log lines and the Server header.
+	BuildInfo *BuildInfoOptions
+	// Health registers a readiness endpoint aggregating the probes of a health.Registry.
+	Health *HealthOptions
+	// StrictBinding, if set, replaces echo's binder with a StrictBinder rejecting unknown JSON
+	// fields and validating bound values.
+	StrictBinding *StrictBinderOptions
+	// PolicyResolver decides the roles and permissions checked by RequireRoles and
+	// RequirePermission. Defaults to a StaticPolicyResolver.
+	PolicyResolver PolicyResolver
+	// CSRF enables CSRF protection for browser facing services using cookie based sessions.
+	CSRF *CSRFOptions
+	// TrailingSlash selects how trailing slashes of request paths are handled. Defaults to
+	// TrailingSlashStrip.
+	TrailingSlash TrailingSlashMode
+	// DisableTrailingSlashStrip keeps trailing slashes instead of removing them before routing.
+	//
+	// Deprecated: Use TrailingSlash set to TrailingSlashKeep.
+	DisableTrailingSlashStrip bool
+	// CanonicalRedirect, if set, redirects requests to https and to the canonical host.
+	CanonicalRedirect *CanonicalRedirectOptions
+	// MethodOverride, if set, lets POST requests be handled as PUT, PATCH or DELETE requests. See
+	// MethodOverride.
+	MethodOverride *MethodOverrideOptions
+	// Middleware is registered after the built-in middleware, in order, so it runs within the
+	// handler timeout and sees the request ID, logger and recovery.
+	Middleware []echo.MiddlewareFunc
 }
 
-func New() *echo.Echo {
-	return NewWithOptions(Options{})
+func New(options ...Option) *echo.Echo {
+	return NewWithOptions(Options{}, options...)
 }
 
-func NewWithOptions(opts Options) *echo.Echo {
+// NewWithOptions returns a server configured by opts. The functional options are applied to opts
+// in order before the server is created.
+func NewWithOptions(opts Options, options ...Option) *echo.Echo {
+	for _, o := range options {
+		o(&opts)
+	}
 	if opts.LoggerWriter == nil {
 		opts.LoggerWriter = os.Stdout
 	}
+	opts.LogFormat = opts.LogFormat.Resolve(opts.Production)
 	if opts.Logger == nil {
-		opts.Logger = newLogger(opts.LoggerWriter)
+		opts.Logger = newLogger(opts.LoggerWriter, opts.LogFormat)
+	}
+	if opts.Validator == nil {
+		opts.Validator = newDefaultValidator()
 	}
+	if opts.BuildInfo != nil && opts.BuildInfo.LogFields {
+		info := opts.BuildInfo.buildInfo()
+		loggerBuilder := opts.Logger.With()
+		if info.Version != "" {
+			loggerBuilder = loggerBuilder.Str("version", info.Version)
+		}
+		if info.Revision != "" {
+			loggerBuilder = loggerBuilder.Str("revision", info.Revision)
+		}
+		logger := loggerBuilder.Logger()
+		opts.Logger = &logger
+	}
+	logLevels := newLogLevelController(*opts.Logger)
 
 	e := echo.New()
+	state := getServerState(e)
+	state.logLevels = logLevels
 	e.HideBanner = true
-	e.Logger = newGommonLogger(opts.Logger, opts.LoggerWriter)
+	e.Validator = &echoValidator{v: opts.Validator}
+	if opts.StrictBinding != nil {
+		e.Binder = NewStrictBinder(*opts.StrictBinding)
+	}
+	if opts.TrustedProxies != nil {
+		e.IPExtractor = NewIPExtractor(*opts.TrustedProxies)
+	}
+	e.Logger = newGommonLogger(opts.Logger, opts.LoggerWriter, opts.LogFormat)
 	e.Logger.SetLevel(log.INFO)
-	e.HTTPErrorHandler = newErrorHandler(e, opts.Logger, opts.OnHttpError)
-	e.Pre(middleware.RemoveTrailingSlash())
-	e.Use(middleware.RequestID())
+	e.HTTPErrorHandler = newErrorHandler(e, logLevels.Logger, opts.OnHttpError, opts.ErrorTranslators, opts.ErrorReporter)
+	if opts.CanonicalRedirect != nil {
+		e.Pre(CanonicalRedirect(*opts.CanonicalRedirect))
+	}
+	if opts.DisableTrailingSlashStrip {
+		opts.TrailingSlash = TrailingSlashKeep
+	}
+	switch opts.TrailingSlash {
+	case TrailingSlashStrip:
+		e.Pre(middleware.RemoveTrailingSlash())
+	case TrailingSlashRedirect:
+		e.Pre(middleware.RemoveTrailingSlashWithConfig(middleware.TrailingSlashConfig{RedirectCode: http.StatusMovedPermanently}))
+	}
+	if opts.MethodOverride != nil {
+		e.Pre(MethodOverrideWithOptions(*opts.MethodOverride))
+	}
+	e.Use(newHostRestorer())
+	if opts.BuildInfo != nil && opts.BuildInfo.ServerHeader {
+		e.Use(newServerHeader(*opts.BuildInfo))
+	}
+	e.Use(newInFlightMiddleware(state))
+	e.Use(middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		RequestIDHandler: setRequestID,
+	}))
+	if !opts.DisableSecureHeaders {
+		if opts.SecureHeaders != nil {
+			e.Use(SecureHeadersWithOptions(*opts.SecureHeaders))
+		} else if opts.Production {
+			e.Use(SecureHeaders())
+		}
+	}
 	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			sctx := &Context{Context: c, Validator: opts.Validator, ConfigRaw: opts.Config, ServerLoggerWriter: opts.LoggerWriter, ServerLogger: newContextLogger(c, opts.Logger)}
+			logger := logLevels.Logger()
+			sctx := &Context{Context: c, Validator: opts.Validator, ConfigRaw: opts.Config, ServerLoggerWriter: opts.LoggerWriter, ServerLogger: newContextLogger(c, logger), errorTranslators: opts.ErrorTranslators, logFormat: opts.LogFormat, policyResolver: opts.PolicyResolver}
+			sctx.requestLogger = newRequestScopedLogger(c, logger, opts.RequestLogger.TraceIDHeader)
+			req := c.Request()
+			c.SetRequest(req.WithContext(sctx.requestLogger.WithContext(req.Context())))
 			return next(sctx)
 		}
 	})
-	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
-		LogMethod:       true,
-		LogURI:          true,
-		LogStatus:       true,
-		LogError:        true,
-		LogLatency:      true,
-		LogResponseSize: true,
-		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
-			sctx := c.(*Context)
-			evt := sctx.ServerLogger.Info()
-			if v.Error != nil {
-				evt = sctx.ServerLogger.Error()
-			}
-
-			evt = evt.Int("status", v.Status).Err(v.Error).Str("latency", v.Latency.String())
-			if v.RequestID != "" {
-				evt = evt.Str("request_id", v.RequestID)
-			}
-			if v.ResponseSize > 0 {
-				evt = evt.Str("size", humanize.Bytes(uint64(v.ResponseSize)))
-			}
-
-			evt.Msg("request")
-			return nil
-		},
-	}))
-	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) (returnErr error) {
-			defer func() {
-				if r := recover(); r != nil {
-					if r == http.ErrAbortHandler {
-						panic(r)
-					}
-
-					err, ok := r.(error)
-					if !ok {
-						err = fmt.Errorf("%v", r)
-					}
-
-					opts.Logger.Error().Err(err).Msg("recovery handler")
-					returnErr = err
-				}
-			}()
-			return next(c)
+	e.Use(newRequestLogger(opts.RequestLogger))
+	if opts.Metrics != nil {
+		e.Use(newRequestMetrics(*opts.Metrics))
+	}
+	if opts.SlowRequestThreshold > 0 {
+		e.Use(newSlowRequestLogger(opts.SlowRequestThreshold, logLevels.Logger))
+	}
+	e.Use(newRecoverer(opts.Recover, logLevels.Logger, opts.ErrorReporter))
+	if opts.BasicAuth != nil {
+		e.Use(BasicAuthWithOptions(*opts.BasicAuth))
+	}
+	if opts.CSRF != nil {
+		e.Use(CSRFWithOptions(*opts.CSRF))
+	}
+	if opts.Compression != nil {
+		e.Use(CompressWithOptions(*opts.Compression))
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	e.Use(newTimeoutMiddleware(e, opts.Timeout, opts.TimeoutResponse))
+	e.Use(opts.Middleware...)
+	if opts.BuildInfo != nil {
+		path := opts.BuildInfo.Path
+		if path == "" {
+			path = defaultBuildInfoPath
 		}
-	})
-	e.Use(middleware.TimeoutWithConfig(middleware.TimeoutConfig{
-		Skipper: middleware.DefaultSkipper,
-		Timeout: 30 * time.Second,
-	}))
+		e.GET(path, BuildInfoHandler(*opts.BuildInfo))
+	}
+	if opts.Health != nil {
+		registerHealthRoutes(e, *opts.Health)
+	}
 
 	return e
 }
 
+// isStreamingRequest reports whether the request asks for a protocol upgrade, e.g. to websocket,
+// or for server-sent events. These responses are long-lived and can't be wrapped by the timeout
+// middleware.
+func isStreamingRequest(c echo.Context) bool {
+	req := c.Request()
+	return req.Header.Get(echo.HeaderUpgrade) != "" || strings.Contains(req.Header.Get(echo.HeaderAccept), mimeTextEventStream)
+}
+
+// TrailingSlashMode selects how trailing slashes of request paths are handled.
+type TrailingSlashMode int
+
+const (
+	// TrailingSlashStrip removes trailing slashes before routing, so /users/ is handled by the
+	// /users route.
+	TrailingSlashStrip TrailingSlashMode = iota
+	// TrailingSlashRedirect redirects paths with a trailing slash to the path without it with a
+	// 301.
+	TrailingSlashRedirect
+	// TrailingSlashKeep routes paths as they are, e.g. for signed URLs covering the exact path.
+	TrailingSlashKeep
+)
+
 type StartOptions struct {
 	GracefulShutdownTimeout time.Duration
+	// TLS serves https instead of plain http.
+	TLS *TLSOptions
+	// H2C serves HTTP/2 over cleartext connections. It is ignored when TLS is set.
+	H2C bool
+	// GRPC, if set, is served on the same port as the server, e.g. a *grpc.Server. HTTP/2
+	// requests with a gRPC content type are routed to it and all other requests to the server.
+	// Without TLS the port speaks h2c, as if H2C was set.
+	GRPC http.Handler
+	// HTTP2 tunes the HTTP/2 server used for TLS and h2c connections.
+	HTTP2 *HTTP2Options
+	// Admin starts a second, private listener exposing pprof, expvar, runtime and drain endpoints.
+	Admin *AdminOptions
+	// Lifecycle holds the startup and shutdown hooks of the components used by the server.
+	Lifecycle *Lifecycle
+	// Listener, if set, is served instead of listening on the port, e.g. a listener created by a
+	// test or a supervisor.
+	Listener net.Listener
+	// UnixSocketPath, if set, serves on a Unix socket instead of the TCP port, e.g. behind a local
+	// reverse proxy.
+	UnixSocketPath string
+	// Listeners are additional listeners the server is served on at the same time, e.g. a public
+	// TLS listener next to a plain internal one. They start and shut down together with the main
+	// listener, and the server shuts down if any of them fails.
+	Listeners []ListenerOptions
+	// SocketActivation serves the socket passed by systemd socket activation, if any, instead of
+	// listening on the port. Starting fails if more than one socket is passed, use
+	// SystemdListeners with Listener and Listeners to serve several sockets.
+	SocketActivation bool
+	// DrainDelay is how long Drain waits between failing readiness checks and shutting down,
+	// typically the deregistration delay of the load balancer.
+	DrainDelay time.Duration
 }
 
 func Start(ctx context.Context, e *echo.Echo, port int) error {
@@ -117,22 +282,133 @@ func Start(ctx context.Context, e *echo.Echo, port int) error {
 }
 
 func StartWithOptions(ctx context.Context, e *echo.Echo, port int, opts StartOptions) error {
+	if opts.GracefulShutdownTimeout <= 0 {
+		opts.GracefulShutdownTimeout = 10 * time.Second
+	}
+	if opts.Lifecycle == nil {
+		opts.Lifecycle = NewLifecycle()
+	}
+
+	ctx, shutdown := context.WithCancel(ctx)
+	defer shutdown()
+
+	var httpServer *http.Server
+	if opts.TLS != nil {
+		tlsConfig, httpHandler, err := newTLSConfig(opts.TLS, port)
+		if err != nil {
+			return err
+		}
+
+		e.TLSServer.Addr = fmt.Sprintf(":%d", port)
+		e.TLSServer.TLSConfig = tlsConfig
+		if !e.DisableHTTP2 {
+			if err := http2.ConfigureServer(e.TLSServer, newHTTP2Server(opts.HTTP2)); err != nil {
+				return err
+			}
+		}
+		if httpHandler != nil {
+			httpServer = &http.Server{Addr: httpRedirectAddr(opts.TLS), Handler: httpHandler, ReadHeaderTimeout: 10 * time.Second}
+		}
+	}
+
+	if err := setupListener(e, &opts, e.TLSServer.TLSConfig); err != nil {
+		return err
+	}
+
+	extraServers, err := newExtraServers(e, &opts)
+	if err != nil {
+		return err
+	}
+
+	started, err := opts.Lifecycle.start(ctx, e.Logger)
+	if err != nil {
+		for _, s := range extraServers {
+			s.listener.Close()
+		}
+		return err
+	}
+
+	if opts.Admin != nil {
+		if err := startAdmin(ctx, e, opts.Admin, opts.GracefulShutdownTimeout); err != nil {
+			opts.Lifecycle.stop(context.Background(), e.Logger, started)
+			return err
+		}
+	}
+
+	var stopOnce sync.Once
+	stopHooks := func() {
+		stopOnce.Do(func() {
+			opts.Lifecycle.stop(context.Background(), e.Logger, started)
+		})
+	}
+
+	shutdownDone := make(chan struct{})
+	getServerState(e).started(opts.DrainDelay, shutdown, shutdownDone)
 	go func() {
+		defer close(shutdownDone)
 		<-ctx.Done()
 
+		state := getServerState(e)
+		state.beginShutdown()
 		ctx, cancel := context.WithTimeout(context.Background(), opts.GracefulShutdownTimeout)
 		defer cancel()
 
-		if err := e.Shutdown(ctx); err != nil {
-			e.Logger.Fatal(err)
+		if httpServer != nil {
+			_ = httpServer.Shutdown(ctx)
+		}
+		for _, s := range extraServers {
+			_ = s.server.Shutdown(ctx)
 		}
+		err := e.Shutdown(ctx)
+		if err == nil {
+			err = state.waitConnections(ctx)
+		}
+		if err != nil {
+			e.Logger.Error(err)
+			if errors.Is(err, context.DeadlineExceeded) {
+				opts.Lifecycle.shutdownTimedOut()
+			}
+		}
+		stopHooks()
 	}()
 
-	if err := e.Start(fmt.Sprintf(":%d", port)); err != nil && err != http.ErrServerClosed {
+	if httpServer != nil {
+		go func() {
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				e.Logger.Error(err)
+			}
+		}()
+	}
+	var extraErr error
+	var extraErrOnce sync.Once
+	for _, s := range extraServers {
+		go func() {
+			if err := s.server.Serve(s.listener); err != nil && err != http.ErrServerClosed {
+				e.Logger.Error(err)
+				extraErrOnce.Do(func() {
+					extraErr = err
+				})
+				shutdown()
+			}
+		}()
+	}
+
+	if opts.GRPC != nil {
+		err = startGRPCMultiplexed(e, port, &opts)
+	} else if opts.TLS != nil {
+		err = e.StartServer(e.TLSServer)
+	} else if opts.H2C {
+		err = e.StartH2CServer(fmt.Sprintf(":%d", port), newHTTP2Server(opts.HTTP2))
+	} else {
+		err = e.Start(fmt.Sprintf(":%d", port))
+	}
+	if err != nil && err != http.ErrServerClosed {
+		stopHooks()
 		return err
 	}
 
-	return nil
+	<-shutdownDone
+	return extraErr
 }
 
 type Router interface {
@@ -157,58 +433,8 @@ func AddSubRouter(r Router, path string, subRouterFn func(r Router)) {
 	subRouterFn(sr)
 }
 
-func newErrorHandler(e *echo.Echo, logger *zerolog.Logger, onHttpError OnHttpErrorHandler) echo.HTTPErrorHandler {
-	return func(err error, c echo.Context) {
-		if c.Response().Committed {
-			return
-		}
-
-		he, ok := err.(*echo.HTTPError)
-		if ok {
-			if he.Internal != nil {
-				if herr, ok := he.Internal.(*echo.HTTPError); ok {
-					he = herr
-				}
-			}
-		} else {
-			he = echo.NewHTTPError(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
-		}
-
-		if onHttpError != nil {
-			onHttpError(c, he)
-		}
-
-		code := he.Code
-		message := he.Message
-
-		switch m := message.(type) {
-		case string:
-			if e.Debug {
-				message = echo.Map{"error": m, "description": err.Error()}
-			} else {
-				message = echo.Map{"error": m}
-			}
-		case json.Marshaler:
-			message = echo.Map{"error": m}
-		case error:
-			message = echo.Map{"error": m.Error()}
-		}
-
-		if c.Request().Method == http.MethodHead {
-			err = c.NoContent(he.Code)
-		} else {
-			err = c.JSON(code, message)
-		}
-
-		logger = newContextLogger(c, logger)
-		if err != nil {
-			logger.Error().Err(err).Msg("error handler")
-		}
-	}
-}
-
 func newContextLogger(c echo.Context, logger *zerolog.Logger) *zerolog.Logger {
-	requestId := c.Request().Header.Get(echo.HeaderXRequestID)
+	requestId := RequestID(c)
 	loggerBuilder := logger.With().Str("method", c.Request().Method).Str("uri", c.Request().RequestURI)
 	if requestId != "" {
 		loggerBuilder = loggerBuilder.Str("request_id", requestId)
@@ -216,3 +442,27 @@ func newContextLogger(c echo.Context, logger *zerolog.Logger) *zerolog.Logger {
 	loggerStruct := loggerBuilder.Logger()
 	return &loggerStruct
 }
+
+// newRequestScopedLogger returns the logger returned by Logger.
+func newRequestScopedLogger(c echo.Context, logger *zerolog.Logger, traceIDHeader string) *zerolog.Logger {
+	if traceIDHeader == "" {
+		traceIDHeader = headerTraceparent
+	}
+
+	loggerBuilder := logger.With().Str("method", c.Request().Method)
+	if requestId := RequestID(c); requestId != "" {
+		loggerBuilder = loggerBuilder.Str("request_id", requestId)
+	}
+	if route := c.Path(); route != "" {
+		loggerBuilder = loggerBuilder.Str("route", route)
+	}
+	traceID, spanID := extractTraceIDs(c.Request(), traceIDHeader)
+	if traceID != "" {
+		loggerBuilder = loggerBuilder.Str("trace_id", traceID)
+	}
+	if spanID != "" {
+		loggerBuilder = loggerBuilder.Str("span_id", spanID)
+	}
+	loggerStruct := loggerBuilder.Logger()
+	return &loggerStruct
+}
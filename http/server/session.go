@@ -0,0 +1,435 @@
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	sessionContextKey = "golib.server.session"
+
+	defaultSessionCookieName      = "session"
+	defaultSessionIdleTimeout     = 30 * time.Minute
+	defaultSessionAbsoluteTimeout = 24 * time.Hour
+	minSessionKeyLength           = 32
+	maxSessionCookieSize          = 4096
+)
+
+var (
+	errInvalidSessionCookie = errors.New("invalid session cookie")
+)
+
+type SessionOptions struct {
+	Skipper middleware.Skipper
+	// Store keeps sessions server-side. If nil, sessions are kept in an encrypted cookie, which
+	// limits their size to about 4KB and means destroyed or rotated sessions can't be revoked
+	// before they expire.
+	Store SessionStore
+	// Keys sign and encrypt the session cookie. The first key is used for new cookies, all keys
+	// are tried when reading cookies, which allows rotating keys without logging everyone out.
+	// Keys must be at least 32 bytes long.
+	Keys [][]byte
+	// CookieName defaults to "session".
+	CookieName     string
+	CookieDomain   string
+	CookiePath     string
+	CookieSecure   bool
+	CookieSameSite http.SameSite
+	// IdleTimeout expires sessions that haven't been used for the given duration. Defaults to
+	// 30m.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout expires sessions the given duration after they were created, regardless of
+	// activity. Defaults to 24h.
+	AbsoluteTimeout time.Duration
+}
+
+// Session holds the values of a browser session. Changes are saved when the response is written.
+type Session struct {
+	id        string
+	record    sessionRecord
+	isNew     bool
+	modified  bool
+	destroyed bool
+	// staleID is the ID of a rotated or expired session that should be removed from the store.
+	staleID string
+}
+
+type sessionRecord struct {
+	ID         string                     `json:"id,omitempty"`
+	Values     map[string]json.RawMessage `json:"values"`
+	CreatedAt  time.Time                  `json:"created_at"`
+	LastSeenAt time.Time                  `json:"last_seen_at"`
+}
+
+func (s *Session) ID() string {
+	return s.id
+}
+
+// IsNew reports whether the session was created by this request.
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+func (s *Session) CreatedAt() time.Time {
+	return s.record.CreatedAt
+}
+
+// Get decodes the value stored under key into v. It returns false if there is no such value.
+func (s *Session) Get(key string, v any) (bool, error) {
+	raw, ok := s.record.Values[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// Set stores v, which must be JSON serializable, under key.
+func (s *Session) Set(key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if s.record.Values == nil {
+		s.record.Values = make(map[string]json.RawMessage)
+	}
+	s.record.Values[key] = raw
+	s.modified = true
+	return nil
+}
+
+func (s *Session) Delete(key string) {
+	if _, ok := s.record.Values[key]; ok {
+		delete(s.record.Values, key)
+		s.modified = true
+	}
+}
+
+// Clear removes all values but keeps the session.
+func (s *Session) Clear() {
+	if len(s.record.Values) > 0 {
+		s.record.Values = nil
+		s.modified = true
+	}
+}
+
+// Rotate gives the session a new ID while keeping its values. It should be called whenever the
+// privilege level changes, e.g. on login, to prevent session fixation.
+func (s *Session) Rotate() {
+	if !s.isNew && s.staleID == "" {
+		s.staleID = s.id
+	}
+	s.id = newSessionID()
+	s.modified = true
+}
+
+// Destroy removes the session and its cookie, e.g. on logout.
+func (s *Session) Destroy() {
+	s.destroyed = true
+	s.record.Values = nil
+}
+
+// GetSession returns the session of the request, or nil if the session middleware isn't used.
+func GetSession(c echo.Context) *Session {
+	s, _ := c.Get(sessionContextKey).(*Session)
+	return s
+}
+
+// Session returns the session of the request, or nil if the session middleware isn't used.
+func (c *Context) Session() *Session {
+	return GetSession(c)
+}
+
+// SessionValue returns the session value stored under key. It returns false if there is no
+// session, no such value or the value can't be decoded into T.
+func SessionValue[T any](c echo.Context, key string) (T, bool) {
+	var v T
+	s := GetSession(c)
+	if s == nil {
+		return v, false
+	}
+	ok, err := s.Get(key, &v)
+	return v, ok && err == nil
+}
+
+// SetSessionValue stores v in the session under key.
+func SetSessionValue(c echo.Context, key string, v any) error {
+	s := GetSession(c)
+	if s == nil {
+		return errors.New("session: session middleware not configured")
+	}
+	return s.Set(key, v)
+}
+
+// Sessions returns a middleware attaching a session to every request. See GetSession and
+// SessionValue.
+func Sessions(opts SessionOptions) echo.MiddlewareFunc {
+	if len(opts.Keys) == 0 {
+		panic("server: session middleware requires at least one key")
+	}
+	for _, key := range opts.Keys {
+		if len(key) < minSessionKeyLength {
+			panic("server: session keys must be at least 32 bytes long")
+		}
+	}
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = defaultSessionCookieName
+	}
+	if opts.CookiePath == "" {
+		opts.CookiePath = "/"
+	}
+	if opts.CookieSameSite == 0 {
+		opts.CookieSameSite = http.SameSiteLaxMode
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultSessionIdleTimeout
+	}
+	if opts.AbsoluteTimeout <= 0 {
+		opts.AbsoluteTimeout = defaultSessionAbsoluteTimeout
+	}
+
+	sm := &sessionManager{opts: opts}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if opts.Skipper(c) {
+				return next(c)
+			}
+
+			s, hadCookie, err := sm.load(c)
+			if err != nil {
+				return err
+			}
+			c.Set(sessionContextKey, s)
+			committed := false
+			commit := func() {
+				if committed {
+					return
+				}
+				committed = true
+				if err := sm.commit(c, s, hadCookie); err != nil {
+					c.Logger().Errorf("session: %v", err)
+				}
+			}
+			c.Response().Before(commit)
+
+			err = next(c)
+			// Handlers that don't write a response still get an implicit 200 from net/http.
+			if err == nil && !c.Response().Committed {
+				commit()
+			}
+			return err
+		}
+	}
+}
+
+type sessionManager struct {
+	opts SessionOptions
+}
+
+func (sm *sessionManager) load(c echo.Context) (*Session, bool, error) {
+	now := time.Now()
+	s := &Session{id: newSessionID(), isNew: true, record: sessionRecord{CreatedAt: now, LastSeenAt: now}}
+
+	cookie, err := c.Cookie(sm.opts.CookieName)
+	if err != nil || cookie.Value == "" {
+		return s, false, nil
+	}
+
+	id, record, err := sm.decode(c, cookie.Value)
+	if errors.Is(err, errInvalidSessionCookie) || errors.Is(err, ErrSessionNotFound) {
+		return s, true, nil
+	} else if err != nil {
+		return nil, true, err
+	}
+
+	if now.Sub(record.LastSeenAt) > sm.opts.IdleTimeout || now.Sub(record.CreatedAt) > sm.opts.AbsoluteTimeout {
+		s.staleID = id
+		return s, true, nil
+	}
+	return &Session{id: id, record: record}, true, nil
+}
+
+func (sm *sessionManager) commit(c echo.Context, s *Session, hadCookie bool) error {
+	ctx := c.Request().Context()
+	if sm.opts.Store != nil && s.staleID != "" {
+		if err := sm.opts.Store.Delete(ctx, s.staleID); err != nil {
+			return err
+		}
+	}
+
+	if s.destroyed {
+		if sm.opts.Store != nil && !s.isNew {
+			if err := sm.opts.Store.Delete(ctx, s.id); err != nil {
+				return err
+			}
+		}
+		if hadCookie {
+			c.SetCookie(sm.cookie("", -1))
+		}
+		return nil
+	}
+
+	now := time.Now()
+	// Unmodified sessions are only touched now and then to extend their idle timeout.
+	touch := !s.isNew && now.Sub(s.record.LastSeenAt) > sm.opts.IdleTimeout/10
+	if !s.modified && !touch {
+		if s.isNew && hadCookie {
+			c.SetCookie(sm.cookie("", -1))
+		}
+		return nil
+	}
+
+	s.record.LastSeenAt = now
+	ttl := min(sm.opts.IdleTimeout, s.record.CreatedAt.Add(sm.opts.AbsoluteTimeout).Sub(now))
+	value, err := sm.encode(c, s, ttl)
+	if err != nil {
+		return err
+	}
+	if len(value) > maxSessionCookieSize {
+		return errors.New("session cookie exceeds 4KB, use a session store")
+	}
+	c.SetCookie(sm.cookie(value, int(ttl.Seconds())))
+	return nil
+}
+
+func (sm *sessionManager) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     sm.opts.CookieName,
+		Value:    value,
+		Path:     sm.opts.CookiePath,
+		Domain:   sm.opts.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   sm.opts.CookieSecure,
+		HttpOnly: true,
+		SameSite: sm.opts.CookieSameSite,
+	}
+}
+
+// encode stores the session and returns the cookie value. Without a store the cookie carries the
+// encrypted session, otherwise it carries the signed session ID.
+func (sm *sessionManager) encode(c echo.Context, s *Session, ttl time.Duration) (string, error) {
+	s.record.ID = s.id
+	data, err := json.Marshal(s.record)
+	if err != nil {
+		return "", err
+	}
+
+	key := sm.opts.Keys[0]
+	if sm.opts.Store == nil {
+		return encryptSessionCookie(key, sm.opts.CookieName, data)
+	}
+	if err := sm.opts.Store.Save(c.Request().Context(), s.id, data, ttl); err != nil {
+		return "", err
+	}
+	return s.id + "." + signSessionID(key, sm.opts.CookieName, s.id), nil
+}
+
+func (sm *sessionManager) decode(c echo.Context, value string) (string, sessionRecord, error) {
+	var record sessionRecord
+	if sm.opts.Store == nil {
+		for _, key := range sm.opts.Keys {
+			data, err := decryptSessionCookie(key, sm.opts.CookieName, value)
+			if err != nil {
+				continue
+			}
+			if err := json.Unmarshal(data, &record); err != nil {
+				return "", record, errInvalidSessionCookie
+			}
+			if record.ID == "" {
+				return "", record, errInvalidSessionCookie
+			}
+			return record.ID, record, nil
+		}
+		return "", record, errInvalidSessionCookie
+	}
+
+	id, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return "", record, errInvalidSessionCookie
+	}
+	valid := false
+	for _, key := range sm.opts.Keys {
+		if hmac.Equal([]byte(signature), []byte(signSessionID(key, sm.opts.CookieName, id))) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "", record, errInvalidSessionCookie
+	}
+
+	data, err := sm.opts.Store.Load(c.Request().Context(), id)
+	if err != nil {
+		return "", record, err
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return "", record, errInvalidSessionCookie
+	}
+	return id, record, nil
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signSessionID(key []byte, name, id string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + "|" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newSessionCipher(key []byte) (cipher.AEAD, error) {
+	aesKey := sha256.Sum256(key)
+	block, err := aes.NewCipher(aesKey[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSessionCookie encrypts data with AES-GCM. The cookie name is authenticated so that the
+// value can't be moved to another cookie.
+func encryptSessionCookie(key []byte, name string, data []byte) (string, error) {
+	aead, err := newSessionCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, data, []byte(name))), nil
+}
+
+func decryptSessionCookie(key []byte, name, value string) ([]byte, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newSessionCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) < aead.NonceSize() {
+		return nil, errInvalidSessionCookie
+	}
+	return aead.Open(nil, bs[:aead.NonceSize()], bs[aead.NonceSize():], []byte(name))
+}
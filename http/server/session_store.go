@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisSessionPrefix = "session:"
+)
+
+var (
+	// ErrSessionNotFound is returned by a SessionStore when the session doesn't exist or has
+	// expired.
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// SessionStore stores encoded sessions server-side. The session cookie then only carries the
+// signed session ID.
+type SessionStore interface {
+	Load(ctx context.Context, id string) ([]byte, error)
+	// Save stores the session, replacing the existing one. The store may drop the session after
+	// ttl.
+	Save(ctx context.Context, id string, data []byte, ttl time.Duration) error
+	Delete(ctx context.Context, id string) error
+}
+
+// MemorySessionStore is a SessionStore keeping sessions in memory. Sessions are lost on restart
+// and not shared between instances, which makes it mostly useful for development and tests.
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]memorySession), lastSweep: time.Now()}
+}
+
+func (s *MemorySessionStore) Load(ctx context.Context, id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok || time.Now().After(sess.expiresAt) {
+		return nil, ErrSessionNotFound
+	}
+	return sess.data, nil
+}
+
+func (s *MemorySessionStore) Save(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sessions[id] = memorySession{data: data, expiresAt: now.Add(ttl)}
+	// Expired sessions are only swept now and then to keep Save cheap.
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, sess := range s.sessions {
+			if now.After(sess.expiresAt) {
+				delete(s.sessions, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
+
+type redisSessionStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisSessionStore returns a SessionStore keeping sessions in Redis under keys with the
+// given prefix. The prefix defaults to "session:".
+func NewRedisSessionStore(client redis.UniversalClient, prefix string) SessionStore {
+	if prefix == "" {
+		prefix = defaultRedisSessionPrefix
+	}
+	return &redisSessionStore{client: client, prefix: prefix}
+}
+
+func (s *redisSessionStore) Load(ctx context.Context, id string) ([]byte, error) {
+	data, err := s.client.Get(ctx, s.prefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionNotFound
+	}
+	return data, err
+}
+
+func (s *redisSessionStore) Save(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+id, data, ttl).Err()
+}
+
+func (s *redisSessionStore) Delete(ctx context.Context, id string) error {
+	return s.client.Del(ctx, s.prefix+id).Err()
+}
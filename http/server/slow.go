@@ -0,0 +1,61 @@
+package server
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+// newSlowRequestLogger logs a warning for every request whose handling takes longer than
+// threshold. The log line includes the route, path params and a latency breakdown into the time
+// until the response header was written and the time spent writing the body.
+func newSlowRequestLogger(threshold time.Duration, logger func() *zerolog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			var headerWritten time.Time
+			c.Response().Before(func() {
+				headerWritten = time.Now()
+			})
+
+			err := next(c)
+
+			latency := time.Since(start)
+			if latency < threshold {
+				return err
+			}
+
+			var reqLogger *zerolog.Logger
+			if sctx, ok := c.(*Context); ok {
+				reqLogger = sctx.ServerLogger
+			} else {
+				reqLogger = logger()
+			}
+
+			evt := reqLogger.Warn().
+				Str("route", c.Path()).
+				Str("latency", latency.String()).
+				Str("threshold", threshold.String())
+			if names := c.ParamNames(); len(names) > 0 {
+				params := zerolog.Dict()
+				for i, value := range c.ParamValues() {
+					if i < len(names) {
+						params = params.Str(names[i], value)
+					}
+				}
+				evt = evt.Dict("params", params)
+			}
+			if !headerWritten.IsZero() {
+				evt = evt.
+					Str("time_to_header", headerWritten.Sub(start).String()).
+					Str("time_writing_body", (latency - headerWritten.Sub(start)).String())
+			}
+			if err != nil {
+				evt = evt.Err(err)
+			}
+			evt.Int("status", c.Response().Status).Msg("slow request")
+			return err
+		}
+	}
+}
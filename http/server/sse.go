@@ -0,0 +1,288 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	mimeTextEventStream = "text/event-stream"
+	headerLastEventID   = "Last-Event-ID"
+
+	defaultSSEBufferSize        = 32
+	defaultSSEHeartbeatInterval = 15 * time.Second
+	defaultSSEShutdownRetry     = 5 * time.Second
+)
+
+var (
+	// ErrSSEInvalidField is returned by SSEWriter.Send for IDs and event names containing line
+	// breaks, which would inject fields or events.
+	ErrSSEInvalidField = errors.New("server-sent event id and event must not contain line breaks")
+)
+
+// SSEEvent is a single server-sent event. Only Data is required.
+type SSEEvent struct {
+	ID    string
+	Event string
+	// Data is sent as one data field per line. CRLF, CR and LF all break lines.
+	Data []byte
+	// Retry tells the client how long to wait before reconnecting.
+	Retry time.Duration
+}
+
+// SSEWriter writes server-sent events to a response, flushing after every event. It is safe for
+// concurrent use.
+type SSEWriter struct {
+	c  echo.Context
+	mu sync.Mutex
+}
+
+// SSE starts a server-sent events response.
+func SSE(c echo.Context) (*SSEWriter, error) {
+	res := c.Response()
+	header := res.Header()
+	header.Set(echo.HeaderContentType, mimeTextEventStream)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	if err := http.NewResponseController(res).Flush(); err != nil {
+		return nil, err
+	}
+	return &SSEWriter{c: c}, nil
+}
+
+// LastEventID returns the ID of the last event the client received before reconnecting.
+func (w *SSEWriter) LastEventID() string {
+	return w.c.Request().Header.Get(headerLastEventID)
+}
+
+// ShuttingDown returns a channel that is closed when the server starts shutting down, after
+// which the handler should send its final events and return. See ShutdownNotify.
+func (w *SSEWriter) ShuttingDown() <-chan struct{} {
+	return ShutdownNotify(w.c)
+}
+
+// Send sends evt and flushes it. IDs and event names with line breaks are rejected with
+// ErrSSEInvalidField.
+func (w *SSEWriter) Send(evt SSEEvent) error {
+	if strings.ContainsAny(evt.ID, "\r\n") || strings.ContainsAny(evt.Event, "\r\n") {
+		return ErrSSEInvalidField
+	}
+
+	var buf bytes.Buffer
+	if evt.ID != "" {
+		fmt.Fprintf(&buf, "id: %s\n", evt.ID)
+	}
+	if evt.Event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", evt.Event)
+	}
+	if evt.Retry > 0 {
+		fmt.Fprintf(&buf, "retry: %s\n", strconv.FormatInt(evt.Retry.Milliseconds(), 10))
+	}
+	for _, line := range bytes.Split(normalizeSSELineBreaks(evt.Data), []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return w.write(buf.Bytes())
+}
+
+// SendData sends an unnamed event with the given data.
+func (w *SSEWriter) SendData(data string) error {
+	return w.Send(SSEEvent{Data: []byte(data)})
+}
+
+// SendJSON sends an event with v encoded as JSON as data.
+func (w *SSEWriter) SendJSON(event string, v any) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return w.Send(SSEEvent{Event: event, Data: bs})
+}
+
+// Comment sends a comment, which clients ignore. It is used for heartbeats. Line breaks in text
+// start new comment lines.
+func (w *SSEWriter) Comment(text string) error {
+	text = string(normalizeSSELineBreaks([]byte(text)))
+	return w.write([]byte(": " + strings.ReplaceAll(text, "\n", "\n: ") + "\n\n"))
+}
+
+// normalizeSSELineBreaks replaces the line breaks of event streams, CRLF and CR, with LF.
+func normalizeSSELineBreaks(b []byte) []byte {
+	if !bytes.ContainsRune(b, '\r') {
+		return b
+	}
+	return bytes.ReplaceAll(bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n")), []byte("\r"), []byte("\n"))
+}
+
+// StartHeartbeat sends a comment every interval to keep intermediaries from closing an idle
+// connection. The returned function stops the heartbeat.
+func (w *SSEWriter) StartHeartbeat(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = defaultSSEHeartbeatInterval
+	}
+
+	done := make(chan struct{})
+	ctx := w.c.Request().Context()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.Comment("heartbeat"); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func (w *SSEWriter) write(bs []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	res := w.c.Response()
+	if _, err := res.Write(bs); err != nil {
+		return err
+	}
+	return http.NewResponseController(res).Flush()
+}
+
+type BrokerOptions struct {
+	// BufferSize is the number of events buffered per client. Clients whose buffer is full are
+	// evicted. Defaults to 32.
+	BufferSize int
+	// HeartbeatInterval is the interval heartbeats are sent at. Defaults to 15s.
+	HeartbeatInterval time.Duration
+	// ShutdownEvent is sent to every client after its buffered events when the server shuts
+	// down. Defaults to a "shutdown" event asking the client to reconnect after 5s.
+	ShutdownEvent *SSEEvent
+}
+
+// Broker fans out published events to all subscribed SSE clients.
+type Broker struct {
+	opts    BrokerOptions
+	mu      sync.RWMutex
+	clients map[*sseClient]struct{}
+}
+
+type sseClient struct {
+	events  chan SSEEvent
+	evicted chan struct{}
+	once    sync.Once
+}
+
+func (sc *sseClient) evict() {
+	sc.once.Do(func() { close(sc.evicted) })
+}
+
+func NewBroker(opts BrokerOptions) *Broker {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultSSEBufferSize
+	}
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = defaultSSEHeartbeatInterval
+	}
+	if opts.ShutdownEvent == nil {
+		opts.ShutdownEvent = &SSEEvent{Event: "shutdown", Data: []byte("server shutting down"), Retry: defaultSSEShutdownRetry}
+	}
+	return &Broker{opts: opts, clients: make(map[*sseClient]struct{})}
+}
+
+// Publish sends the event to all subscribed clients without blocking. Slow clients whose buffer
+// is full are evicted.
+func (b *Broker) Publish(evt SSEEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for client := range b.clients {
+		select {
+		case client.events <- evt:
+		default:
+			client.evict()
+		}
+	}
+}
+
+// Count returns the number of subscribed clients.
+func (b *Broker) Count() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.clients)
+}
+
+// Handler returns a handler that subscribes the requesting client to the broker.
+func (b *Broker) Handler() echo.HandlerFunc {
+	return b.Serve
+}
+
+// Serve subscribes the requesting client to the broker and streams events to it until the
+// client disconnects or is evicted, or the server shuts down.
+func (b *Broker) Serve(c echo.Context) error {
+	w, err := SSE(c)
+	if err != nil {
+		return err
+	}
+
+	client := &sseClient{events: make(chan SSEEvent, b.opts.BufferSize), evicted: make(chan struct{})}
+	b.mu.Lock()
+	b.clients[client] = struct{}{}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, client)
+		b.mu.Unlock()
+	}()
+
+	stop := w.StartHeartbeat(b.opts.HeartbeatInterval)
+	defer stop()
+
+	ctx := c.Request().Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-client.evicted:
+			return nil
+		case <-w.ShuttingDown():
+			for {
+				select {
+				case evt := <-client.events:
+					if err := w.Send(evt); err != nil {
+						return nil
+					}
+					continue
+				default:
+				}
+				_ = w.Send(*b.opts.ShutdownEvent)
+				return nil
+			}
+		case evt := <-client.events:
+			if err := w.Send(evt); err != nil {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"weak"
+
+	"github.com/gpahal/golib/health"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	serverStates = newObjectStates[echo.Echo](newServerState)
+	routeStates  = newObjectStates[echo.Route](func() *routeMeta { return &routeMeta{} })
+)
+
+// serverState is the state of a server that isn't part of echo.Echo: the draining state used by
+// Drain, the timeout and host registries and the components registered by NewWithOptions.
+type serverState struct {
+	inFlight atomic.Int64
+	draining atomic.Bool
+	// closing is closed when the server starts shutting down, which tells long-lived
+	// connections to finish. connections counts the hijacked ones, e.g. websockets, which
+	// http.Server.Shutdown doesn't wait for.
+	closing     chan struct{}
+	closeOnce   sync.Once
+	connections atomic.Int64
+
+	timeouts *timeoutRegistry
+	hosts    *hostRegistry
+
+	mu           sync.Mutex
+	drainDelay   time.Duration
+	shutdown     context.CancelFunc
+	shutdownDone <-chan struct{}
+	logLevels    *logLevelController
+	health       *health.Registry
+	loginPath    string
+}
+
+func newServerState() *serverState {
+	return &serverState{
+		closing:  make(chan struct{}),
+		timeouts: &timeoutRegistry{routes: make(map[string]time.Duration)},
+		hosts:    &hostRegistry{exact: make(map[string]struct{})},
+	}
+}
+
+func getServerState(e *echo.Echo) *serverState {
+	return serverStates.get(e)
+}
+
+// objectStates attaches state to objects owned by echo, e.g. servers and routes, which have no
+// field for it. Entries are keyed by weak pointers and removed once the object is garbage
+// collected, so building servers, e.g. in tests, doesn't leak. The state must not reference its
+// object, which would keep it alive.
+type objectStates[K, V any] struct {
+	m        sync.Map // map[weak.Pointer[K]]*V
+	newState func() *V
+}
+
+func newObjectStates[K, V any](newState func() *V) *objectStates[K, V] {
+	return &objectStates[K, V]{newState: newState}
+}
+
+// get returns the state of obj, creating it if needed.
+func (s *objectStates[K, V]) get(obj *K) *V {
+	key := weak.Make(obj)
+	if v, ok := s.m.Load(key); ok {
+		return v.(*V)
+	}
+	v, loaded := s.m.LoadOrStore(key, s.newState())
+	if !loaded {
+		runtime.AddCleanup(obj, func(key weak.Pointer[K]) { s.m.Delete(key) }, key)
+	}
+	return v.(*V)
+}
+
+// lookup returns the state of obj, if it has any.
+func (s *objectStates[K, V]) lookup(obj *K) (*V, bool) {
+	v, ok := s.m.Load(weak.Make(obj))
+	if !ok {
+		return nil, false
+	}
+	return v.(*V), true
+}
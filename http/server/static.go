@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	// defaultHashedAssetPattern matches file names containing a content hash, e.g.
+	// "main.3f9a2c1b.js" or "index-BxK2_d9a.css".
+	defaultHashedAssetPattern = regexp.MustCompile(`[.-][A-Za-z0-9_]{8,}\.[A-Za-z0-9]+$`)
+)
+
+type StaticOptions struct {
+	// Index is the file served for directory requests and as the SPA fallback. Defaults to
+	// index.html.
+	Index string
+	// SPAFallback serves the index file for unknown paths so that client-side routing works.
+	SPAFallback bool
+	// HashedAssetPattern matches file names that contain a content hash. Matching files are
+	// served with immutable cache headers.
+	HashedAssetPattern *regexp.Regexp
+	// MaxAge is the cache max-age for files that are not hashed. Defaults to 0, which makes
+	// clients revalidate using the ETag.
+	MaxAge time.Duration
+	// Middleware is applied to the static routes.
+	Middleware []echo.MiddlewareFunc
+}
+
+// ServeStatic serves files from fsys (e.g. an embed.FS or os.DirFS) under prefix.
+func ServeStatic(r Router, prefix string, fsys fs.FS, opts StaticOptions) {
+	if opts.Index == "" {
+		opts.Index = "index.html"
+	}
+	if opts.HashedAssetPattern == nil {
+		opts.HashedAssetPattern = defaultHashedAssetPattern
+	}
+
+	s := &staticServer{fsys: fsys, opts: opts}
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix != "" {
+		r.GET(prefix, s.handle, opts.Middleware...)
+		r.HEAD(prefix, s.handle, opts.Middleware...)
+	}
+	r.GET(prefix+"/*", s.handle, opts.Middleware...)
+	r.HEAD(prefix+"/*", s.handle, opts.Middleware...)
+}
+
+type staticServer struct {
+	fsys  fs.FS
+	opts  StaticOptions
+	etags sync.Map
+}
+
+func (s *staticServer) handle(c echo.Context) error {
+	name := strings.Trim(path.Clean("/"+c.Param("*")), "/")
+	if name == "" {
+		name = "."
+	}
+
+	err := s.serveFile(c, name, false)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if s.opts.SPAFallback && isSPARoute(c.Request(), name) {
+		err = s.serveFile(c, s.opts.Index, true)
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return echo.ErrNotFound
+}
+
+func (s *staticServer) serveFile(c echo.Context, name string, isIndex bool) error {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return s.serveFile(c, path.Join(name, s.opts.Index), true)
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		bs, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(bs)
+	}
+
+	etag, err := s.etag(name, fi, content)
+	if err != nil {
+		return err
+	}
+
+	header := c.Response().Header()
+	header.Set("ETag", etag)
+	switch {
+	case isIndex || name == s.opts.Index:
+		header.Set("Cache-Control", "no-cache")
+	case s.opts.HashedAssetPattern.MatchString(fi.Name()):
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	case s.opts.MaxAge > 0:
+		header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(s.opts.MaxAge.Seconds())))
+	default:
+		header.Set("Cache-Control", "no-cache")
+	}
+
+	http.ServeContent(c.Response(), c.Request(), fi.Name(), fi.ModTime(), content)
+	return nil
+}
+
+type staticETagKey struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (s *staticServer) etag(name string, fi fs.FileInfo, content io.ReadSeeker) (string, error) {
+	key := staticETagKey{name: name, size: fi.Size(), modTime: fi.ModTime()}
+	if etag, ok := s.etags.Load(key); ok {
+		return etag.(string), nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	s.etags.Store(key, etag)
+	return etag, nil
+}
+
+// isSPARoute reports whether a missing file should fall back to the index file. Requests for
+// paths that look like assets (have a file extension) still get a 404.
+func isSPARoute(req *http.Request, name string) bool {
+	if path.Ext(name) == "" {
+		return true
+	}
+	return strings.Contains(req.Header.Get(echo.HeaderAccept), echo.MIMETextHTML)
+}
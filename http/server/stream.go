@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultStreamHeartbeatInterval = 15 * time.Second
+)
+
+var (
+	// ErrStreamingUnsupported is returned when the response can't be flushed, typically because
+	// the route is subject to the server timeout, which buffers responses. Register streaming
+	// routes with StreamingRoute.
+	ErrStreamingUnsupported = errors.New("server: response streaming is not supported, register the route with StreamingRoute")
+)
+
+// FlushWriter writes to a response and flushes it, either after every write or periodically, so
+// that clients receive large responses while they are being produced. It is safe for concurrent
+// use.
+type FlushWriter struct {
+	res      *echo.Response
+	mu       sync.Mutex
+	pending  bool
+	lastSent time.Time
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewFlushWriter returns a FlushWriter for the response of c. With a positive interval writes are
+// flushed at most once per interval, otherwise after every write. Close must be called once the
+// response is complete. It returns ErrStreamingUnsupported if the response can't be flushed.
+func NewFlushWriter(c echo.Context, interval time.Duration) (*FlushWriter, error) {
+	res := c.Response()
+	if !canFlush(res.Writer) {
+		return nil, ErrStreamingUnsupported
+	}
+	res.Header().Set("X-Accel-Buffering", "no")
+
+	w := &FlushWriter{res: res, done: make(chan struct{}), lastSent: time.Now()}
+	if interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-w.done:
+					return
+				case <-ticker.C:
+					w.mu.Lock()
+					if w.pending {
+						w.flush()
+					}
+					w.mu.Unlock()
+				}
+			}
+		}()
+	} else {
+		w.once.Do(func() { close(w.done) })
+	}
+	return w, nil
+}
+
+func (w *FlushWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n, err := w.res.Write(b)
+	if err != nil {
+		return n, err
+	}
+	w.pending = true
+	select {
+	case <-w.done:
+		w.flush()
+	default:
+	}
+	return n, nil
+}
+
+// Flush flushes the written data immediately.
+func (w *FlushWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flush()
+}
+
+// Idle returns how long ago data was last flushed to the client.
+func (w *FlushWriter) Idle() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return time.Since(w.lastSent)
+}
+
+// Close stops the periodic flushing and flushes pending data.
+func (w *FlushWriter) Close() error {
+	w.once.Do(func() { close(w.done) })
+	w.Flush()
+	return nil
+}
+
+func (w *FlushWriter) flush() {
+	w.res.Flush()
+	w.pending = false
+	w.lastSent = time.Now()
+}
+
+type StreamOptions struct {
+	// FlushInterval batches flushes, see NewFlushWriter. Defaults to flushing after every
+	// element.
+	FlushInterval time.Duration
+	// HeartbeatInterval is the idle time after which whitespace is sent to keep intermediaries
+	// from closing the connection. Defaults to 15s.
+	HeartbeatInterval time.Duration
+}
+
+// StreamJSONArray writes the values received from ch as a JSON array, without buffering the
+// whole array. The array is closed once ch is closed. It stops with the request context's
+// error if the client goes away, so producers should stop sending when the context is done.
+// Since the status is sent before the first element, errors can't be reported to the client
+// once streaming started. The route must be registered with StreamingRoute.
+func StreamJSONArray[T any](c echo.Context, ch <-chan T) error {
+	return StreamJSONArrayWithOptions(c, ch, StreamOptions{})
+}
+
+func StreamJSONArrayWithOptions[T any](c echo.Context, ch <-chan T, opts StreamOptions) error {
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = defaultStreamHeartbeatInterval
+	}
+
+	w, err := NewFlushWriter(c, opts.FlushInterval)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	res.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte("[")); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	heartbeat := time.NewTicker(opts.HeartbeatInterval)
+	defer heartbeat.Stop()
+	enc := json.NewEncoder(w)
+	first := true
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-heartbeat.C:
+			if w.Idle() >= opts.HeartbeatInterval {
+				// Whitespace between array elements is valid JSON.
+				if _, err := w.Write([]byte("\n")); err != nil {
+					return err
+				}
+				w.Flush()
+			}
+		case v, ok := <-ch:
+			if !ok {
+				_, err := w.Write([]byte("]"))
+				return err
+			}
+			if !first {
+				if _, err := w.Write([]byte(",")); err != nil {
+					return err
+				}
+			}
+			first = false
+			if err := enc.Encode(v); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// canFlush reports whether the innermost response writer wrapped by w supports flushing.
+// Wrappers generally forward flushes, but the writer of the timeout middleware buffers the
+// response and can't be flushed.
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			_, ok := w.(http.Flusher)
+			return ok
+		}
+		w = u.Unwrap()
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	tenantContextKey = "golib.server.tenant"
+)
+
+var (
+	// ErrTenantNotFound should be returned by a TenantStore when the tenant is unknown. It results
+	// in a 404 response.
+	ErrTenantNotFound = errors.New("tenant not found")
+)
+
+type tenantCtxKey struct{}
+
+// Tenant is the tenant a request is made for.
+type Tenant struct {
+	ID   string
+	Name string
+	// Metadata holds arbitrary additional information about the tenant, e.g. its plan.
+	Metadata map[string]any
+}
+
+// TenantStore resolves tenant identifiers to tenants.
+type TenantStore interface {
+	Lookup(ctx context.Context, id string) (*Tenant, error)
+}
+
+type TenantStoreFunc func(ctx context.Context, id string) (*Tenant, error)
+
+func (tsf TenantStoreFunc) Lookup(ctx context.Context, id string) (*Tenant, error) {
+	return tsf(ctx, id)
+}
+
+// StaticTenantStore returns a TenantStore backed by a fixed map of identifiers to tenants.
+func StaticTenantStore(tenants map[string]*Tenant) TenantStore {
+	return TenantStoreFunc(func(ctx context.Context, id string) (*Tenant, error) {
+		t, ok := tenants[id]
+		if !ok {
+			return nil, ErrTenantNotFound
+		}
+		return t, nil
+	})
+}
+
+// TenantExtractor returns the tenant identifier of a request, or "" if it carries none.
+type TenantExtractor func(c echo.Context) string
+
+// TenantFromSubdomain reads the tenant from the subdomain matched by a wildcard Host pattern, or
+// else from the first label of hosts with at least three labels, e.g. acme for
+// acme.example.com.
+func TenantFromSubdomain() TenantExtractor {
+	return func(c echo.Context) string {
+		if s := Subdomain(c); s != "" {
+			return s
+		}
+		labels := strings.Split(stripPort(c.Request().Host), ".")
+		if len(labels) < 3 {
+			return ""
+		}
+		return strings.ToLower(labels[0])
+	}
+}
+
+// TenantFromHeader reads the tenant from a request header, e.g. X-Tenant-ID.
+func TenantFromHeader(name string) TenantExtractor {
+	return func(c echo.Context) string {
+		return c.Request().Header.Get(name)
+	}
+}
+
+// TenantFromPrincipal reads the tenant from the TenantID of the principal, which authentication
+// middlewares typically fill from a token claim.
+func TenantFromPrincipal() TenantExtractor {
+	return func(c echo.Context) string {
+		if p, ok := GetPrincipal(c); ok {
+			return p.TenantID
+		}
+		return ""
+	}
+}
+
+type TenantOptions struct {
+	Skipper middleware.Skipper
+	Store   TenantStore
+	// Extractors are tried in order until one returns a tenant identifier.
+	Extractors []TenantExtractor
+	// Optional lets requests without a tenant identifier through instead of rejecting them with a
+	// 400 error.
+	Optional bool
+}
+
+// Tenancy returns a middleware resolving the tenant of every request, see GetTenant. Requests for
+// unknown tenants are rejected with a 404 error, and requests of principals belonging to another
+// tenant with a 403 error. The tenant ID is added to the request logs.
+func Tenancy(store TenantStore, extractors ...TenantExtractor) echo.MiddlewareFunc {
+	return TenancyWithOptions(TenantOptions{Store: store, Extractors: extractors})
+}
+
+func TenancyWithOptions(opts TenantOptions) echo.MiddlewareFunc {
+	if opts.Store == nil {
+		panic("server: tenancy middleware requires a tenant store")
+	}
+	if len(opts.Extractors) == 0 {
+		panic("server: tenancy middleware requires at least one tenant extractor")
+	}
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if opts.Skipper(c) {
+				return next(c)
+			}
+
+			var id string
+			for _, extract := range opts.Extractors {
+				if id = extract(c); id != "" {
+					break
+				}
+			}
+			if id == "" {
+				if opts.Optional {
+					return next(c)
+				}
+				return NewProblem(http.StatusBadRequest, "missing tenant")
+			}
+
+			req := c.Request()
+			t, err := opts.Store.Lookup(req.Context(), id)
+			if err != nil {
+				if errors.Is(err, ErrTenantNotFound) {
+					p := NewProblem(http.StatusNotFound, "unknown tenant")
+					p.Internal = err
+					return p
+				}
+				return err
+			}
+			if t == nil {
+				return NewProblem(http.StatusNotFound, "unknown tenant")
+			}
+			if p, ok := GetPrincipal(c); ok && p.TenantID != "" && p.TenantID != t.ID {
+				return NewProblem(http.StatusForbidden, "forbidden")
+			}
+
+			c.Set(tenantContextKey, t)
+			ctx := context.WithValue(req.Context(), tenantCtxKey{}, t)
+			if sctx, ok := c.(*Context); ok {
+				serverLogger := sctx.ServerLogger.With().Str("tenant_id", t.ID).Logger()
+				sctx.ServerLogger = &serverLogger
+				if sctx.requestLogger != nil {
+					requestLogger := sctx.requestLogger.With().Str("tenant_id", t.ID).Logger()
+					sctx.requestLogger = &requestLogger
+					ctx = requestLogger.WithContext(ctx)
+				}
+			}
+			c.SetRequest(req.WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// GetTenant returns the tenant resolved by the tenancy middleware, if any.
+func GetTenant(c echo.Context) (*Tenant, bool) {
+	t, ok := c.Get(tenantContextKey).(*Tenant)
+	return t, ok && t != nil
+}
+
+// TenantFromContext returns the tenant stored in the request's context by the tenancy middleware,
+// e.g. for use in repositories that only receive a context.Context.
+func TenantFromContext(ctx context.Context) (*Tenant, bool) {
+	t, ok := ctx.Value(tenantCtxKey{}).(*Tenant)
+	return t, ok && t != nil
+}
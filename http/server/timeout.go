@@ -0,0 +1,306 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	web "github.com/gpahal/golib/http"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+
+	defaultTimeoutDetail = "the request timed out"
+)
+
+// timeoutRegistry holds the per-route and per-group timeout overrides of a server. A duration
+// <= 0 disables the timeout.
+type timeoutRegistry struct {
+	mu       sync.RWMutex
+	routes   map[string]time.Duration
+	prefixes []timeoutPrefix
+}
+
+type timeoutPrefix struct {
+	prefix  string
+	timeout time.Duration
+}
+
+func getTimeoutRegistry(e *echo.Echo) *timeoutRegistry {
+	return getServerState(e).timeouts
+}
+
+// RouteTimeout overrides the server timeout for a route. A timeout <= 0 disables it.
+func RouteTimeout(e *echo.Echo, route *echo.Route, timeout time.Duration) *echo.Route {
+	r := getTimeoutRegistry(e)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes[route.Method+" "+route.Path] = timeout
+	return route
+}
+
+// StreamingRoute marks a route as streaming, e.g. long polling or file downloads. Streaming routes
+// are not subject to the server timeout.
+func StreamingRoute(e *echo.Echo, route *echo.Route) *echo.Route {
+	return RouteTimeout(e, route, 0)
+}
+
+// GroupTimeout overrides the server timeout for all routes under the path prefix. Route
+// overrides take precedence and the longest matching prefix wins. A timeout <= 0 disables it.
+func GroupTimeout(e *echo.Echo, prefix string, timeout time.Duration) {
+	r := getTimeoutRegistry(e)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, p := range r.prefixes {
+		if p.prefix == prefix {
+			r.prefixes[i].timeout = timeout
+			return
+		}
+	}
+	r.prefixes = append(r.prefixes, timeoutPrefix{prefix: prefix, timeout: timeout})
+}
+
+func (r *timeoutRegistry) timeout(c echo.Context, defaultTimeout time.Duration) time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	path := c.Path()
+	if timeout, ok := r.routes[c.Request().Method+" "+path]; ok {
+		return timeout
+	}
+
+	timeout, matched := defaultTimeout, ""
+	for _, p := range r.prefixes {
+		if strings.HasPrefix(path, p.prefix) && len(p.prefix) > len(matched) {
+			timeout, matched = p.timeout, p.prefix
+		}
+	}
+	return timeout
+}
+
+type TimeoutResponseOptions struct {
+	// Status is the status of timed out requests. Defaults to 503.
+	Status int
+	// Problem builds the problem+json body of timed out requests. Defaults to a problem with
+	// Status and a generic detail. The instance and request ID are filled in if empty. It is
+	// called before the handler runs, since c must not be used while the handler runs
+	// concurrently with the timeout.
+	Problem func(c echo.Context) *Problem
+	// DisableLog disables the warning logged for every timed out request.
+	DisableLog bool
+}
+
+// newTimeoutMiddleware applies the server timeout, taking the route and group overrides into
+// account. Protocol upgrades and server-sent events are never subject to the timeout.
+func newTimeoutMiddleware(e *echo.Echo, defaultTimeout time.Duration, opts TimeoutResponseOptions) echo.MiddlewareFunc {
+	if opts.Status == 0 {
+		opts.Status = http.StatusServiceUnavailable
+	}
+	if opts.Problem == nil {
+		opts.Problem = func(c echo.Context) *Problem {
+			return NewProblem(opts.Status, defaultTimeoutDetail)
+		}
+	}
+
+	registry := getTimeoutRegistry(e)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if isStreamingRequest(c) {
+				return next(c)
+			}
+
+			timeout := registry.timeout(c, defaultTimeout)
+			if timeout <= 0 {
+				return next(c)
+			}
+			return serveWithTimeout(c, next, timeout, &opts)
+		}
+	}
+}
+
+// serveWithTimeout runs the handler in a separate goroutine with a buffered response, like
+// http.TimeoutHandler. If the handler finishes in time, the buffered response is sent or its
+// error is returned. Otherwise the timeout response is sent and flushed immediately, later
+// writes of the handler fail with http.ErrHandlerTimeout and serveWithTimeout returns once the
+// handler returned, so handlers must respect the request context.
+func serveWithTimeout(c echo.Context, next echo.HandlerFunc, timeout time.Duration, opts *TimeoutResponseOptions) error {
+	start := time.Now()
+	req := c.Request()
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	// Everything the timeout response needs is captured up front, c belongs to the handler until
+	// it returned.
+	logger := Logger(c)
+	queueDelay, hasQueueDelay := c.Get(queueDelayContextKey).(time.Duration)
+	p := withProblemDefaults(c, opts.Problem(c))
+	if p.RequestID == "" {
+		p.RequestID = RequestID(c)
+	}
+
+	res := c.Response()
+	w := res.Writer
+	tw := &timeoutWriter{h: make(http.Header)}
+	res.Writer = tw
+	c.SetRequest(req.WithContext(ctx))
+
+	done := make(chan error, 1)
+	panicked := make(chan any, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				panicked <- r
+			}
+		}()
+		done <- next(c)
+	}()
+
+	select {
+	case r := <-panicked:
+		res.Writer = w
+		panic(r)
+	case err := <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		res.Writer = w
+		dst := w.Header()
+		if err != nil {
+			// The error handler renders the response, the partial output of the handler is
+			// discarded. Only headers describing the error, like Retry-After, are kept.
+			for k, v := range tw.h {
+				if isTimeoutErrorHeader(k) {
+					dst[k] = v
+				}
+			}
+			return err
+		}
+
+		for k, v := range tw.h {
+			dst[k] = v
+		}
+		if tw.wroteHeader {
+			w.WriteHeader(tw.code)
+			_, err = w.Write(tw.buf.Bytes())
+		}
+		return err
+	case <-ctx.Done():
+		tw.mu.Lock()
+		tw.timedOut = true
+		wroteHeader, buffered := tw.wroteHeader, tw.buf.Len()
+		tw.mu.Unlock()
+		if ctx.Err() != context.DeadlineExceeded {
+			// The client went away, nothing is sent. The handler still uses c, so it is waited
+			// for like after a timeout.
+			select {
+			case r := <-panicked:
+				res.Writer = w
+				panic(r)
+			case <-done:
+			}
+			res.Writer = w
+			return ctx.Err()
+		}
+
+		if !opts.DisableLog {
+			evt := logger.Warn().
+				Str("timeout", timeout.String()).
+				Str("elapsed", time.Since(start).String()).
+				Bool("handler_wrote_header", wroteHeader).
+				Int("handler_buffered_bytes", buffered)
+			if hasQueueDelay {
+				evt = evt.Str("queue_delay", queueDelay.String())
+			}
+			evt.Msg("request timed out")
+		}
+		status, size, err := writeTimeoutResponse(w, p, req.Method)
+
+		// Wait for the handler, which still uses c, before c is released to the pool of the
+		// server. The client already received the complete timeout response.
+		select {
+		case r := <-panicked:
+			res.Writer = w
+			panic(r)
+		case <-done:
+		}
+		res.Writer = w
+		res.Status, res.Size, res.Committed = status, int64(size), true
+		return err
+	}
+}
+
+// isTimeoutErrorHeader reports whether a header set by a failed handler is kept for the error
+// response.
+func isTimeoutErrorHeader(key string) bool {
+	return key == echo.HeaderRetryAfter || strings.HasPrefix(key, "Ratelimit-")
+}
+
+// writeTimeoutResponse writes the timeout response directly to w, since the response of c is
+// still used by the handler.
+func writeTimeoutResponse(w http.ResponseWriter, p *Problem, method string) (int, int, error) {
+	bs, err := json.Marshal(p)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	w.Header().Set(echo.HeaderContentType, web.MIMEApplicationProblemJSON)
+	w.Header().Set(echo.HeaderContentLength, strconv.Itoa(len(bs)))
+	w.WriteHeader(p.Status)
+	size := 0
+	if method != http.MethodHead {
+		if size, err = w.Write(bs); err != nil {
+			return p.Status, size, err
+		}
+	}
+	_ = http.NewResponseController(w).Flush()
+	return p.Status, size, nil
+}
+
+// timeoutWriter buffers the response of a handler running with a timeout. It doesn't support
+// flushing, so streaming handlers must be registered with StreamingRoute.
+type timeoutWriter struct {
+	h   http.Header
+	buf bytes.Buffer
+
+	mu          sync.Mutex
+	code        int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeader(code)
+}
+
+func (tw *timeoutWriter) writeHeader(code int) {
+	tw.wroteHeader = true
+	tw.code = code
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestTimeoutHandlerStillRunning(t *testing.T) {
+	e := NewWithOptions(Options{LoggerWriter: io.Discard, Timeout: 20 * time.Millisecond})
+	e.GET("/slow", func(c echo.Context) error {
+		// The handler keeps using c after the timeout response was sent, like handlers that
+		// notice the timeout late.
+		ctx := c.Request().Context()
+		for ctx.Err() == nil {
+			c.Set("progress", time.Now())
+			c.SetRequest(c.Request().WithContext(context.WithValue(ctx, struct{}{}, 1)))
+			time.Sleep(time.Millisecond)
+		}
+		for i := 0; i < 10; i++ {
+			c.Set(requestIDContextKey, "changed")
+			c.SetRequest(c.Request().WithContext(ctx))
+			time.Sleep(time.Millisecond)
+		}
+		return c.String(http.StatusOK, "too late")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+	req.Header.Set(echo.HeaderXRequestID, "request-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != "application/problem+json" {
+		t.Errorf("content type = %q", ct)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `"request_id":"request-1"`) || !strings.Contains(body, `"instance":"/slow"`) {
+		t.Errorf("body = %s", body)
+	}
+}
+
+func TestTimeoutErrorKeepsOnlyErrorHeaders(t *testing.T) {
+	e := NewWithOptions(Options{LoggerWriter: io.Discard, Timeout: time.Second})
+	e.GET("/fail", func(c echo.Context) error {
+		h := c.Response().Header()
+		h.Set(echo.HeaderRetryAfter, "5")
+		h.Set("RateLimit-Remaining", "0")
+		h.Set("Cache-Control", "public, max-age=3600")
+		h.Set(echo.HeaderSetCookie, "session=secret")
+		return NewProblem(http.StatusTooManyRequests, "slow down")
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	for _, k := range []string{echo.HeaderRetryAfter, "RateLimit-Remaining"} {
+		if rec.Header().Get(k) == "" {
+			t.Errorf("header %s was dropped", k)
+		}
+	}
+	for _, k := range []string{"Cache-Control", echo.HeaderSetCookie} {
+		if v := rec.Header().Get(k); v != "" {
+			t.Errorf("header %s = %q leaked into the error response", k, v)
+		}
+	}
+}
+
+func TestTimeoutClientCanceledWaitsForHandler(t *testing.T) {
+	e := NewWithOptions(Options{LoggerWriter: io.Discard, Timeout: time.Second})
+	returned := make(chan struct{})
+	e.GET("/slow", func(c echo.Context) error {
+		defer close(returned)
+		<-c.Request().Context().Done()
+		// The handler keeps using c after the client went away.
+		for i := 0; i < 10; i++ {
+			c.Set("progress", i)
+			c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), struct{}{}, i)))
+			time.Sleep(time.Millisecond)
+		}
+		return c.String(http.StatusOK, "too late")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil).WithContext(ctx)
+	time.AfterFunc(20*time.Millisecond, cancel)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	select {
+	case <-returned:
+	default:
+		t.Fatal("ServeHTTP returned before the handler")
+	}
+	if body := rec.Body.String(); strings.Contains(body, "too late") {
+		t.Errorf("body = %s", body)
+	}
+}
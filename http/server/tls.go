@@ -0,0 +1,121 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	defaultHttpRedirectPort = 80
+)
+
+type TLSOptions struct {
+	// CertFile and KeyFile are paths to a PEM encoded certificate and key.
+	CertFile string
+	KeyFile  string
+	// Config is the base TLS config. Certificates from CertFile/KeyFile or autocert are added to
+	// it.
+	Config *tls.Config
+	// Autocert obtains certificates from Let's Encrypt automatically.
+	Autocert *AutocertOptions
+	// RedirectHttp starts a plain http listener on HttpPort that redirects to https. It is always
+	// started in autocert mode to answer HTTP-01 challenges.
+	RedirectHttp bool
+	// HttpPort is the port of the plain http listener. Defaults to 80.
+	HttpPort int
+}
+
+type AutocertOptions struct {
+	// Domains is the list of host names certificates are requested for.
+	Domains []string
+	// CacheDir is the directory certificates are cached in across restarts.
+	CacheDir string
+	// Email is the optional contact email of the ACME account.
+	Email string
+	// DirectoryURL is the ACME directory URL. Defaults to Let's Encrypt production.
+	DirectoryURL string
+}
+
+// newTLSConfig builds the TLS config of the https listener and the handler of the plain http
+// listener, if one should be started.
+func newTLSConfig(opts *TLSOptions, httpsPort int) (*tls.Config, http.Handler, error) {
+	var cfg *tls.Config
+	if opts.Config != nil {
+		cfg = opts.Config.Clone()
+	} else {
+		cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	var httpHandler http.Handler
+	if opts.RedirectHttp || opts.Autocert != nil {
+		httpHandler = newHttpsRedirectHandler(httpsPort)
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+
+	if opts.Autocert != nil {
+		if len(opts.Autocert.Domains) == 0 {
+			return nil, nil, errors.New("autocert requires at least one domain")
+		}
+
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(opts.Autocert.Domains...),
+			Email:      opts.Autocert.Email,
+		}
+		if opts.Autocert.CacheDir != "" {
+			m.Cache = autocert.DirCache(opts.Autocert.CacheDir)
+		}
+		if opts.Autocert.DirectoryURL != "" {
+			m.Client = &acme.Client{DirectoryURL: opts.Autocert.DirectoryURL}
+		}
+
+		cfg.GetCertificate = m.GetCertificate
+		cfg.NextProtos = append(cfg.NextProtos, acme.ALPNProto)
+		// The autocert handler answers HTTP-01 challenges and redirects everything else to https.
+		httpHandler = m.HTTPHandler(httpHandler)
+	}
+
+	if len(cfg.Certificates) == 0 && cfg.GetCertificate == nil {
+		return nil, nil, errors.New("tls requires a certificate, a tls config with certificates or autocert")
+	}
+	return cfg, httpHandler, nil
+}
+
+func httpRedirectAddr(opts *TLSOptions) string {
+	port := opts.HttpPort
+	if port <= 0 {
+		port = defaultHttpRedirectPort
+	}
+	return ":" + strconv.Itoa(port)
+}
+
+func newHttpsRedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "use https", http.StatusBadRequest)
+			return
+		}
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
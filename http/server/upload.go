@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultUploadMaxSize = 10 << 20
+	maxUploadFormSize    = 1 << 20
+	sniffLength          = 512
+)
+
+type UploadOptions struct {
+	// MaxSize is the largest accepted file size in bytes. Larger files result in a 413 error.
+	// Defaults to 10MB.
+	MaxSize int64
+	// AllowedTypes is the list of accepted content types (or content type prefixes ending with
+	// "/", e.g. "image/"). The type is sniffed from the content, the type sent by the client is
+	// ignored. Other types result in a 415 error. Defaults to allowing all types.
+	AllowedTypes []string
+	// Writer returns the destination the file content is streamed to, e.g. an object in a blob
+	// store. It is called once the content type is known. If nil, the content is buffered in
+	// UploadedFile.Data. On error the writer may have received part of the content.
+	Writer func(f *UploadedFile) (io.Writer, error)
+}
+
+// UploadedFile describes a file read by FormFile.
+type UploadedFile struct {
+	Field    string
+	Filename string
+	// ContentType is the sniffed content type.
+	ContentType string
+	Size        int64
+	// Data is the content of the file if UploadOptions.Writer is nil.
+	Data []byte
+}
+
+// FormFile streams the file in the given field of a multipart request without buffering the
+// request in temporary files. Form fields sent before the file are available through
+// c.FormValue afterwards.
+func FormFile(c echo.Context, field string, opts UploadOptions) (*UploadedFile, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaultUploadMaxSize
+	}
+
+	req := c.Request()
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return nil, NewHttpErrorWithInternal(http.StatusBadRequest, "expected a multipart form", err)
+	}
+
+	form := url.Values{}
+	formSize := 0
+	defer func() {
+		req.PostForm = form
+		req.Form = mergeForm(req.URL.Query(), form)
+	}()
+
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, NewProblem(http.StatusBadRequest, fmt.Sprintf("missing file %s", field))
+		} else if err != nil {
+			return nil, NewHttpErrorWithInternal(http.StatusBadRequest, "malformed multipart form", err)
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, int64(maxUploadFormSize-formSize+1)))
+			part.Close()
+			if err != nil {
+				return nil, NewHttpErrorWithInternal(http.StatusBadRequest, "malformed multipart form", err)
+			}
+			formSize += len(value)
+			if formSize > maxUploadFormSize {
+				return nil, NewProblem(http.StatusRequestEntityTooLarge, "form fields are too large")
+			}
+			form.Add(part.FormName(), string(value))
+			continue
+		}
+		if part.FormName() != field {
+			part.Close()
+			continue
+		}
+
+		f, err := readUploadedFile(part, opts)
+		part.Close()
+		return f, err
+	}
+}
+
+func readUploadedFile(part *multipart.Part, opts UploadOptions) (*UploadedFile, error) {
+	f := &UploadedFile{Field: part.FormName(), Filename: part.FileName()}
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(part, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, NewHttpErrorWithInternal(http.StatusBadRequest, "malformed multipart form", err)
+	}
+	head = head[:n]
+
+	f.ContentType = http.DetectContentType(head)
+	if !uploadTypeAllowed(f.ContentType, opts.AllowedTypes) {
+		return nil, NewProblem(http.StatusUnsupportedMediaType, fmt.Sprintf("file type %s is not allowed", f.ContentType))
+	}
+
+	var buf *bytes.Buffer
+	var w io.Writer
+	if opts.Writer != nil {
+		w, err = opts.Writer(f)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		buf = &bytes.Buffer{}
+		w = buf
+	}
+
+	content := io.MultiReader(bytes.NewReader(head), part)
+	size, err := io.Copy(w, io.LimitReader(content, opts.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if size > opts.MaxSize {
+		return nil, NewProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("file exceeds %d bytes", opts.MaxSize))
+	}
+
+	f.Size = size
+	if buf != nil {
+		f.Data = buf.Bytes()
+	}
+	return f, nil
+}
+
+func uploadTypeAllowed(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range allowed {
+		if strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) || mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeForm(query, form url.Values) url.Values {
+	merged := make(url.Values, len(query)+len(form))
+	for k, v := range form {
+		merged[k] = append(merged[k], v...)
+	}
+	for k, v := range query {
+		merged[k] = append(merged[k], v...)
+	}
+	return merged
+}
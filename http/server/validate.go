@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gpahal/golib/validate"
+	"github.com/labstack/echo/v4"
+)
+
+// FieldError describes a single field that failed validation.
+type FieldError = validate.FieldError
+
+type echoValidator struct {
+	v *validator.Validate
+}
+
+func (ev *echoValidator) Validate(i any) error {
+	return ev.v.Struct(i)
+}
+
+// newDefaultValidator returns a validator that reports field names using their json tags and
+// supports the rules of the validate package.
+func newDefaultValidator() *validator.Validate {
+	return validate.New()
+}
+
+// BindAndValidate binds the request into i and validates it with the server's validator, unless
+// a StrictBinder validated it already. Validation failures result in a 400 response listing the
+// offending fields.
+func BindAndValidate(c echo.Context, i any) error {
+	if err := c.Bind(i); err != nil {
+		return err
+	}
+	if b, ok := c.Echo().Binder.(*StrictBinder); ok && b.validates(c) {
+		return nil
+	}
+	return c.Validate(i)
+}
+
+// NewValidationProblem converts validation errors into a 400 problem listing the offending
+// fields. It returns nil if err doesn't contain validation errors.
+func NewValidationProblem(err error) *Problem {
+	fieldErrors := validate.FieldErrors(err)
+	if fieldErrors == nil {
+		return nil
+	}
+
+	p := NewProblem(http.StatusBadRequest, "request validation failed")
+	p.Extensions = map[string]any{"errors": fieldErrors}
+	p.Internal = err
+	return p
+}
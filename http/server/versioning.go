@@ -0,0 +1,204 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	headerDeprecation = "Deprecation"
+	headerSunset      = "Sunset"
+)
+
+var (
+	// vendorVersionPattern matches vendor media types carrying a version, e.g.
+	// application/vnd.example.v2+json.
+	vendorVersionPattern = regexp.MustCompile(`^application/vnd\.[^+]*\.(v\d+)(\+[a-z]+)?$`)
+)
+
+type VersionedOptions struct {
+	// AcceptHeader routes requests without a version path prefix by the version in the Accept
+	// header, either as a parameter ("application/json; version=2") or a vendor media type
+	// ("application/vnd.example.v2+json").
+	AcceptHeader bool
+	// Default is the version unversioned requests are routed to, if any.
+	Default string
+}
+
+type VersionOptions struct {
+	// Deprecated marks the version as deprecated. Responses carry the Deprecation header.
+	Deprecated bool
+	// DeprecatedAt is the time the version was deprecated, if known.
+	DeprecatedAt time.Time
+	// Sunset is the time the version will be removed. Responses carry the Sunset header.
+	Sunset time.Time
+	// Link points to documentation about the deprecation or the successor version.
+	Link string
+}
+
+// Versions groups routes by API version. Each version is served under its own path prefix,
+// e.g. /v1.
+type Versions struct {
+	e        *echo.Echo
+	opts     VersionedOptions
+	mu       sync.RWMutex
+	versions []*Version
+}
+
+type Version struct {
+	*echo.Group
+	Name string
+	Opts VersionOptions
+}
+
+// VersionInfo describes a registered version.
+type VersionInfo struct {
+	Name         string     `json:"name"`
+	Prefix       string     `json:"prefix"`
+	Deprecated   bool       `json:"deprecated"`
+	DeprecatedAt *time.Time `json:"deprecated_at,omitempty"`
+	Sunset       *time.Time `json:"sunset,omitempty"`
+}
+
+func Versioned(e *echo.Echo) *Versions {
+	return VersionedWithOptions(e, VersionedOptions{})
+}
+
+func VersionedWithOptions(e *echo.Echo, opts VersionedOptions) *Versions {
+	vs := &Versions{e: e, opts: opts}
+	if opts.AcceptHeader || opts.Default != "" {
+		e.Pre(vs.rewriteUnversioned)
+	}
+	return vs
+}
+
+// Version returns the route group of the version with the given name, e.g. "v1", creating it if
+// needed.
+func (vs *Versions) Version(name string, opts ...VersionOptions) *Version {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	for _, v := range vs.versions {
+		if v.Name == name {
+			return v
+		}
+	}
+
+	v := &Version{Name: name}
+	if len(opts) > 0 {
+		v.Opts = opts[0]
+	}
+	v.Group = vs.e.Group("/"+name, v.deprecationHeaders)
+	vs.versions = append(vs.versions, v)
+	return v
+}
+
+// List returns the registered versions in registration order.
+func (vs *Versions) List() []VersionInfo {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	infos := make([]VersionInfo, 0, len(vs.versions))
+	for _, v := range vs.versions {
+		info := VersionInfo{Name: v.Name, Prefix: "/" + v.Name, Deprecated: v.Opts.Deprecated}
+		if !v.Opts.DeprecatedAt.IsZero() {
+			t := v.Opts.DeprecatedAt
+			info.DeprecatedAt = &t
+		}
+		if !v.Opts.Sunset.IsZero() {
+			t := v.Opts.Sunset
+			info.Sunset = &t
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Handler returns a handler rendering the registered versions as JSON.
+func (vs *Versions) Handler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, vs.List())
+	}
+}
+
+func (vs *Versions) has(name string) bool {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	for _, v := range vs.versions {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteUnversioned prefixes the path of requests without a known version prefix with the
+// version from the Accept header or the default version.
+func (vs *Versions) rewriteUnversioned(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		first, _, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+		if vs.has(first) {
+			return next(c)
+		}
+
+		version := ""
+		if vs.opts.AcceptHeader {
+			version = acceptVersion(req.Header.Get(echo.HeaderAccept))
+		}
+		if version == "" {
+			version = vs.opts.Default
+		}
+		if version != "" && vs.has(version) {
+			req.URL.Path = "/" + version + req.URL.Path
+			if req.URL.RawPath != "" {
+				req.URL.RawPath = "/" + version + req.URL.RawPath
+			}
+		}
+		return next(c)
+	}
+}
+
+func acceptVersion(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if v := params["version"]; v != "" {
+			return "v" + strings.TrimPrefix(v, "v")
+		}
+		if m := vendorVersionPattern.FindStringSubmatch(mediaType); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+func (v *Version) deprecationHeaders(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if v.Opts.Deprecated {
+			header := c.Response().Header()
+			if !v.Opts.DeprecatedAt.IsZero() {
+				header.Set(headerDeprecation, "@"+strconv.FormatInt(v.Opts.DeprecatedAt.Unix(), 10))
+			} else {
+				header.Set(headerDeprecation, "true")
+			}
+			if !v.Opts.Sunset.IsZero() {
+				header.Set(headerSunset, v.Opts.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if v.Opts.Link != "" {
+				header.Add(headerLink, "<"+v.Opts.Link+`>; rel="deprecation"`)
+			}
+		}
+		return next(c)
+	}
+}
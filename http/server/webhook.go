@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	webhookBodyContextKey = "golib.server.webhook_body"
+
+	defaultWebhookTolerance   = 5 * time.Minute
+	defaultWebhookMaxBodySize = 1 << 20
+)
+
+var (
+	ErrWebhookSignatureInvalid = errors.New("invalid webhook signature")
+	ErrWebhookTimestampExpired = errors.New("webhook timestamp outside tolerance")
+)
+
+// WebhookScheme verifies the signature of a webhook request.
+type WebhookScheme interface {
+	// Verify verifies the signature of the body. It returns the signing time, or the zero time if
+	// the scheme doesn't sign one.
+	Verify(header http.Header, body []byte) (time.Time, error)
+}
+
+// SignatureEncoding is the encoding of a signature in a header.
+type SignatureEncoding int
+
+const (
+	SignatureEncodingHex SignatureEncoding = iota
+	SignatureEncodingBase64
+)
+
+// HMACWebhookScheme verifies HMAC-SHA256 signatures.
+type HMACWebhookScheme struct {
+	// Secrets are the shared secrets. Signatures made with any of them are accepted, which allows
+	// rotating secrets.
+	Secrets [][]byte
+	// SignatureHeader is the header carrying the signature.
+	SignatureHeader string
+	// Prefix is stripped from the signature header value, e.g. "sha256=".
+	Prefix   string
+	Encoding SignatureEncoding
+	// TimestampHeader, if set, is the header carrying the signing time in Unix seconds.
+	TimestampHeader string
+	// Payload returns the signed payload. Defaults to "<timestamp>.<body>" if TimestampHeader is
+	// set and to the body otherwise.
+	Payload func(timestamp string, body []byte) []byte
+}
+
+func (s *HMACWebhookScheme) Verify(header http.Header, body []byte) (time.Time, error) {
+	signature, err := decodeSignature(strings.TrimPrefix(header.Get(s.SignatureHeader), s.Prefix), s.Encoding)
+	if err != nil {
+		return time.Time{}, ErrWebhookSignatureInvalid
+	}
+
+	timestamp, signedAt, err := webhookTimestamp(header, s.TimestampHeader)
+	if err != nil {
+		return time.Time{}, err
+	}
+	payload := body
+	switch {
+	case s.Payload != nil:
+		payload = s.Payload(timestamp, body)
+	case s.TimestampHeader != "":
+		payload = append([]byte(timestamp+"."), body...)
+	}
+
+	for _, secret := range s.Secrets {
+		if hmac.Equal(signature, hmacSHA256(secret, payload)) {
+			return signedAt, nil
+		}
+	}
+	return time.Time{}, ErrWebhookSignatureInvalid
+}
+
+// Ed25519WebhookScheme verifies ed25519 signatures, e.g. of Discord interactions. PublicKey must
+// be ed25519.PublicKeySize bytes long.
+type Ed25519WebhookScheme struct {
+	PublicKey       ed25519.PublicKey
+	SignatureHeader string
+	Encoding        SignatureEncoding
+	// TimestampHeader, if set, is the header carrying the signing time in Unix seconds. The
+	// signed payload is then the timestamp followed by the body.
+	TimestampHeader string
+}
+
+func (s *Ed25519WebhookScheme) Verify(header http.Header, body []byte) (time.Time, error) {
+	signature, err := decodeSignature(header.Get(s.SignatureHeader), s.Encoding)
+	if err != nil {
+		return time.Time{}, ErrWebhookSignatureInvalid
+	}
+
+	timestamp, signedAt, err := webhookTimestamp(header, s.TimestampHeader)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// ed25519.Verify panics on keys of the wrong size.
+	if len(s.PublicKey) != ed25519.PublicKeySize || !ed25519.Verify(s.PublicKey, append([]byte(timestamp), body...), signature) {
+		return time.Time{}, ErrWebhookSignatureInvalid
+	}
+	return signedAt, nil
+}
+
+// GitHubWebhookScheme verifies the X-Hub-Signature-256 header of GitHub webhooks.
+func GitHubWebhookScheme(secret string) WebhookScheme {
+	return &HMACWebhookScheme{
+		Secrets:         [][]byte{[]byte(secret)},
+		SignatureHeader: "X-Hub-Signature-256",
+		Prefix:          "sha256=",
+	}
+}
+
+// SlackWebhookScheme verifies the X-Slack-Signature header of Slack requests.
+func SlackWebhookScheme(signingSecret string) WebhookScheme {
+	return &HMACWebhookScheme{
+		Secrets:         [][]byte{[]byte(signingSecret)},
+		SignatureHeader: "X-Slack-Signature",
+		Prefix:          "v0=",
+		TimestampHeader: "X-Slack-Request-Timestamp",
+		Payload: func(timestamp string, body []byte) []byte {
+			return append([]byte("v0:"+timestamp+":"), body...)
+		},
+	}
+}
+
+type stripeWebhookScheme struct {
+	secret []byte
+}
+
+// StripeWebhookScheme verifies the Stripe-Signature header of Stripe webhooks.
+func StripeWebhookScheme(endpointSecret string) WebhookScheme {
+	return &stripeWebhookScheme{secret: []byte(endpointSecret)}
+}
+
+func (s *stripeWebhookScheme) Verify(header http.Header, body []byte) (time.Time, error) {
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			timestamp = v
+		case "v1":
+			if sig, err := hex.DecodeString(v); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrWebhookSignatureInvalid
+	}
+	expected := hmacSHA256(s.secret, append([]byte(timestamp+"."), body...))
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return time.Unix(secs, 0), nil
+		}
+	}
+	return time.Time{}, ErrWebhookSignatureInvalid
+}
+
+type WebhookOptions struct {
+	Skipper middleware.Skipper
+	Scheme  WebhookScheme
+	// Tolerance is the maximum age of a signed timestamp, which stops replays of captured
+	// requests. Defaults to 5m.
+	Tolerance time.Duration
+	// MaxBodySize is the largest accepted body. Defaults to 1MB.
+	MaxBodySize int64
+}
+
+// VerifyWebhook returns a middleware rejecting requests without a valid signature with a 401
+// error. The verified raw body is available through WebhookBody.
+func VerifyWebhook(scheme WebhookScheme) echo.MiddlewareFunc {
+	return VerifyWebhookWithOptions(WebhookOptions{Scheme: scheme})
+}
+
+func VerifyWebhookWithOptions(opts WebhookOptions) echo.MiddlewareFunc {
+	if opts.Scheme == nil {
+		panic("server: webhook middleware requires a scheme")
+	}
+	if s, ok := opts.Scheme.(*Ed25519WebhookScheme); ok && len(s.PublicKey) != ed25519.PublicKeySize {
+		panic(fmt.Sprintf("server: webhook ed25519 public key must be %d bytes, got %d", ed25519.PublicKeySize, len(s.PublicKey)))
+	}
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = defaultWebhookTolerance
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultWebhookMaxBodySize
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if opts.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			body, err := io.ReadAll(io.LimitReader(req.Body, opts.MaxBodySize+1))
+			if err != nil {
+				return NewHttpErrorWithInternal(http.StatusBadRequest, "failed to read webhook body", err)
+			}
+			if int64(len(body)) > opts.MaxBodySize {
+				return NewProblem(http.StatusRequestEntityTooLarge, "webhook body is too large")
+			}
+
+			signedAt, err := opts.Scheme.Verify(req.Header, body)
+			if err == nil && !signedAt.IsZero() {
+				if age := time.Since(signedAt); age > opts.Tolerance || age < -opts.Tolerance {
+					err = ErrWebhookTimestampExpired
+				}
+			}
+			if err != nil {
+				p := NewProblem(http.StatusUnauthorized, err.Error())
+				p.Internal = err
+				return p
+			}
+
+			c.Set(webhookBodyContextKey, body)
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			return next(c)
+		}
+	}
+}
+
+// WebhookBody returns the raw body verified by the webhook middleware.
+func WebhookBody(c echo.Context) []byte {
+	body, _ := c.Get(webhookBodyContextKey).([]byte)
+	return body
+}
+
+func webhookTimestamp(header http.Header, name string) (string, time.Time, error) {
+	if name == "" {
+		return "", time.Time{}, nil
+	}
+	timestamp := header.Get(name)
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", time.Time{}, ErrWebhookSignatureInvalid
+	}
+	return timestamp, time.Unix(secs, 0), nil
+}
+
+func decodeSignature(s string, encoding SignatureEncoding) ([]byte, error) {
+	if s == "" {
+		return nil, ErrWebhookSignatureInvalid
+	}
+	if encoding == SignatureEncodingBase64 {
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return hex.DecodeString(s)
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,399 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultWebSocketPingInterval   = 30 * time.Second
+	defaultWebSocketWriteWait      = 10 * time.Second
+	defaultWebSocketSendBufferSize = 16
+)
+
+var (
+	ErrWebSocketClosed         = errors.New("websocket connection closed")
+	ErrWebSocketSendBufferFull = errors.New("websocket send buffer full")
+)
+
+type WebSocketOptions struct {
+	// AllowedOrigins is the list of origins allowed to connect. "*" allows all origins. Defaults
+	// to allowing only same-origin requests.
+	AllowedOrigins []string
+	// CheckOrigin overrides AllowedOrigins with a custom check.
+	CheckOrigin func(r *http.Request) bool
+	// Subprotocols is the list of supported subprotocols in order of preference.
+	Subprotocols []string
+	// ReadLimit is the maximum size in bytes of an incoming message. Defaults to no limit.
+	ReadLimit int64
+	// PingInterval is the interval pings are sent at. Connections that don't answer with a pong
+	// within two intervals are closed. Defaults to 30s.
+	PingInterval time.Duration
+	// WriteWait is the deadline for writing a single message. Defaults to 10s.
+	WriteWait time.Duration
+	// SendBufferSize is the number of outgoing messages buffered per connection. Connections
+	// whose buffer is full are closed. Defaults to 16.
+	SendBufferSize  int
+	ReadBufferSize  int
+	WriteBufferSize int
+	// Hub, if set, registers every connection with the hub.
+	Hub        *Hub
+	Middleware []echo.MiddlewareFunc
+}
+
+// WebSocketHandler handles an upgraded connection. The connection is closed when the handler
+// returns. When the server shuts down, the queued messages are sent followed by a going away
+// close frame, after which reads fail and the handler should return.
+type WebSocketHandler func(c echo.Context, conn *WebSocketConn) error
+
+// WebSocket registers a GET route at path that upgrades requests to websocket connections.
+func WebSocket(r Router, path string, handler WebSocketHandler, opts WebSocketOptions) *echo.Route {
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = defaultWebSocketPingInterval
+	}
+	if opts.WriteWait <= 0 {
+		opts.WriteWait = defaultWebSocketWriteWait
+	}
+	if opts.SendBufferSize <= 0 {
+		opts.SendBufferSize = defaultWebSocketSendBufferSize
+	}
+
+	upgrader := &websocket.Upgrader{
+		ReadBufferSize:  opts.ReadBufferSize,
+		WriteBufferSize: opts.WriteBufferSize,
+		Subprotocols:    opts.Subprotocols,
+		CheckOrigin:     opts.CheckOrigin,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			http.Error(w, http.StatusText(status), status)
+		},
+	}
+	if upgrader.CheckOrigin == nil && len(opts.AllowedOrigins) > 0 {
+		upgrader.CheckOrigin = allowedOriginsChecker(opts.AllowedOrigins)
+	}
+
+	return r.GET(path, func(c echo.Context) error {
+		ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+		if err != nil {
+			// The upgrader has already written an error response.
+			return nil
+		}
+
+		// Hijacked connections aren't tracked by http.Server.Shutdown.
+		state := getServerState(c.Echo())
+		done := state.trackConnection()
+		defer done()
+
+		conn := newWebSocketConn(c.Request().Context(), ws, &opts, state.closing)
+		if opts.Hub != nil {
+			opts.Hub.Register(conn)
+		}
+		defer conn.Close()
+
+		return handler(c, conn)
+	}, opts.Middleware...)
+}
+
+func allowedOriginsChecker(origins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get(echo.HeaderOrigin)
+		if origin == "" {
+			return true
+		}
+		for _, allowed := range origins {
+			if allowed == "*" || strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+type webSocketMessage struct {
+	messageType int
+	data        []byte
+}
+
+// WebSocketConn is an upgraded websocket connection. Writes are queued and performed by a
+// dedicated goroutine that also keeps the connection alive with pings. Reads must be done by a
+// single goroutine, usually the handler.
+type WebSocketConn struct {
+	ws        *websocket.Conn
+	opts      *WebSocketOptions
+	send      chan webSocketMessage
+	ctx       context.Context
+	cancel    context.CancelFunc
+	shutdown  <-chan struct{}
+	closeOnce sync.Once
+	onClose   []func()
+	mu        sync.Mutex
+}
+
+func newWebSocketConn(ctx context.Context, ws *websocket.Conn, opts *WebSocketOptions, shutdown <-chan struct{}) *WebSocketConn {
+	ctx, cancel := context.WithCancel(ctx)
+	conn := &WebSocketConn{
+		ws:       ws,
+		opts:     opts,
+		send:     make(chan webSocketMessage, opts.SendBufferSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		shutdown: shutdown,
+	}
+
+	if opts.ReadLimit > 0 {
+		ws.SetReadLimit(opts.ReadLimit)
+	}
+	pongWait := 2 * opts.PingInterval
+	_ = ws.SetReadDeadline(time.Now().Add(pongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	go conn.writePump()
+	return conn
+}
+
+// Context returns a context that is canceled when the connection is closed.
+func (conn *WebSocketConn) Context() context.Context {
+	return conn.ctx
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (conn *WebSocketConn) Subprotocol() string {
+	return conn.ws.Subprotocol()
+}
+
+// ReadMessage reads the next message. See websocket.TextMessage and websocket.BinaryMessage for
+// message types.
+func (conn *WebSocketConn) ReadMessage() (int, []byte, error) {
+	return conn.ws.ReadMessage()
+}
+
+// ReadJSON reads the next message and decodes it as JSON into v.
+func (conn *WebSocketConn) ReadJSON(v any) error {
+	return conn.ws.ReadJSON(v)
+}
+
+// Send queues a message. If the send buffer is full, the connection is closed and
+// ErrWebSocketSendBufferFull is returned.
+func (conn *WebSocketConn) Send(messageType int, data []byte) error {
+	select {
+	case <-conn.ctx.Done():
+		return ErrWebSocketClosed
+	default:
+	}
+
+	select {
+	case conn.send <- webSocketMessage{messageType: messageType, data: data}:
+		return nil
+	case <-conn.ctx.Done():
+		return ErrWebSocketClosed
+	default:
+		conn.Close()
+		return ErrWebSocketSendBufferFull
+	}
+}
+
+func (conn *WebSocketConn) SendText(text string) error {
+	return conn.Send(websocket.TextMessage, []byte(text))
+}
+
+func (conn *WebSocketConn) SendJSON(v any) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return conn.Send(websocket.TextMessage, bs)
+}
+
+// OnClose registers a function called when the connection is closed.
+func (conn *WebSocketConn) OnClose(fn func()) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.onClose = append(conn.onClose, fn)
+}
+
+// Close closes the connection.
+func (conn *WebSocketConn) Close() {
+	conn.closeOnce.Do(func() {
+		conn.cancel()
+		_ = conn.ws.Close()
+
+		conn.mu.Lock()
+		onClose := conn.onClose
+		conn.mu.Unlock()
+		for _, fn := range onClose {
+			fn()
+		}
+	})
+}
+
+func (conn *WebSocketConn) writePump() {
+	ticker := time.NewTicker(conn.opts.PingInterval)
+	defer ticker.Stop()
+	defer conn.Close()
+
+	for {
+		select {
+		case <-conn.ctx.Done():
+			return
+		case msg := <-conn.send:
+			_ = conn.ws.SetWriteDeadline(time.Now().Add(conn.opts.WriteWait))
+			if err := conn.ws.WriteMessage(msg.messageType, msg.data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(conn.opts.WriteWait)); err != nil {
+				return
+			}
+		case <-conn.shutdown:
+			conn.closeGoingAway()
+			return
+		}
+	}
+}
+
+// closeGoingAway sends the queued messages and a close frame telling the client that the server
+// is shutting down, and waits up to WriteWait for the client to close the connection.
+func (conn *WebSocketConn) closeGoingAway() {
+	for {
+		select {
+		case msg := <-conn.send:
+			_ = conn.ws.SetWriteDeadline(time.Now().Add(conn.opts.WriteWait))
+			if err := conn.ws.WriteMessage(msg.messageType, msg.data); err != nil {
+				return
+			}
+			continue
+		default:
+		}
+
+		msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+		if err := conn.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(conn.opts.WriteWait)); err != nil {
+			return
+		}
+		timer := time.NewTimer(conn.opts.WriteWait)
+		defer timer.Stop()
+		select {
+		case <-conn.ctx.Done():
+		case <-timer.C:
+		}
+		return
+	}
+}
+
+// Hub tracks websocket connections and broadcasts messages to all of them or to rooms.
+type Hub struct {
+	mu    sync.RWMutex
+	conns map[*WebSocketConn]struct{}
+	rooms map[string]map[*WebSocketConn]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		conns: make(map[*WebSocketConn]struct{}),
+		rooms: make(map[string]map[*WebSocketConn]struct{}),
+	}
+}
+
+// Register adds the connection to the hub. It is removed from the hub and all its rooms when it
+// is closed.
+func (h *Hub) Register(conn *WebSocketConn) {
+	h.mu.Lock()
+	h.conns[conn] = struct{}{}
+	h.mu.Unlock()
+
+	conn.OnClose(func() {
+		h.unregister(conn)
+	})
+}
+
+func (h *Hub) unregister(conn *WebSocketConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.conns, conn)
+	for room, conns := range h.rooms {
+		delete(conns, conn)
+		if len(conns) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+// Join adds the connection to a room.
+func (h *Hub) Join(room string, conn *WebSocketConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.conns[conn]; !ok {
+		return
+	}
+	conns, ok := h.rooms[room]
+	if !ok {
+		conns = make(map[*WebSocketConn]struct{})
+		h.rooms[room] = conns
+	}
+	conns[conn] = struct{}{}
+}
+
+// Leave removes the connection from a room.
+func (h *Hub) Leave(room string, conn *WebSocketConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if conns, ok := h.rooms[room]; ok {
+		delete(conns, conn)
+		if len(conns) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+// Broadcast sends a message to all connections.
+func (h *Hub) Broadcast(messageType int, data []byte) {
+	h.mu.RLock()
+	conns := make([]*WebSocketConn, 0, len(h.conns))
+	for conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	h.mu.RUnlock()
+
+	for _, conn := range conns {
+		_ = conn.Send(messageType, data)
+	}
+}
+
+// BroadcastRoom sends a message to all connections in a room.
+func (h *Hub) BroadcastRoom(room string, messageType int, data []byte) {
+	h.mu.RLock()
+	conns := make([]*WebSocketConn, 0, len(h.rooms[room]))
+	for conn := range h.rooms[room] {
+		conns = append(conns, conn)
+	}
+	h.mu.RUnlock()
+
+	for _, conn := range conns {
+		_ = conn.Send(messageType, data)
+	}
+}
+
+// Count returns the number of registered connections.
+func (h *Hub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.conns)
+}
+
+// RoomCount returns the number of connections in a room.
+func (h *Hub) RoomCount(room string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.rooms[room])
+}
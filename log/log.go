@@ -0,0 +1,149 @@
+// Package log configures zerolog loggers and carries them in contexts, so that the fields of a
+// request, e.g. its request ID, are included in every log line written while handling it.
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	defaultLogger atomic.Pointer[zerolog.Logger]
+)
+
+// loggerContextKey is the context key of loggers stored with WithContext. zerolog doesn't store
+// disabled loggers in contexts without a logger, so they are stored under this key as well.
+type loggerContextKey struct{}
+
+// Format is the format of the logs.
+type Format int
+
+const (
+	// FormatAuto uses FormatJSON when Options.Production is set and FormatConsole otherwise.
+	FormatAuto Format = iota
+	// FormatConsole writes human readable, colored lines for local development.
+	FormatConsole
+	// FormatJSON writes one JSON object per line for log aggregation in production.
+	FormatJSON
+)
+
+// Resolve returns the format used for f, resolving FormatAuto.
+func (f Format) Resolve(production bool) Format {
+	if f != FormatAuto {
+		return f
+	}
+	if production {
+		return FormatJSON
+	}
+	return FormatConsole
+}
+
+type Options struct {
+	// Writer receives the logs. Defaults to os.Stdout.
+	Writer io.Writer
+	// Format defaults to JSON when Production is set and to console otherwise.
+	Format     Format
+	Production bool
+	// Level is the minimum level, e.g. "debug" or "warn". Defaults to "info".
+	Level string
+	// Service, Version and Env, if set, are added to every log line.
+	Service string
+	Version string
+	Env     string
+}
+
+func New() *zerolog.Logger {
+	return NewWithOptions(Options{})
+}
+
+// NewWithOptions returns a logger configured by opts. It panics if the level is invalid.
+func NewWithOptions(opts Options) *zerolog.Logger {
+	if opts.Writer == nil {
+		opts.Writer = os.Stdout
+	}
+	level := zerolog.InfoLevel
+	if opts.Level != "" {
+		var err error
+		level, err = zerolog.ParseLevel(strings.ToLower(opts.Level))
+		if err != nil {
+			panic(fmt.Sprintf("log: invalid level %q", opts.Level))
+		}
+	}
+
+	loggerBuilder := zerolog.New(NewWriter(opts.Writer, opts.Format.Resolve(opts.Production))).
+		Level(level).
+		With().
+		Timestamp()
+	if opts.Service != "" {
+		loggerBuilder = loggerBuilder.Str("service", opts.Service)
+	}
+	if opts.Version != "" {
+		loggerBuilder = loggerBuilder.Str("version", opts.Version)
+	}
+	if opts.Env != "" {
+		loggerBuilder = loggerBuilder.Str("env", opts.Env)
+	}
+	logger := loggerBuilder.Logger()
+	return &logger
+}
+
+// NewWriter returns a writer writing the JSON log lines of zerolog to w in the given format.
+func NewWriter(w io.Writer, format Format) io.Writer {
+	if format == FormatJSON {
+		return w
+	}
+	return zerolog.ConsoleWriter{
+		Out:         w,
+		TimeFormat:  "02 Jan 06 15:04:05 MST",
+		FieldsOrder: []string{"status", "method", "uri", "error", "request_id", "latency", "size"},
+	}
+}
+
+// Default returns the logger returned by FromContext for contexts without a logger. Defaults to
+// a logger created with New.
+func Default() *zerolog.Logger {
+	if l := defaultLogger.Load(); l != nil {
+		return l
+	}
+	defaultLogger.CompareAndSwap(nil, New())
+	return defaultLogger.Load()
+}
+
+// SetDefault replaces the default logger, e.g. with the logger of the service at startup.
+func SetDefault(logger *zerolog.Logger) {
+	defaultLogger.Store(logger)
+}
+
+// FromContext returns the logger stored in ctx, e.g. the request logger of the server, or the
+// default logger if there is none. A disabled logger stored in ctx, e.g. zerolog.Nop, is
+// returned as well, which silences logging through ctx.
+func FromContext(ctx context.Context) *zerolog.Logger {
+	// Without a logger, zerolog.Ctx returns zerolog.DefaultContextLogger or a shared disabled
+	// logger, which is what it returns for an empty context.
+	if l := zerolog.Ctx(ctx); l != zerolog.Ctx(context.Background()) {
+		return l
+	}
+	if l, ok := ctx.Value(loggerContextKey{}).(*zerolog.Logger); ok {
+		return l
+	}
+	return Default()
+}
+
+// WithContext returns a copy of ctx carrying logger, also for zerolog.Ctx.
+func WithContext(ctx context.Context, logger *zerolog.Logger) context.Context {
+	return context.WithValue(logger.WithContext(ctx), loggerContextKey{}, logger)
+}
+
+// WithFields returns a copy of ctx carrying the logger of ctx with the fields added by fn, e.g.
+// the ID of a job, so that they are included in the log lines written with the returned
+// context.
+func WithFields(ctx context.Context, fn func(c zerolog.Context) zerolog.Context) context.Context {
+	logger := fn(FromContext(ctx).With()).Logger()
+	return WithContext(ctx, &logger)
+}
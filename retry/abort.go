@@ -0,0 +1,94 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrAborted matches the *AbortError of aborted retries with errors.Is.
+	ErrAborted = errors.New("retry aborted")
+)
+
+// AbortError is returned by retries aborted with an AbortSignal, which distinguishes operator
+// aborts from exhausted retries.
+type AbortError struct {
+	Reason string
+	// Err is the error the retries stopped with, wrapping context.Canceled and the last error.
+	Err error
+}
+
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", ErrAborted, e.Reason, e.Err)
+}
+
+func (e *AbortError) Unwrap() error {
+	return e.Err
+}
+
+func (e *AbortError) Is(target error) bool {
+	return target == ErrAborted
+}
+
+// AbortSignal aborts the retry loops using it from another goroutine, e.g. when an operator
+// cancels a long running operation. Aborted loops cancel the context of the running attempt and
+// return an *AbortError. It is safe for concurrent use.
+type AbortSignal struct {
+	done   chan struct{}
+	once   sync.Once
+	reason string
+}
+
+func NewAbortSignal() *AbortSignal {
+	return &AbortSignal{done: make(chan struct{})}
+}
+
+// Abort aborts the retry loops using the signal. Only the first reason is kept.
+func (s *AbortSignal) Abort(reason string) {
+	s.once.Do(func() {
+		s.reason = reason
+		close(s.done)
+	})
+}
+
+// Done returns a channel that is closed once Abort was called.
+func (s *AbortSignal) Done() <-chan struct{} {
+	return s.done
+}
+
+// Reason returns the reason passed to Abort, or an empty string if it wasn't called.
+func (s *AbortSignal) Reason() string {
+	select {
+	case <-s.done:
+		return s.reason
+	default:
+		return ""
+	}
+}
+
+// afterAbort calls f once the signal is aborted, unless stop was called first.
+func (s *AbortSignal) afterAbort(f func()) (stop func()) {
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-s.done:
+			f()
+		case <-stopped:
+		}
+	}()
+	return func() { close(stopped) }
+}
+
+// wrap returns an *AbortError wrapping err if the signal is aborted.
+func (s *AbortSignal) wrap(err error) error {
+	if s == nil || err == nil {
+		return err
+	}
+	select {
+	case <-s.done:
+		return &AbortError{Reason: s.reason, Err: err}
+	default:
+		return err
+	}
+}
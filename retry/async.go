@@ -0,0 +1,58 @@
+package retry
+
+import (
+	"context"
+)
+
+// Handle tracks a retry loop started with Go.
+type Handle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Go runs the retry loop of DoWithContext in a new goroutine, e.g. to deliver a webhook without
+// blocking the caller, and returns a Handle to wait for or cancel it. The loop stops when ctx is
+// done or Cancel is called.
+func Go(ctx context.Context, fn RetryableFuncWithContext, opts Options) *Handle {
+	ctx, cancel := context.WithCancel(ctx)
+	h := &Handle{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(h.done)
+		defer cancel()
+		h.err = DoWithContext(ctx, fn, opts)
+	}()
+	return h
+}
+
+// Done returns a channel that is closed once the retry loop returned.
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Err returns the error of the retry loop, or nil while it is running.
+func (h *Handle) Err() error {
+	select {
+	case <-h.done:
+		return h.err
+	default:
+		return nil
+	}
+}
+
+// Wait waits until the retry loop returned or ctx is done and returns the error of the loop, or
+// the context error.
+func (h *Handle) Wait(ctx context.Context) error {
+	select {
+	case <-h.done:
+		return h.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Cancel stops the retry loop. The context of the running attempt is canceled and no further
+// attempts are made. Done is closed once the loop returned.
+func (h *Handle) Cancel() {
+	h.cancel()
+}
@@ -0,0 +1,78 @@
+package retry
+
+import (
+	"errors"
+	"sync"
+)
+
+const (
+	defaultBudgetMaxTokens     = 10
+	defaultBudgetRetryCost     = 1
+	defaultBudgetSuccessRefill = 0.1
+)
+
+var (
+	// ErrBudgetExhausted is returned, wrapping the last error, when a shared Budget has no
+	// tokens left for a retry.
+	ErrBudgetExhausted = errors.New("retry budget has no tokens left")
+)
+
+type BudgetOptions struct {
+	// MaxTokens is the capacity of the budget, which starts full. Defaults to 10.
+	MaxTokens float64
+	// RetryCost is the number of tokens a retry takes. Defaults to 1.
+	RetryCost float64
+	// SuccessRefill is the number of tokens a successful call returns. Defaults to 0.1, which
+	// allows one retry per 10 successes once the budget is drained.
+	SuccessRefill float64
+}
+
+// Budget is a token bucket of retries shared by many retry loops, e.g. all calls to one
+// dependency. Retries take tokens and successful calls refill them, so the retries of all loops
+// are bounded relative to the successful calls while the dependency is struggling. It is safe
+// for concurrent use.
+type Budget struct {
+	opts   BudgetOptions
+	mu     sync.Mutex
+	tokens float64
+}
+
+func NewBudget() *Budget {
+	return NewBudgetWithOptions(BudgetOptions{})
+}
+
+func NewBudgetWithOptions(opts BudgetOptions) *Budget {
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = defaultBudgetMaxTokens
+	}
+	if opts.RetryCost <= 0 {
+		opts.RetryCost = defaultBudgetRetryCost
+	}
+	if opts.SuccessRefill <= 0 {
+		opts.SuccessRefill = defaultBudgetSuccessRefill
+	}
+	return &Budget{opts: opts, tokens: opts.MaxTokens}
+}
+
+// Tokens returns the number of tokens left.
+func (b *Budget) Tokens() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens
+}
+
+func (b *Budget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < b.opts.RetryCost {
+		return false
+	}
+	b.tokens -= b.opts.RetryCost
+	return true
+}
+
+func (b *Budget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.opts.SuccessRefill, b.opts.MaxTokens)
+}
@@ -48,6 +48,33 @@ func ExponentialBackoffDelayer(coefficient int) Delayer {
 	})
 }
 
+// ExponentialDelayer returns delays starting at initial and multiplied by multiplier after every
+// attempt: initial, initial*multiplier, initial*multiplier^2 and so on.
+func ExponentialDelayer(initial time.Duration, multiplier float64) Delayer {
+	return DelayerFunc(func(startTime time.Time, attempts int, err error) time.Duration {
+		d := float64(initial) * math.Pow(multiplier, float64(attempts-1))
+		if d >= math.MaxInt64 {
+			return math.MaxInt64
+		}
+		return time.Duration(d)
+	})
+}
+
+// FibonacciDelayer returns delays growing with the Fibonacci sequence: unit, unit, 2*unit,
+// 3*unit, 5*unit and so on. It grows slower than ExponentialBackoffDelayer.
+func FibonacciDelayer(unit time.Duration) Delayer {
+	return DelayerFunc(func(startTime time.Time, attempts int, err error) time.Duration {
+		prev, curr := time.Duration(0), unit
+		for i := 1; i < attempts; i++ {
+			if curr > math.MaxInt64-prev {
+				return math.MaxInt64
+			}
+			prev, curr = curr, prev+curr
+		}
+		return curr
+	})
+}
+
 func RandomDelayer(minDelay time.Duration, maxJitter time.Duration) Delayer {
 	rnd := random.New()
 	return DelayerFunc(func(startTime time.Time, attempts int, err error) time.Duration {
@@ -0,0 +1,131 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/gpahal/golib/circuitbreaker"
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err to stop the retries immediately, e.g. from deep inside the retried
+// function when a request is rejected as invalid. The retries return err itself, not the
+// wrapper. Permanent returns nil if err is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err or any error it wraps was wrapped with Permanent.
+func IsPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+type delayHintError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *delayHintError) Error() string {
+	return e.err.Error()
+}
+
+func (e *delayHintError) Unwrap() error {
+	return e.err
+}
+
+// DelayHint wraps err to make the next attempt wait d instead of the delay of the Delayer, e.g.
+// the Retry-After of a 429 response. The hint isn't capped by Options.MaxDelay, but still counts
+// towards Options.MaxElapsedTime. DelayHint returns nil if err is nil.
+func DelayHint(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &delayHintError{err: err, delay: d}
+}
+
+// DelayHintFrom returns the delay hinted by err or any error it wraps.
+func DelayHintFrom(err error) (time.Duration, bool) {
+	var dhe *delayHintError
+	if !errors.As(err, &dhe) {
+		return 0, false
+	}
+	return dhe.delay, true
+}
+
+// PanicError is the error a panic of a retried function is converted into when
+// Options.RecoverPanics is set.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// IsTransient reports whether err, or any error it wraps, is a failure that commonly goes away
+// on its own: network timeouts, including TLS handshake timeouts, refused, reset and aborted
+// connections, broken pipes, temporary DNS failures and unexpected EOFs. It is the default of
+// Options.RetryIf.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// RetryAll retries all errors. It can be used as Options.RetryIf to retry errors that aren't
+// transient, e.g. the errors of functions that don't wrap the underlying network errors.
+func RetryAll(err error) bool {
+	return true
+}
+
+// defaultRetryIf is the default of Options.RetryIf. Besides transient errors, it retries the
+// errors the retry loop itself produces for options that ask for retries: unaccepted results of
+// Until, rejections of the breaker and recovered panics.
+func defaultRetryIf(err error) bool {
+	var pe *PanicError
+	return IsTransient(err) ||
+		errors.As(err, &pe) ||
+		errors.Is(err, ErrConditionNotMet) ||
+		errors.Is(err, circuitbreaker.ErrOpen) ||
+		errors.Is(err, circuitbreaker.ErrTooManyRequests)
+}
@@ -0,0 +1,85 @@
+package retry
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	// EventRetrying is sent after a failed attempt, before waiting for the next one.
+	EventRetrying EventKind = iota
+	// EventSucceeded is sent once an attempt succeeded.
+	EventSucceeded
+	// EventGaveUp is sent once the retries stopped without success.
+	EventGaveUp
+)
+
+// Event describes the progress of a retry loop. See Options.Events.
+type Event struct {
+	Kind EventKind
+	// Name is Options.Name.
+	Name string
+	// Attempt is the number of the last attempt, starting at 1.
+	Attempt int
+	// MaxAttempts is the maximum number of attempts if the Stopper is a MaxAttemptsStopper, or
+	// 0 otherwise.
+	MaxAttempts int
+	// Delay is the delay before the next attempt of EventRetrying events.
+	Delay time.Duration
+	// Err is the error of the last attempt, or the error returned by the retry loop for
+	// EventGaveUp events.
+	Err error
+}
+
+// String describes the event for humans, e.g. "retrying in 4s (attempt 3/5): connection
+// refused".
+func (e Event) String() string {
+	switch e.Kind {
+	case EventRetrying:
+		return fmt.Sprintf("retrying in %s (attempt %s): %v", e.Delay, e.attempts(e.Attempt+1), e.Err)
+	case EventSucceeded:
+		return fmt.Sprintf("succeeded (attempt %s)", e.attempts(e.Attempt))
+	default:
+		return fmt.Sprintf("gave up (attempt %s): %v", e.attempts(e.Attempt), e.Err)
+	}
+}
+
+func (e Event) attempts(attempt int) string {
+	if e.MaxAttempts <= 0 {
+		return fmt.Sprint(attempt)
+	}
+	return fmt.Sprintf("%d/%d", attempt, e.MaxAttempts)
+}
+
+// notify sends evt to ch without blocking, dropping the oldest event if ch is full. Unbuffered
+// channels have no oldest event to drop, so evt is dropped if no receiver is waiting.
+func notify(ch chan Event, evt Event) {
+	if cap(ch) == 0 {
+		select {
+		case ch <- evt:
+		default:
+		}
+		return
+	}
+	for {
+		select {
+		case ch <- evt:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
+
+func maxAttempts(stopper Stopper) int {
+	if s, ok := stopper.(maxAttemptsStopper); ok {
+		return int(s)
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// GroupOptions configures a Group.
+type GroupOptions struct {
+	// Limit, if positive, is the maximum number of tasks running concurrently. Go blocks until a
+	// task finished once the limit is reached.
+	Limit int
+	// CancelOnError cancels the context of the other tasks once a task failed.
+	CancelOnError bool
+}
+
+// TaskResult is the result of a task of a Group.
+type TaskResult[T any] struct {
+	Name     string
+	Value    T
+	Err      error
+	Attempts int
+}
+
+// Group runs tasks concurrently, each retried with its own policy, e.g. the batches of an
+// import against a flaky downstream. It is similar to errgroup.Group but collects the results of
+// all tasks.
+type Group[T any] struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	opts   GroupOptions
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	results []TaskResult[T]
+}
+
+func NewGroup[T any](ctx context.Context) *Group[T] {
+	return NewGroupWithOptions[T](ctx, GroupOptions{})
+}
+
+func NewGroupWithOptions[T any](ctx context.Context, opts GroupOptions) *Group[T] {
+	ctx, cancel := context.WithCancel(ctx)
+	g := &Group[T]{ctx: ctx, cancel: cancel, opts: opts}
+	if opts.Limit > 0 {
+		g.sem = make(chan struct{}, opts.Limit)
+	}
+	return g
+}
+
+// Go starts a task retrying fn with opts. Options.Name defaults to name.
+func (g *Group[T]) Go(name string, fn func(ctx context.Context) (T, error), opts Options) {
+	if opts.Name == "" {
+		opts.Name = name
+	}
+
+	g.mu.Lock()
+	i := len(g.results)
+	g.results = append(g.results, TaskResult[T]{Name: name})
+	g.mu.Unlock()
+
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if g.sem != nil {
+			defer func() { <-g.sem }()
+		}
+
+		attempts := 0
+		v, err := DoWithDataWithContext(g.ctx, func(ctx context.Context) (T, error) {
+			attempts += 1
+			return fn(ctx)
+		}, opts)
+		if err != nil && g.opts.CancelOnError {
+			g.cancel()
+		}
+
+		g.mu.Lock()
+		g.results[i] = TaskResult[T]{Name: name, Value: v, Err: err, Attempts: attempts}
+		g.mu.Unlock()
+	}()
+}
+
+// Wait waits for all tasks and returns their results in the order they were added. The error
+// joins the errors of the failed tasks, each prefixed with the task name.
+func (g *Group[T]) Wait() ([]TaskResult[T], error) {
+	g.wg.Wait()
+	g.cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var errs []error
+	for _, r := range g.results {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Name, r.Err))
+		}
+	}
+	return g.results, errors.Join(errs...)
+}
@@ -0,0 +1,65 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Hedged calls fn and, if it hasn't returned after hedgeDelay, calls it again concurrently. It
+// returns the value of the first successful attempt and cancels the context of the others, which
+// lowers the tail latency of idempotent reads. Failed attempts start the next one right away.
+// maxParallel caps the total number of attempts, including the ones started after failures, so
+// at most maxParallel attempts run concurrently. If all attempts fail, it returns the errors of
+// all of them joined with errors.Join.
+func Hedged[T any](ctx context.Context, fn func(ctx context.Context) (T, error), hedgeDelay time.Duration, maxParallel int) (T, error) {
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		v   T
+		err error
+	}
+	results := make(chan result, maxParallel)
+	start := func() {
+		go func() {
+			v, err := fn(ctx)
+			results <- result{v: v, err: err}
+		}()
+	}
+
+	timer := time.NewTimer(hedgeDelay)
+	defer timer.Stop()
+	start()
+	started, finished := 1, 0
+	var zero T
+	var errs []error
+	for {
+		select {
+		case r := <-results:
+			finished += 1
+			if r.err == nil {
+				return r.v, nil
+			}
+			errs = append(errs, r.err)
+			if started < maxParallel {
+				start()
+				started += 1
+			} else if finished == started {
+				return zero, errors.Join(errs...)
+			}
+		case <-timer.C:
+			if started < maxParallel {
+				start()
+				started += 1
+				timer.Reset(hedgeDelay)
+			}
+		case <-ctx.Done():
+			return zero, contextError(ctx.Err(), finished, errors.Join(errs...))
+		}
+	}
+}
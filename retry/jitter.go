@@ -0,0 +1,92 @@
+package retry
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Jitter randomizes the delays between attempts, so that clients that failed at the same time
+// don't retry in lockstep.
+type Jitter int
+
+const (
+	// JitterNone uses the delays of the Delayer as they are.
+	JitterNone Jitter = iota
+	// JitterFull waits a random duration between 0 and the delay.
+	JitterFull
+	// JitterEqual waits half the delay plus a random duration up to the other half.
+	JitterEqual
+	// JitterDecorrelated waits a random duration between the first delay and three times the
+	// previous delay, as described in the AWS architecture blog. It ignores the growth of the
+	// Delayer after the first attempt, so MaxDelay should be set.
+	JitterDecorrelated
+)
+
+func (j Jitter) String() string {
+	switch j {
+	case JitterNone:
+		return "none"
+	case JitterFull:
+		return "full"
+	case JitterEqual:
+		return "equal"
+	case JitterDecorrelated:
+		return "decorrelated"
+	default:
+		return "unknown"
+	}
+}
+
+// jitterer applies a Jitter to the delays of a single retry loop.
+type jitterer struct {
+	jitter   Jitter
+	maxDelay time.Duration
+	// rnd is the source of randomness, or nil to use the global one.
+	rnd  *rand.Rand
+	base time.Duration
+	prev time.Duration
+}
+
+func (j *jitterer) apply(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+
+	switch j.jitter {
+	case JitterFull:
+		return j.randDuration(0, d)
+	case JitterEqual:
+		return d/2 + j.randDuration(0, d-d/2)
+	case JitterDecorrelated:
+		if j.base == 0 {
+			j.base, j.prev = d, d
+		}
+		upper := j.prev
+		if upper < math.MaxInt64/3 {
+			upper *= 3
+		}
+		j.prev = j.randDuration(j.base, upper)
+		if j.maxDelay > 0 && j.prev > j.maxDelay {
+			j.prev = j.maxDelay
+		}
+		return j.prev
+	default:
+		return d
+	}
+}
+
+// randDuration returns a random duration in [lower, upper].
+func (j *jitterer) randDuration(lower, upper time.Duration) time.Duration {
+	if upper <= lower {
+		return lower
+	}
+	n := int64(upper - lower)
+	if n < math.MaxInt64 {
+		n += 1
+	}
+	if j.rnd != nil {
+		return lower + time.Duration(j.rnd.Int64N(n))
+	}
+	return lower + time.Duration(rand.Int64N(n))
+}
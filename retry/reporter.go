@@ -0,0 +1,31 @@
+package retry
+
+import (
+	"time"
+)
+
+// Reporter observes the attempts of retry loops, e.g. to export metrics per operation. The
+// name is Options.Name. Implementations must be safe for concurrent use.
+type Reporter interface {
+	// AttemptStarted is called before every attempt, starting at 1.
+	AttemptStarted(name string, attempt int)
+	// AttemptSucceeded is called when an attempt succeeded, with its duration.
+	AttemptSucceeded(name string, attempt int, duration time.Duration)
+	// AttemptFailed is called when an attempt failed, with its duration.
+	AttemptFailed(name string, attempt int, duration time.Duration, err error)
+	// GaveUp is called when the retries stopped without success, with the number of attempts
+	// and the time since the first one started.
+	GaveUp(name string, attempts int, elapsed time.Duration, err error)
+}
+
+// NopReporter is a Reporter that ignores all events. It can be embedded by reporters only
+// interested in some events.
+type NopReporter struct{}
+
+func (NopReporter) AttemptStarted(name string, attempt int) {}
+
+func (NopReporter) AttemptSucceeded(name string, attempt int, duration time.Duration) {}
+
+func (NopReporter) AttemptFailed(name string, attempt int, duration time.Duration, err error) {}
+
+func (NopReporter) GaveUp(name string, attempts int, elapsed time.Duration, err error) {}
@@ -0,0 +1,180 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	retriers sync.Map // map[string]*Retrier
+)
+
+// Retrier retries functions with a policy that can be replaced at runtime, e.g. after the
+// configuration was reloaded. It is safe for concurrent use.
+type Retrier struct {
+	opts  atomic.Pointer[Options]
+	abort atomic.Pointer[AbortSignal]
+}
+
+func New(opts Options) *Retrier {
+	r := &Retrier{}
+	r.SetOptions(opts)
+	r.abort.Store(NewAbortSignal())
+	return r
+}
+
+// Options returns the current policy.
+func (r *Retrier) Options() Options {
+	return *r.opts.Load()
+}
+
+// SetOptions replaces the policy. Retry loops already running keep the previous one.
+func (r *Retrier) SetOptions(opts Options) {
+	r.opts.Store(&opts)
+}
+
+func (r *Retrier) Do(fn RetryableFunc) error {
+	return Do(fn, r.runOptions())
+}
+
+func (r *Retrier) DoWithContext(ctx context.Context, fn RetryableFuncWithContext) error {
+	return DoWithContext(ctx, fn, r.runOptions())
+}
+
+// Stop aborts the retry loops of the Retrier that are running, which return an *AbortError
+// with the reason. Later calls of Do and DoWithContext run normally.
+func (r *Retrier) Stop(reason string) {
+	r.abort.Swap(NewAbortSignal()).Abort(reason)
+}
+
+// runOptions returns the current policy with the abort signal of the running loops, unless the
+// policy sets its own.
+func (r *Retrier) runOptions() Options {
+	opts := r.Options()
+	if opts.Abort == nil {
+		opts.Abort = r.abort.Load()
+	}
+	return opts
+}
+
+// Register registers a named policy, e.g. "db" or "upstream-x", and returns its Retrier. If the
+// name is already registered, the policy of the existing Retrier is replaced, so call sites
+// holding it pick up the change. Options.Name defaults to name.
+func Register(name string, opts Options) *Retrier {
+	if opts.Name == "" {
+		opts.Name = name
+	}
+	r := New(opts)
+	if existing, loaded := retriers.LoadOrStore(name, r); loaded {
+		r = existing.(*Retrier)
+		r.SetOptions(opts)
+	}
+	return r
+}
+
+// Get returns the Retrier registered under name.
+func Get(name string) (*Retrier, bool) {
+	r, ok := retriers.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return r.(*Retrier), true
+}
+
+// PolicyConfig is the configuration of a retry policy, e.g. loaded with the config package.
+// Durations are strings parsed with time.ParseDuration.
+type PolicyConfig struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	MaxAttempts int `json:"max_attempts" mapstructure:"max_attempts"`
+	// Delay is the delay after the first attempt.
+	Delay string `json:"delay" mapstructure:"delay"`
+	// Multiplier, if greater than 1, multiplies the delay after every attempt. Otherwise the
+	// delay is fixed.
+	Multiplier     float64 `json:"multiplier" mapstructure:"multiplier"`
+	MaxDelay       string  `json:"max_delay" mapstructure:"max_delay"`
+	MaxElapsedTime string  `json:"max_elapsed_time" mapstructure:"max_elapsed_time"`
+	AttemptTimeout string  `json:"attempt_timeout" mapstructure:"attempt_timeout"`
+	// Jitter is one of none, full, equal and decorrelated.
+	Jitter string `json:"jitter" mapstructure:"jitter"`
+	// Schedule, if set, is an explicit list of delays in the format of ParseSchedule, e.g.
+	// "1m,5m,30m,2h,1d", used instead of MaxAttempts, Delay and Multiplier.
+	Schedule string `json:"schedule" mapstructure:"schedule"`
+}
+
+// Options returns the Options of the policy.
+func (pc PolicyConfig) Options() (Options, error) {
+	var opts Options
+	var err error
+	if pc.Schedule != "" {
+		schedule, err := ParseSchedule(pc.Schedule)
+		if err != nil {
+			return opts, err
+		}
+		opts = schedule.Options()
+	} else {
+		if pc.MaxAttempts > 0 {
+			opts.Stopper = MaxAttemptsStopper(pc.MaxAttempts)
+		}
+
+		delay, err := parseDuration(pc.Delay)
+		if err != nil {
+			return opts, fmt.Errorf("retry: invalid delay: %w", err)
+		}
+		if pc.Multiplier > 1 {
+			opts.Delayer = ExponentialDelayer(delay, pc.Multiplier)
+		} else {
+			opts.Delayer = FixedDelayer(delay)
+		}
+	}
+	if opts.MaxDelay, err = parseDuration(pc.MaxDelay); err != nil {
+		return opts, fmt.Errorf("retry: invalid max delay: %w", err)
+	}
+	if opts.MaxElapsedTime, err = parseDuration(pc.MaxElapsedTime); err != nil {
+		return opts, fmt.Errorf("retry: invalid max elapsed time: %w", err)
+	}
+	if opts.AttemptTimeout, err = parseDuration(pc.AttemptTimeout); err != nil {
+		return opts, fmt.Errorf("retry: invalid attempt timeout: %w", err)
+	}
+
+	switch strings.ToLower(pc.Jitter) {
+	case "", "none":
+		opts.Jitter = JitterNone
+	case "full":
+		opts.Jitter = JitterFull
+	case "equal":
+		opts.Jitter = JitterEqual
+	case "decorrelated":
+		opts.Jitter = JitterDecorrelated
+	default:
+		return opts, fmt.Errorf("retry: invalid jitter %q", pc.Jitter)
+	}
+	return opts, nil
+}
+
+// RegisterPolicies registers the configured policies by name. Policies that are already
+// registered are replaced. Nothing is registered if any policy is invalid.
+func RegisterPolicies(policies map[string]PolicyConfig) error {
+	optsByName := make(map[string]Options, len(policies))
+	for name, pc := range policies {
+		opts, err := pc.Options()
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", name, err)
+		}
+		optsByName[name] = opts
+	}
+	for name, opts := range optsByName {
+		Register(name, opts)
+	}
+	return nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -1,19 +1,187 @@
 package retry
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"math/rand/v2"
+	"runtime/debug"
+	"strings"
 	"time"
+
+	"github.com/gpahal/golib/circuitbreaker"
 )
 
 var (
 	ErrStop = errors.New("stop retries")
+	// ErrRetryBudgetExceeded is returned, wrapping the last error, when the next attempt would
+	// start after Options.MaxElapsedTime.
+	ErrRetryBudgetExceeded = errors.New("retry budget exceeded")
+	// ErrInvalidOptions is returned, wrapped with the reason, when the Options are invalid.
+	ErrInvalidOptions = errors.New("invalid retry options")
+)
+
+const (
+	// DefaultMultiplier is the multiplier of the delays when Options.InitialDelay is set without
+	// Options.Multiplier.
+	DefaultMultiplier = 2.0
+
+	scheduleStringDelays = 8
 )
 
 type RetryableFunc func() error
 
+type RetryableFuncWithContext func(ctx context.Context) error
+
+// Options configures the retries. Delayer selects the backoff strategy, e.g. FixedDelayer,
+// LinearDelayer, ExponentialBackoffDelayer or FibonacciDelayer. For exponential backoff,
+// InitialDelay and Multiplier can be set instead. Without a delay or a Stopper fn is only called
+// once.
 type Options struct {
 	Delayer Delayer
 	Stopper Stopper
+	// InitialDelay, if set and Delayer is not, is the delay after the first attempt. The delay
+	// is multiplied by Multiplier after every further attempt.
+	InitialDelay time.Duration
+	// Multiplier is the growth factor of the delays starting at InitialDelay. It must be at
+	// least 1, which keeps the delay fixed. Defaults to DefaultMultiplier.
+	Multiplier float64
+	// MaxDelay, if set, caps the delay between attempts.
+	MaxDelay time.Duration
+	// Jitter randomizes the delays. Defaults to JitterNone.
+	Jitter Jitter
+	// RandSource, if set, is the source of the randomness of the Jitter, e.g. rand.NewPCG with a
+	// fixed seed to make the delays reproducible in tests. Sources are not safe for concurrent
+	// use, so concurrent retry loops must not share one. Defaults to the securely seeded global
+	// source of math/rand/v2.
+	RandSource rand.Source
+	// MaxElapsedTime, if set, stops the retries once the next attempt would start later than
+	// MaxElapsedTime after the first one, regardless of the Stopper.
+	MaxElapsedTime time.Duration
+	// OnRetry, if set, is called before waiting for the next attempt with the number of the
+	// failed attempt, the delay and its error, e.g. to log the failure or refresh a token.
+	OnRetry func(attempt int, delay time.Duration, err error)
+	// RetryIf decides whether an error is retried. Other errors are returned immediately.
+	// Defaults to retrying transient errors, see IsTransient, as well as ErrConditionNotMet, the
+	// rejections of Breaker and the panics recovered with RecoverPanics. Use RetryAll to retry
+	// all errors.
+	RetryIf func(err error) bool
+	// Budget, if set, limits the retries together with the other retry loops sharing it.
+	Budget *Budget
+	// Name identifies the retried operation for the Reporter, e.g. "db.query".
+	Name string
+	// Reporter, if set, observes the attempts, e.g. to export metrics.
+	Reporter Reporter
+	// JoinErrors returns the errors of all attempts joined with errors.Join, each prefixed with
+	// its attempt number, instead of only the last one.
+	JoinErrors bool
+	// AttemptTimeout, if set, runs every attempt with a context that is done after the timeout,
+	// so that a hung attempt can't use up the whole retry budget. Only functions passed to
+	// DoWithContext and DoWithDataWithContext receive the context.
+	AttemptTimeout time.Duration
+	// Clock is the source of time of the delays and elapsed times. Defaults to RealClock.
+	Clock Clock
+	// RecoverPanics converts panics of fn into *PanicError errors, which are retried like other
+	// errors unless RetryIf rejects them.
+	RecoverPanics bool
+	// Limiter, if set, is waited for before every attempt, including the first one. Sharing a
+	// *rate.Limiter of golang.org/x/time/rate between retry loops keeps all their attempts
+	// within the rate limit of an upstream.
+	Limiter Limiter
+	// Events, if set, receives the progress of the retries, e.g. to display "retrying in 4s
+	// (attempt 3/5)" in a CLI. Sending never blocks: if the channel is full, the oldest event is
+	// dropped. Events sent to an unbuffered channel are dropped unless a receiver is waiting, so
+	// the channel should be buffered. The channel is not closed.
+	Events chan Event
+	// Breaker, if set, guards every attempt. Attempts rejected by the breaker fail with
+	// circuitbreaker.ErrOpen or circuitbreaker.ErrTooManyRequests without calling fn, and are
+	// retried like other errors unless RetryIf rejects them.
+	Breaker *circuitbreaker.Breaker
+	// Abort, if set, aborts the retries once it is aborted, see AbortSignal.
+	Abort *AbortSignal
+}
+
+// Limiter limits the rate of attempts. It is implemented by *rate.Limiter of
+// golang.org/x/time/rate.
+type Limiter interface {
+	// Wait blocks until an attempt is allowed. It returns an error if ctx is done first or the
+	// attempt can't be allowed before the deadline of ctx.
+	Wait(ctx context.Context) error
+}
+
+// Validate returns an error wrapping ErrInvalidOptions if the delays are invalid.
+func (opts Options) Validate() error {
+	switch {
+	case opts.InitialDelay < 0:
+		return fmt.Errorf("%w: negative initial delay", ErrInvalidOptions)
+	case opts.InitialDelay > 0 && opts.Delayer != nil:
+		return fmt.Errorf("%w: both initial delay and delayer set", ErrInvalidOptions)
+	case opts.Multiplier != 0 && opts.Multiplier < 1:
+		return fmt.Errorf("%w: multiplier %g less than 1", ErrInvalidOptions, opts.Multiplier)
+	case opts.MaxDelay < 0:
+		return fmt.Errorf("%w: negative max delay", ErrInvalidOptions)
+	case opts.MaxDelay > 0 && opts.MaxDelay < opts.InitialDelay:
+		return fmt.Errorf("%w: max delay %s less than initial delay %s", ErrInvalidOptions, opts.MaxDelay, opts.InitialDelay)
+	}
+	return nil
+}
+
+// delayer returns the Delayer, or the exponential one of InitialDelay and Multiplier.
+func (opts Options) delayer() Delayer {
+	if opts.Delayer != nil || opts.InitialDelay <= 0 {
+		return opts.Delayer
+	}
+	multiplier := opts.Multiplier
+	if multiplier == 0 {
+		multiplier = DefaultMultiplier
+	}
+	return ExponentialDelayer(opts.InitialDelay, multiplier)
+}
+
+// String describes the retry schedule for logging, e.g.
+// "delays 100ms, 200ms, 400ms, 800ms, 1s, ... jitter full".
+func (opts Options) String() string {
+	delayer := opts.delayer()
+	// The delays end after the last attempt if the maximum number of attempts is known.
+	delays := maxAttempts(opts.Stopper) - 1
+	if delayer == nil || opts.Stopper == nil || delays == 0 {
+		return "no retries"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("delays ")
+	startTime := time.Now()
+	for attempts := 1; ; attempts++ {
+		d := delayer.Delay(startTime, attempts, nil)
+		capped := opts.MaxDelay > 0 && d >= opts.MaxDelay
+		if capped {
+			d = opts.MaxDelay
+		}
+		if attempts > 1 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(formatScheduleDelay(d))
+		if attempts == delays {
+			break
+		}
+		if capped || attempts == scheduleStringDelays {
+			sb.WriteString(", ...")
+			break
+		}
+	}
+	if opts.Jitter != JitterNone {
+		sb.WriteString(" jitter ")
+		sb.WriteString(opts.Jitter.String())
+	}
+	if opts.MaxElapsedTime > 0 {
+		sb.WriteString(" max elapsed time ")
+		sb.WriteString(opts.MaxElapsedTime.String())
+	}
+	if opts.AttemptTimeout > 0 {
+		sb.WriteString(" attempt timeout ")
+		sb.WriteString(opts.AttemptTimeout.String())
+	}
+	return sb.String()
 }
 
 func Do(fn RetryableFunc, opts Options) error {
@@ -21,22 +189,216 @@ func Do(fn RetryableFunc, opts Options) error {
 		return nil
 	}
 
-	startTime := time.Now()
+	return DoWithContext(context.Background(), func(ctx context.Context) error {
+		return fn()
+	}, opts)
+}
+
+// DoWithContext calls fn until it succeeds or the retries stop. It stops when ctx is done, both
+// between attempts and while waiting for the next one, returning an error that wraps ctx.Err()
+// and the last error of fn. If the next attempt would start after the deadline of ctx, it
+// returns such an error wrapping context.DeadlineExceeded right away instead of waiting. Invalid
+// options are reported with an error wrapping ErrInvalidOptions without calling fn. Retries
+// aborted with Options.Abort return an *AbortError.
+func DoWithContext(ctx context.Context, fn RetryableFuncWithContext, opts Options) error {
+	if fn == nil {
+		return nil
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	opts.Delayer = opts.delayer()
+	if opts.RetryIf == nil {
+		opts.RetryIf = defaultRetryIf
+	}
+	if opts.Clock == nil {
+		opts.Clock = RealClock
+	}
+	if opts.Abort != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		defer opts.Abort.afterAbort(cancel)()
+	}
+	if opts.Reporter == nil && opts.Events == nil {
+		return opts.Abort.wrap(doWithContext(ctx, fn, opts))
+	}
+
+	clock := opts.Clock
+	startTime := clock.Now()
+	attempts := 0
+	err := doWithContext(ctx, func(ctx context.Context) error {
+		attempts += 1
+		if opts.Reporter == nil {
+			return fn(ctx)
+		}
+
+		opts.Reporter.AttemptStarted(opts.Name, attempts)
+		attemptStartTime := clock.Now()
+		err := fn(ctx)
+		if err == nil {
+			opts.Reporter.AttemptSucceeded(opts.Name, attempts, clock.Now().Sub(attemptStartTime))
+		} else {
+			opts.Reporter.AttemptFailed(opts.Name, attempts, clock.Now().Sub(attemptStartTime), err)
+		}
+		return err
+	}, opts)
+	err = opts.Abort.wrap(err)
+	if err != nil && opts.Reporter != nil {
+		opts.Reporter.GaveUp(opts.Name, attempts, clock.Now().Sub(startTime), err)
+	}
+	if opts.Events != nil {
+		evt := Event{Kind: EventSucceeded, Name: opts.Name, Attempt: attempts, MaxAttempts: maxAttempts(opts.Stopper)}
+		if err != nil {
+			evt.Kind, evt.Err = EventGaveUp, err
+		}
+		notify(opts.Events, evt)
+	}
+	return err
+}
+
+func doWithContext(ctx context.Context, fn RetryableFuncWithContext, opts Options) error {
+	clock := opts.Clock
+	startTime := clock.Now()
 	attempts := 0
+	jitter := &jitterer{jitter: opts.Jitter, maxDelay: opts.MaxDelay}
+	if opts.RandSource != nil {
+		jitter.rnd = rand.New(opts.RandSource)
+	}
+	var errs []error
+	var lastErr error
+	// result returns the error to return for the last error of fn.
+	result := func(err error) error {
+		if !opts.JoinErrors || len(errs) == 0 {
+			return err
+		}
+		return errors.Join(errs...)
+	}
 	for {
-		err := fn()
-		if err == nil || err == ErrStop || opts.Stopper == nil || opts.Delayer == nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return contextError(ctxErr, attempts, result(lastErr))
+		}
+		if opts.Limiter != nil {
+			if limitErr := opts.Limiter.Wait(ctx); limitErr != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					limitErr = ctxErr
+				}
+				return contextError(limitErr, attempts, result(lastErr))
+			}
+		}
+
+		err := attempt(ctx, fn, &opts)
+		if err == nil && opts.Budget != nil {
+			opts.Budget.deposit()
+		}
+		if err == nil || err == ErrStop {
 			return err
 		}
+		var pe *permanentError
+		if errors.As(err, &pe) {
+			err = pe.err
+		}
+		lastErr = err
+		if opts.JoinErrors {
+			errs = append(errs, fmt.Errorf("attempt %d: %w", attempts+1, err))
+		}
+		if pe != nil || opts.Stopper == nil || opts.Delayer == nil {
+			return result(err)
+		}
+		if !opts.RetryIf(err) {
+			return result(err)
+		}
 
 		attempts += 1
 		if opts.Stopper.Stop(startTime, attempts, err) {
-			return err
+			return result(err)
 		}
 
-		d := opts.Delayer.Delay(startTime, attempts, err)
-		if d.Nanoseconds() > 0 {
-			time.Sleep(d)
+		d, hinted := DelayHintFrom(err)
+		if !hinted {
+			d = jitter.apply(opts.Delayer.Delay(startTime, attempts, err))
+			if opts.MaxDelay > 0 && d > opts.MaxDelay {
+				d = opts.MaxDelay
+			}
 		}
+		if opts.MaxElapsedTime > 0 && clock.Now().Sub(startTime)+d > opts.MaxElapsedTime {
+			return fmt.Errorf("%w after %d attempts: %w", ErrRetryBudgetExceeded, attempts, result(err))
+		}
+		if deadline, ok := ctx.Deadline(); ok && clock.Now().Add(d).After(deadline) {
+			// The next attempt couldn't start before the deadline.
+			return contextError(context.DeadlineExceeded, attempts, result(err))
+		}
+		if opts.Budget != nil && !opts.Budget.withdraw() {
+			return fmt.Errorf("%w after %d attempts: %w", ErrBudgetExhausted, attempts, result(err))
+		}
+		if opts.OnRetry != nil {
+			opts.OnRetry(attempts, d, err)
+		}
+		if opts.Events != nil {
+			notify(opts.Events, Event{
+				Kind:        EventRetrying,
+				Name:        opts.Name,
+				Attempt:     attempts,
+				MaxAttempts: maxAttempts(opts.Stopper),
+				Delay:       d,
+				Err:         err,
+			})
+		}
+		if ctxErr := clock.Sleep(ctx, d); ctxErr != nil {
+			return contextError(ctxErr, attempts, result(err))
+		}
+	}
+}
+
+// attempt calls fn, with its own deadline if opts.AttemptTimeout is set.
+func attempt(ctx context.Context, fn RetryableFuncWithContext, opts *Options) (err error) {
+	if opts.Breaker != nil {
+		done, breakerErr := opts.Breaker.Allow()
+		if breakerErr != nil {
+			return breakerErr
+		}
+		// Deferred first to record the error of a recovered panic.
+		defer circuitbreaker.RecordPanic(done, &err)
+	}
+	if opts.RecoverPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+	}
+	if opts.AttemptTimeout <= 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.AttemptTimeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// DoWithData is like Do for functions returning a value. It returns the value and error of the
+// last attempt.
+func DoWithData[T any](fn func() (T, error), opts Options) (T, error) {
+	return DoWithDataWithContext(context.Background(), func(ctx context.Context) (T, error) {
+		return fn()
+	}, opts)
+}
+
+// DoWithDataWithContext is like DoWithContext for functions returning a value. It returns the
+// value and error of the last attempt.
+func DoWithDataWithContext[T any](ctx context.Context, fn func(ctx context.Context) (T, error), opts Options) (T, error) {
+	var v T
+	err := DoWithContext(ctx, func(ctx context.Context) error {
+		var err error
+		v, err = fn(ctx)
+		return err
+	}, opts)
+	return v, err
+}
+
+func contextError(ctxErr error, attempts int, lastErr error) error {
+	if lastErr == nil {
+		return ctxErr
 	}
+	return fmt.Errorf("%w after %d attempts: %w", ctxErr, attempts, lastErr)
 }
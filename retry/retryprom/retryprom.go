@@ -0,0 +1,73 @@
+// Package retryprom exports the attempts of retry loops as Prometheus metrics.
+package retryprom
+
+import (
+	"time"
+
+	"github.com/gpahal/golib/retry"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reporter is a retry.Reporter recording Prometheus metrics labelled with the operation name:
+//   - retry_attempts_total{operation,result}, result being "success" or "failure"
+//   - retry_attempt_duration_seconds{operation,result}
+//   - retry_retries_total{operation}, counting attempts after the first one
+//   - retry_gave_up_total{operation}
+type Reporter struct {
+	attempts        *prometheus.CounterVec
+	attemptDuration *prometheus.HistogramVec
+	retries         *prometheus.CounterVec
+	gaveUp          *prometheus.CounterVec
+}
+
+var _ retry.Reporter = (*Reporter)(nil)
+
+// NewReporter returns a Reporter whose metrics are registered with reg under the given
+// namespace, which may be empty. It panics if the metrics are already registered.
+func NewReporter(reg prometheus.Registerer, namespace string) *Reporter {
+	r := &Reporter{
+		attempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retry_attempts_total",
+			Help:      "Number of attempts of retried operations.",
+		}, []string{"operation", "result"}),
+		attemptDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "retry_attempt_duration_seconds",
+			Help:      "Duration of attempts of retried operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "result"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retry_retries_total",
+			Help:      "Number of attempts after the first one of retried operations.",
+		}, []string{"operation"}),
+		gaveUp: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retry_gave_up_total",
+			Help:      "Number of retried operations that failed after all attempts.",
+		}, []string{"operation"}),
+	}
+	reg.MustRegister(r.attempts, r.attemptDuration, r.retries, r.gaveUp)
+	return r
+}
+
+func (r *Reporter) AttemptStarted(name string, attempt int) {
+	if attempt > 1 {
+		r.retries.WithLabelValues(name).Inc()
+	}
+}
+
+func (r *Reporter) AttemptSucceeded(name string, attempt int, duration time.Duration) {
+	r.attempts.WithLabelValues(name, "success").Inc()
+	r.attemptDuration.WithLabelValues(name, "success").Observe(duration.Seconds())
+}
+
+func (r *Reporter) AttemptFailed(name string, attempt int, duration time.Duration, err error) {
+	r.attempts.WithLabelValues(name, "failure").Inc()
+	r.attemptDuration.WithLabelValues(name, "failure").Observe(duration.Seconds())
+}
+
+func (r *Reporter) GaveUp(name string, attempts int, elapsed time.Duration, err error) {
+	r.gaveUp.WithLabelValues(name).Inc()
+}
@@ -0,0 +1,166 @@
+package retryqueue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPostgresTable = "retryqueue_jobs"
+)
+
+var (
+	postgresTableRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+)
+
+// PostgresStore is a Store keeping jobs in a Postgres table. Several workers can claim jobs of
+// the same table concurrently.
+type PostgresStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewPostgresStore returns a store keeping jobs in the Postgres table with the given name, which
+// defaults to "retryqueue_jobs". db must use a Postgres driver, e.g. pgx or lib/pq. The table
+// is created by CreateTable.
+func NewPostgresStore(db *sql.DB, table string) *PostgresStore {
+	if table == "" {
+		table = defaultPostgresTable
+	}
+	if !postgresTableRegexp.MatchString(table) {
+		panic(fmt.Sprintf("retryqueue: invalid postgres table name %q", table))
+	}
+	return &PostgresStore{db: db, table: table}
+}
+
+// CreateTable creates the table of the store and its index if they don't exist.
+func (s *PostgresStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %[1]s (
+	id text PRIMARY KEY,
+	dead boolean NOT NULL DEFAULT false,
+	created_at timestamptz NOT NULL,
+	next_attempt_at timestamptz NOT NULL,
+	job jsonb NOT NULL
+);
+CREATE INDEX IF NOT EXISTS %[2]s_due_idx ON %[1]s (next_attempt_at) WHERE NOT dead;`, s.table, indexName(s.table)))
+	return err
+}
+
+func (s *PostgresStore) Save(ctx context.Context, job *Job) error {
+	bs, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(`
+INSERT INTO %s (id, dead, created_at, next_attempt_at, job) VALUES ($1, false, $2, $3, $4)
+ON CONFLICT (id) DO UPDATE SET dead = false, created_at = EXCLUDED.created_at,
+	next_attempt_at = EXCLUDED.next_attempt_at, job = EXCLUDED.job`, s.table),
+		job.ID, job.CreatedAt, job.NextAttemptAt, bs)
+	return err
+}
+
+func (s *PostgresStore) Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]*Job, error) {
+	// SKIP LOCKED lets concurrent workers claim different jobs instead of waiting on each other.
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+UPDATE %[1]s SET next_attempt_at = $2 WHERE id IN (
+	SELECT id FROM %[1]s WHERE NOT dead AND next_attempt_at <= $1
+	ORDER BY next_attempt_at LIMIT $3 FOR UPDATE SKIP LOCKED
+) RETURNING job`, s.table), now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING doesn't keep the order of the subquery.
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].NextAttemptAt.Before(jobs[j].NextAttemptAt) })
+	return jobs, nil
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = $1 AND NOT dead`, s.table), id)
+	return err
+}
+
+func (s *PostgresStore) DeadLetter(ctx context.Context, job *Job) error {
+	bs, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(`
+INSERT INTO %s (id, dead, created_at, next_attempt_at, job) VALUES ($1, true, $2, $3, $4)
+ON CONFLICT (id) DO UPDATE SET dead = true, job = EXCLUDED.job`, s.table),
+		job.ID, job.CreatedAt, job.NextAttemptAt, bs)
+	return err
+}
+
+func (s *PostgresStore) DeadLetters(ctx context.Context, limit int) ([]*Job, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+SELECT job FROM %s WHERE dead ORDER BY created_at LIMIT $1`, s.table), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+func (s *PostgresStore) Requeue(ctx context.Context, id string, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var bs []byte
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT job FROM %s WHERE id = $1 AND dead FOR UPDATE`, s.table), id).Scan(&bs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrJobNotFound
+	} else if err != nil {
+		return err
+	}
+	var job Job
+	if err := json.Unmarshal(bs, &job); err != nil {
+		return err
+	}
+	job.requeue(now)
+	if bs, err = json.Marshal(&job); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`
+UPDATE %s SET dead = false, next_attempt_at = $2, job = $3 WHERE id = $1`, s.table), id, job.NextAttemptAt, bs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanJobs(rows *sql.Rows) ([]*Job, error) {
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		var bs []byte
+		if err := rows.Scan(&bs); err != nil {
+			return nil, err
+		}
+		var job Job
+		if err := json.Unmarshal(bs, &job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, rows.Err()
+}
+
+// indexName returns the name of the index of table, without the schema of the table, since
+// indexes are created in the schema of their table.
+func indexName(table string) string {
+	return table[strings.LastIndexByte(table, '.')+1:]
+}
@@ -0,0 +1,284 @@
+// Package retryqueue retries operations with side effects, e.g. webhook deliveries or emails,
+// across process restarts. Jobs are persisted in a Store and retried with backoff until their
+// handler succeeds, at least once, or moved to the dead letters after the maximum number of
+// attempts.
+package retryqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gpahal/golib/retry"
+)
+
+const (
+	defaultMaxAttempts  = 10
+	defaultInitialDelay = time.Second
+	defaultMaxDelay     = time.Hour
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 10
+	defaultLease        = 5 * time.Minute
+)
+
+// Job is a persisted operation.
+type Job struct {
+	ID      string `json:"id"`
+	Kind    string `json:"kind"`
+	Payload []byte `json:"payload"`
+	// Attempts is the number of failed attempts.
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+	// Schedule, if set, is the retry.Schedule of the job, which is used instead of the delays
+	// and the maximum number of attempts of the queue.
+	Schedule      string    `json:"schedule,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+}
+
+func (j *Job) clone() *Job {
+	c := *j
+	return &c
+}
+
+func (j *Job) requeue(now time.Time) {
+	j.Attempts = 0
+	j.LastError = ""
+	j.NextAttemptAt = now
+}
+
+// Handler performs the operation of a job. Errors wrapped with retry.Permanent move the job to
+// the dead letters right away and errors wrapped with retry.DelayHint set the delay before the
+// next attempt.
+type Handler func(ctx context.Context, job *Job) error
+
+type Options struct {
+	// Store persists the jobs. Defaults to a MemoryStore.
+	Store Store
+	// Delayer returns the delay after the failed attempts of a job, with the creation time of
+	// the job as start time. Defaults to an exponential backoff starting at 1s.
+	Delayer retry.Delayer
+	// MaxDelay caps the delays. Defaults to 1h.
+	MaxDelay time.Duration
+	// MaxAttempts is the number of attempts after which a job is moved to the dead letters.
+	// Defaults to 10.
+	MaxAttempts int
+	// PollInterval is the interval at which Run claims due jobs. Defaults to 1s.
+	PollInterval time.Duration
+	// BatchSize is the maximum number of jobs claimed at once. Defaults to 10.
+	BatchSize int
+	// Concurrency is the number of jobs of a batch handled concurrently. Defaults to 1.
+	Concurrency int
+	// Lease is the time a claimed job is hidden from other workers. Handlers are canceled after
+	// the lease, since the job may be claimed again. Defaults to 5m.
+	Lease time.Duration
+	// OnDeadLetter, if set, is called when a job is moved to the dead letters, e.g. to alert.
+	OnDeadLetter func(job *Job, err error)
+	// OnError, if set, is called with the errors of the store.
+	OnError func(err error)
+	// Clock is the source of time. Defaults to retry.RealClock.
+	Clock retry.Clock
+}
+
+// Queue persists jobs and calls the handlers of their kinds until they succeed.
+type Queue struct {
+	opts Options
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+func New() *Queue {
+	return NewWithOptions(Options{})
+}
+
+func NewWithOptions(opts Options) *Queue {
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	if opts.Delayer == nil {
+		opts.Delayer = retry.ExponentialDelayer(defaultInitialDelay, retry.DefaultMultiplier)
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = defaultMaxDelay
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = defaultLease
+	}
+	if opts.Clock == nil {
+		opts.Clock = retry.RealClock
+	}
+	return &Queue{opts: opts, handlers: make(map[string]Handler)}
+}
+
+// Handle registers the handler of the jobs of kind, e.g. "webhook".
+func (q *Queue) Handle(kind string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = h
+}
+
+// Enqueue persists a job of kind that is due right away and returns it.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload []byte) (*Job, error) {
+	return q.EnqueueWithSchedule(ctx, kind, payload, nil)
+}
+
+// EnqueueWithSchedule is like Enqueue for a job retried with its own schedule, e.g. after 1m,
+// 5m, 30m, 2h and 1d for a settlement reconciliation. The schedule is persisted with the job,
+// so it survives restarts.
+func (q *Queue) EnqueueWithSchedule(ctx context.Context, kind string, payload []byte, schedule retry.Schedule) (*Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	now := q.opts.Clock.Now()
+	job := &Job{ID: id, Kind: kind, Payload: payload, CreatedAt: now, NextAttemptAt: now}
+	if len(schedule) > 0 {
+		job.Schedule = schedule.String()
+	}
+	if err := q.opts.Store.Save(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// DeadLetters returns up to limit dead letters, oldest first.
+func (q *Queue) DeadLetters(ctx context.Context, limit int) ([]*Job, error) {
+	return q.opts.Store.DeadLetters(ctx, limit)
+}
+
+// Requeue moves a dead letter back to the queue, e.g. after the downstream was fixed.
+func (q *Queue) Requeue(ctx context.Context, id string) error {
+	return q.opts.Store.Requeue(ctx, id, q.opts.Clock.Now())
+}
+
+// Run handles due jobs every PollInterval until ctx is done, and returns ctx.Err().
+func (q *Queue) Run(ctx context.Context) error {
+	for {
+		for {
+			n, err := q.ProcessDue(ctx)
+			if err != nil && q.opts.OnError != nil {
+				q.opts.OnError(err)
+			}
+			// Claim the next batch right away if the batch was full.
+			if err != nil || n < q.opts.BatchSize {
+				break
+			}
+		}
+		if err := q.opts.Clock.Sleep(ctx, q.opts.PollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// ProcessDue claims a batch of due jobs and handles them. It returns the number of claimed
+// jobs and the errors of the store.
+func (q *Queue) ProcessDue(ctx context.Context) (int, error) {
+	jobs, err := q.opts.Store.Claim(ctx, q.opts.Clock.Now(), q.opts.BatchSize, q.opts.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, q.opts.Concurrency)
+	errs := make([]error, len(jobs))
+	for i, job := range jobs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = q.process(ctx, job)
+		}()
+	}
+	wg.Wait()
+	return len(jobs), errors.Join(errs...)
+}
+
+func (q *Queue) process(ctx context.Context, job *Job) error {
+	q.mu.RLock()
+	h, ok := q.handlers[job.Kind]
+	q.mu.RUnlock()
+
+	var err error
+	if ok {
+		err = q.handle(ctx, h, job)
+	} else {
+		err = retry.Permanent(fmt.Errorf("retryqueue: no handler for kind %q", job.Kind))
+	}
+	if err == nil {
+		return q.opts.Store.Delete(ctx, job.ID)
+	}
+	if ctx.Err() != nil {
+		// The queue is stopping. The job is claimed again once the lease expired.
+		return nil
+	}
+
+	job.Attempts += 1
+	job.LastError = err.Error()
+	maxAttempts, delayer, maxDelay := q.opts.MaxAttempts, q.opts.Delayer, q.opts.MaxDelay
+	if job.Schedule != "" {
+		schedule, scheduleErr := retry.ParseSchedule(job.Schedule)
+		if scheduleErr != nil {
+			err = retry.Permanent(scheduleErr)
+		} else {
+			maxAttempts, delayer, maxDelay = schedule.MaxAttempts(), schedule.Delayer(), 0
+		}
+	}
+	if retry.IsPermanent(err) || job.Attempts >= maxAttempts {
+		if storeErr := q.opts.Store.DeadLetter(ctx, job); storeErr != nil {
+			return storeErr
+		}
+		if q.opts.OnDeadLetter != nil {
+			q.opts.OnDeadLetter(job, err)
+		}
+		return nil
+	}
+
+	d, hinted := retry.DelayHintFrom(err)
+	if !hinted {
+		d = delayer.Delay(job.CreatedAt, job.Attempts, err)
+		if maxDelay > 0 {
+			d = min(d, maxDelay)
+		}
+	}
+	job.NextAttemptAt = q.opts.Clock.Now().Add(d)
+	return q.opts.Store.Save(ctx, job)
+}
+
+// handle calls h within the lease of the job, converting panics into errors.
+func (q *Queue) handle(ctx context.Context, h Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("retryqueue: handler panicked: %v", r)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, q.opts.Lease)
+	defer cancel()
+	return h(ctx, job)
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,160 @@
+package retryqueue
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisPrefix = "retryqueue:"
+)
+
+// claimScript claims the due jobs of the sorted set KEYS[1] by postponing them to ARGV[2].
+var claimScript = redis.NewScript(`
+local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[3])
+for _, id in ipairs(ids) do
+	redis.call("ZADD", KEYS[1], ARGV[2], id)
+end
+return ids
+`)
+
+type redisStore struct {
+	client redis.UniversalClient
+	// jobsKey is a hash of the jobs, dueKey a sorted set of their IDs scored by the next attempt
+	// and deadKey a hash of the dead letters.
+	jobsKey string
+	dueKey  string
+	deadKey string
+}
+
+// NewRedisStore returns a Store keeping jobs in Redis under keys with the given prefix, which
+// defaults to "retryqueue:". With Redis Cluster the prefix must contain a hash tag, e.g.
+// "{retryqueue}:", since the keys are updated together.
+func NewRedisStore(client redis.UniversalClient, prefix string) Store {
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+	return &redisStore{
+		client:  client,
+		jobsKey: prefix + "jobs",
+		dueKey:  prefix + "due",
+		deadKey: prefix + "dead",
+	}
+}
+
+func (s *redisStore) Save(ctx context.Context, job *Job) error {
+	bs, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, s.jobsKey, job.ID, bs)
+		pipe.ZAdd(ctx, s.dueKey, redis.Z{Score: score(job.NextAttemptAt), Member: job.ID})
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]*Job, error) {
+	ids, err := claimScript.Run(ctx, s.client, []string{s.dueKey},
+		strconv.FormatInt(now.UnixMilli(), 10), strconv.FormatInt(now.Add(lease).UnixMilli(), 10), limit).StringSlice()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	values, err := s.client.HMGet(ctx, s.jobsKey, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(values))
+	for i, v := range values {
+		str, ok := v.(string)
+		if !ok {
+			// The job was deleted after its ID was claimed.
+			s.client.ZRem(ctx, s.dueKey, ids[i])
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal([]byte(str), &job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+func (s *redisStore) Delete(ctx context.Context, id string) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, s.jobsKey, id)
+		pipe.ZRem(ctx, s.dueKey, id)
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) DeadLetter(ctx context.Context, job *Job) error {
+	bs, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, s.jobsKey, job.ID)
+		pipe.ZRem(ctx, s.dueKey, job.ID)
+		pipe.HSet(ctx, s.deadKey, job.ID, bs)
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) DeadLetters(ctx context.Context, limit int) ([]*Job, error) {
+	values, err := s.client.HVals(ctx, s.deadKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(values))
+	for _, v := range values {
+		var job Job
+		if err := json.Unmarshal([]byte(v), &job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+	sortByCreatedAt(jobs)
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	return jobs, nil
+}
+
+func (s *redisStore) Requeue(ctx context.Context, id string, now time.Time) error {
+	v, err := s.client.HGet(ctx, s.deadKey, id).Result()
+	if err == redis.Nil {
+		return ErrJobNotFound
+	} else if err != nil {
+		return err
+	}
+	var job Job
+	if err := json.Unmarshal([]byte(v), &job); err != nil {
+		return err
+	}
+	job.requeue(now)
+	bs, err := json.Marshal(&job)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, s.deadKey, id)
+		pipe.HSet(ctx, s.jobsKey, id, bs)
+		pipe.ZAdd(ctx, s.dueKey, redis.Z{Score: score(job.NextAttemptAt), Member: id})
+		return nil
+	})
+	return err
+}
+
+func score(t time.Time) float64 {
+	return float64(t.UnixMilli())
+}
@@ -0,0 +1,125 @@
+package retryqueue
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrJobNotFound is returned by stores for unknown job IDs.
+	ErrJobNotFound = errors.New("retryqueue: job not found")
+)
+
+// Store persists the jobs of a Queue. Implementations backed by a database, e.g. Redis or
+// Postgres, keep jobs across process restarts and let several processes share a queue. They
+// must be safe for concurrent use.
+type Store interface {
+	// Save inserts or replaces job.
+	Save(ctx context.Context, job *Job) error
+	// Claim returns up to limit jobs due at now, ordered by NextAttemptAt, and postpones them
+	// to now+lease so that other workers don't claim them while they are processed. Jobs whose
+	// worker crashed are claimed again once the lease expired.
+	Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]*Job, error)
+	// Delete removes the job with the given ID once it succeeded.
+	Delete(ctx context.Context, id string) error
+	// DeadLetter moves job to the dead letters.
+	DeadLetter(ctx context.Context, job *Job) error
+	// DeadLetters returns up to limit dead letters, oldest first.
+	DeadLetters(ctx context.Context, limit int) ([]*Job, error)
+	// Requeue moves the dead letter with the given ID back to the queue, due at now with its
+	// attempts reset.
+	Requeue(ctx context.Context, id string, now time.Time) error
+}
+
+// MemoryStore is a Store keeping jobs in memory, e.g. for tests. Jobs are lost when the process
+// exits.
+type MemoryStore struct {
+	mu          sync.Mutex
+	jobs        map[string]*Job
+	deadLetters map[string]*Job
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]*Job), deadLetters: make(map[string]*Job)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job.clone()
+	return nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*Job
+	for _, job := range s.jobs {
+		if !job.NextAttemptAt.After(now) {
+			due = append(due, job)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]*Job, len(due))
+	for i, job := range due {
+		claimed[i] = job.clone()
+		job.NextAttemptAt = now.Add(lease)
+	}
+	return claimed, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+	return nil
+}
+
+func (s *MemoryStore) DeadLetter(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, job.ID)
+	s.deadLetters[job.ID] = job.clone()
+	return nil
+}
+
+func (s *MemoryStore) DeadLetters(ctx context.Context, limit int) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(s.deadLetters))
+	for _, job := range s.deadLetters {
+		jobs = append(jobs, job.clone())
+	}
+	sortByCreatedAt(jobs)
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	return jobs, nil
+}
+
+func (s *MemoryStore) Requeue(ctx context.Context, id string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.deadLetters[id]
+	if !ok {
+		return ErrJobNotFound
+	}
+	delete(s.deadLetters, id)
+	job.requeue(now)
+	s.jobs[id] = job
+	return nil
+}
+
+func sortByCreatedAt(jobs []*Job) {
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+}
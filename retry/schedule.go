@@ -0,0 +1,103 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	day = 24 * time.Hour
+)
+
+// Schedule is an explicit list of delays, e.g. for long horizon operations like reconciliations
+// that are retried after 1m, 5m, 30m, 2h and 1d. The retries stop after the last delay.
+type Schedule []time.Duration
+
+// ParseSchedule parses comma separated delays, e.g. "1m,5m,30m,2h,1d". Delays are parsed with
+// time.ParseDuration and may also be given in days with a "d" suffix.
+func ParseSchedule(s string) (Schedule, error) {
+	var schedule Schedule
+	for i, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		d, err := parseScheduleDelay(part)
+		if err != nil {
+			return nil, fmt.Errorf("retry: invalid schedule delay %d %q: %w", i+1, part, err)
+		}
+		schedule = append(schedule, d)
+	}
+	return schedule, nil
+}
+
+func parseScheduleDelay(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid days: %w", err)
+		}
+		if n < 0 {
+			return 0, errors.New("negative delay")
+		}
+		return time.Duration(n * float64(day)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("negative delay")
+	}
+	return d, nil
+}
+
+// Delay returns the delay after the given number of failed attempts, starting at 1. Attempts
+// beyond the schedule get the last delay.
+func (s Schedule) Delay(attempts int) time.Duration {
+	if len(s) == 0 {
+		return 0
+	}
+	return s[min(max(attempts, 1), len(s))-1]
+}
+
+// MaxAttempts returns the number of attempts of the schedule, the first one and one after every
+// delay.
+func (s Schedule) MaxAttempts() int {
+	return len(s) + 1
+}
+
+// Delayer returns a Delayer returning the delays of the schedule.
+func (s Schedule) Delayer() Delayer {
+	return DelayerFunc(func(startTime time.Time, attempts int, err error) time.Duration {
+		return s.Delay(attempts)
+	})
+}
+
+// Options returns Options retrying with the delays of the schedule.
+func (s Schedule) Options() Options {
+	return Options{Delayer: s.Delayer(), Stopper: MaxAttemptsStopper(s.MaxAttempts())}
+}
+
+// String returns the schedule in the format of ParseSchedule.
+func (s Schedule) String() string {
+	parts := make([]string, len(s))
+	for i, d := range s {
+		parts[i] = formatScheduleDelay(d)
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatScheduleDelay(d time.Duration) string {
+	if d >= day && d%day == 0 {
+		return strconv.FormatInt(int64(d/day), 10) + "d"
+	}
+	str := d.String()
+	if strings.HasSuffix(str, "m0s") {
+		str = strings.TrimSuffix(str, "0s")
+	}
+	if strings.HasSuffix(str, "h0m") {
+		str = strings.TrimSuffix(str, "0m")
+	}
+	return str
+}
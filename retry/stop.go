@@ -15,9 +15,15 @@ func (sf StopperFunc) Stop(startTime time.Time, attempts int, err error) bool {
 }
 
 func MaxAttemptsStopper(maxAttempts int) Stopper {
-	return StopperFunc(func(startTime time.Time, attempts int, err error) bool {
-		return attempts >= maxAttempts
-	})
+	return maxAttemptsStopper(maxAttempts)
+}
+
+// maxAttemptsStopper is the Stopper of MaxAttemptsStopper. It is a distinct type so that events
+// can report the maximum number of attempts.
+type maxAttemptsStopper int
+
+func (s maxAttemptsStopper) Stop(startTime time.Time, attempts int, err error) bool {
+	return attempts >= int(s)
 }
 
 func TimeoutStopper(d time.Duration) Stopper {
@@ -0,0 +1,32 @@
+package retry
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrConditionNotMet is the error of attempts of Until whose result wasn't accepted. It is
+	// returned if the retries stop before a result was accepted.
+	ErrConditionNotMet = errors.New("retry condition not met")
+)
+
+// Until calls fn until it returns a result accepted by accept, e.g. to poll the status of a
+// job until it completed. Errors of fn are retried as with Do. Results that aren't accepted are
+// retried as ErrConditionNotMet errors, which the default Options.RetryIf retries and custom
+// ones must allow. It returns the value and error of the last attempt.
+func Until[T any](fn func() (T, error), accept func(T) bool, opts Options) (T, error) {
+	return UntilWithContext(context.Background(), func(ctx context.Context) (T, error) {
+		return fn()
+	}, accept, opts)
+}
+
+func UntilWithContext[T any](ctx context.Context, fn func(ctx context.Context) (T, error), accept func(T) bool, opts Options) (T, error) {
+	return DoWithDataWithContext(ctx, func(ctx context.Context) (T, error) {
+		v, err := fn(ctx)
+		if err == nil && !accept(v) {
+			err = ErrConditionNotMet
+		}
+		return v, err
+	}, opts)
+}
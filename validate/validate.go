@@ -0,0 +1,200 @@
+// Package validate configures go-playground/validator with the rules shared by services, e.g.
+// phone, slug and safe_url, and converts validation errors into field errors for API responses.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	defaultValidator = sync.OnceValue(New)
+
+	e164Regexp = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	slugRegexp = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+	// numericHostRegexp matches hosts consisting of decimal, octal or hex numbers only.
+	numericHostRegexp = regexp.MustCompile(`^(?:0x[0-9a-f]*|[0-9]+)(?:\.(?:0x[0-9a-f]*|[0-9]+))*$`)
+
+	rulesMu sync.RWMutex
+	rules   = map[string]rule{
+		"phone":    {fn: isPhone, message: func(string) string { return "must be a phone number in E.164 format" }},
+		"slug":     {fn: isSlug, message: func(string) string { return "must be a slug of lower case letters, digits and dashes" }},
+		"safe_url": {fn: isSafeURL, message: func(string) string { return "must be a public http or https URL" }},
+	}
+	aliases = map[string]string{
+		"currency": "iso4217",
+	}
+)
+
+type rule struct {
+	fn      validator.Func
+	message func(param string) string
+}
+
+// FieldError describes a single field that failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// RegisterRule registers a rule added to the validators created by New afterwards, with the
+// message of its field errors. It must be called before Default is first used.
+func RegisterRule(tag string, fn validator.Func, message func(param string) string) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rules[tag] = rule{fn: fn, message: message}
+}
+
+// New returns a validator with the registered rules that reports field names using their json
+// tags. Besides the built-in rules of validator, it supports:
+//
+//   - phone: a phone number in E.164 format, e.g. +14155552671
+//   - slug: lower case letters and digits separated by single dashes
+//   - currency: an ISO 4217 currency code, an alias of iso4217
+//   - safe_url: an absolute http or https URL without credentials whose host isn't localhost,
+//     a private, loopback or link local IP address, or a numeric host in another notation, e.g.
+//     2130706433 or 0x7f.1. Host names aren't resolved, so callers fetching the URL must still
+//     check the IP address they connect to, e.g. in the Control function of a net.Dialer.
+//
+// The built-in timezone rule validates IANA time zone names.
+func New() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	for tag, r := range rules {
+		if err := v.RegisterValidation(tag, r.fn); err != nil {
+			panic(fmt.Sprintf("validate: invalid rule %s: %v", tag, err))
+		}
+	}
+	for alias, tags := range aliases {
+		v.RegisterAlias(alias, tags)
+	}
+	return v
+}
+
+// Default returns the validator used by Struct and Var, created with New on first use.
+func Default() *validator.Validate {
+	return defaultValidator()
+}
+
+// Struct validates the fields of the struct s with the default validator.
+func Struct(s any) error {
+	return Default().Struct(s)
+}
+
+// Var validates the single variable v with the given rules, e.g. "required,slug".
+func Var(v any, tag string) error {
+	return Default().Var(v, tag)
+}
+
+// FieldErrors converts the validation errors in err into field errors. It returns nil if err
+// doesn't contain validation errors.
+func FieldErrors(err error) []FieldError {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil
+	}
+
+	fieldErrors := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   fieldErrorName(fe),
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fieldErrorMessage(fe),
+		})
+	}
+	return fieldErrors
+}
+
+// fieldErrorName returns the field path without the name of the top level struct.
+func fieldErrorName(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if _, rest, ok := strings.Cut(ns, "."); ok {
+		return rest
+	}
+	return fe.Field()
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "required_if", "required_unless", "required_with", "required_without":
+		return "is required"
+	case "min", "gte":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max", "lte":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "lt":
+		return fmt.Sprintf("must be less than %s", fe.Param())
+	case "len":
+		return fmt.Sprintf("must have length %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of [%s]", fe.Param())
+	case "email":
+		return "must be a valid email address"
+	case "url", "uri":
+		return "must be a valid URL"
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "currency", "iso4217":
+		return "must be an ISO 4217 currency code"
+	case "timezone":
+		return "must be an IANA time zone"
+	}
+
+	rulesMu.RLock()
+	r, ok := rules[fe.Tag()]
+	rulesMu.RUnlock()
+	if ok && r.message != nil {
+		return r.message(fe.Param())
+	}
+	return fmt.Sprintf("failed the %q validation", fe.Tag())
+}
+
+func isPhone(fl validator.FieldLevel) bool {
+	return e164Regexp.MatchString(fl.Field().String())
+}
+
+func isSlug(fl validator.FieldLevel) bool {
+	return slugRegexp.MatchString(fl.Field().String())
+}
+
+func isSafeURL(fl validator.FieldLevel) bool {
+	u, err := url.Parse(fl.Field().String())
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.User != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified())
+	}
+	// Resolvers accept IPv4 addresses in decimal, octal and hex notation and with fewer than four
+	// parts, which ParseIP rejects, and IPv6 addresses with zones.
+	return !strings.ContainsAny(host, ":%") && !numericHostRegexp.MatchString(strings.TrimSuffix(host, "."))
+}